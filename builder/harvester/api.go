@@ -0,0 +1,124 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package harvester
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	harvester "github.com/drewmullen/harvester-go-sdk"
+	"golang.org/x/net/websocket"
+)
+
+// newClient returns a client for the Harvester API at url and the context
+// carrying token for its requests.
+func newClient(url string, token string) (*harvester.APIClient, context.Context) {
+	configuration := &harvester.Configuration{
+		DefaultHeader: make(map[string]string),
+		UserAgent:     "OpenAPI-Generator/1.0.0/go",
+		Debug:         false,
+		Servers: harvester.ServerConfigurations{
+			{
+				URL:         url,
+				Description: "Harvester API Server",
+			},
+		},
+	}
+	auth := context.WithValue(context.Background(), harvester.ContextAccessToken, token)
+	return harvester.NewAPIClient(configuration), auth
+}
+
+// rawRequest builds an authenticated request against the Harvester API for
+// endpoints the SDK does not cover, such as uploads and subresources.
+func rawRequest(ctx context.Context, client *harvester.APIClient, auth context.Context, method string, path string, body io.Reader) (*http.Request, error) {
+	cfg := client.GetConfig()
+	if len(cfg.Servers) == 0 {
+		return nil, fmt.Errorf("no Harvester API server configured")
+	}
+	url := strings.TrimSuffix(cfg.Servers[0].URL, "/") + path
+
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	if token, ok := auth.Value(harvester.ContextAccessToken).(string); ok {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	for k, v := range cfg.DefaultHeader {
+		req.Header.Set(k, v)
+	}
+	if cfg.UserAgent != "" {
+		req.Header.Set("User-Agent", cfg.UserAgent)
+	}
+	return req, nil
+}
+
+// doRawRequest sends the request and turns non-2xx responses into errors
+// carrying the response body.
+func doRawRequest(client *harvester.APIClient, req *http.Request) (*http.Response, error) {
+	httpClient := client.GetConfig().HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return resp, fmt.Errorf("%s %s: %s: %s", req.Method, req.URL.Path, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return resp, nil
+}
+
+// dialWebsocket opens an authenticated websocket against a streaming
+// subresource such as a VMI's vnc or console endpoint. the connection carries
+// binary frames and can be used as a plain net.Conn.
+func dialWebsocket(ctx context.Context, client *harvester.APIClient, auth context.Context, path string, protocol string) (*websocket.Conn, error) {
+	cfg := client.GetConfig()
+	if len(cfg.Servers) == 0 {
+		return nil, fmt.Errorf("no Harvester API server configured")
+	}
+	origin := strings.TrimSuffix(cfg.Servers[0].URL, "/")
+	url := origin + path
+	switch {
+	case strings.HasPrefix(url, "https://"):
+		url = "wss://" + strings.TrimPrefix(url, "https://")
+	case strings.HasPrefix(url, "http://"):
+		url = "ws://" + strings.TrimPrefix(url, "http://")
+	}
+
+	wsConfig, err := websocket.NewConfig(url, origin)
+	if err != nil {
+		return nil, err
+	}
+	if protocol != "" {
+		wsConfig.Protocol = []string{protocol}
+	}
+	if token, ok := auth.Value(harvester.ContextAccessToken).(string); ok {
+		wsConfig.Header.Set("Authorization", "Bearer "+token)
+	}
+	for k, v := range cfg.DefaultHeader {
+		wsConfig.Header.Set(k, v)
+	}
+	if cfg.UserAgent != "" {
+		wsConfig.Header.Set("User-Agent", cfg.UserAgent)
+	}
+	if cfg.HTTPClient != nil {
+		if t, ok := cfg.HTTPClient.Transport.(*http.Transport); ok {
+			wsConfig.TlsConfig = t.TLSClientConfig
+		}
+	}
+
+	ws, err := wsConfig.DialContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("dialing %s: %s", path, err)
+	}
+	ws.PayloadType = websocket.BinaryFrame
+	return ws, nil
+}
@@ -3,8 +3,24 @@
 
 package harvester
 
+import (
+	"fmt"
+	"strings"
+)
+
+// Image is a VirtualMachineImage exported by the build
+type Image struct {
+	Name        string
+	Namespace   string
+	DisplayName string
+	// the builder VM disk the image was exported from
+	Disk string
+}
+
 // packersdk.Artifact implementation
 type Artifact struct {
+	Images []Image
+
 	// StateData should store data such as GeneratedData
 	// to be shared with post-processors
 	StateData map[string]interface{}
@@ -18,12 +34,23 @@ func (a *Artifact) Files() []string {
 	return []string{}
 }
 
-func (*Artifact) Id() string {
-	return ""
+func (a *Artifact) Id() string {
+	ids := make([]string, 0, len(a.Images))
+	for _, image := range a.Images {
+		ids = append(ids, fmt.Sprintf("%s/%s", image.Namespace, image.Name))
+	}
+	return strings.Join(ids, ",")
 }
 
 func (a *Artifact) String() string {
-	return ""
+	if len(a.Images) == 0 {
+		return "No images were exported"
+	}
+	lines := []string{"Images were exported:"}
+	for _, image := range a.Images {
+		lines = append(lines, fmt.Sprintf("%s/%s (%s) from disk %s", image.Namespace, image.Name, image.DisplayName, image.Disk))
+	}
+	return strings.Join(lines, "\n")
 }
 
 func (a *Artifact) State(name string) interface{} {
@@ -4,13 +4,15 @@ package harvester
 
 import (
 	"context"
+	"errors"
+	"fmt"
 
 	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/hashicorp/packer-plugin-sdk/communicator"
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
 	"github.com/hashicorp/packer-plugin-sdk/multistep/commonsteps"
 	"github.com/hashicorp/packer-plugin-sdk/packer"
-
-	harvester "github.com/drewmullen/harvester-go-sdk"
+	"github.com/hashicorp/packer-plugin-sdk/uuid"
 )
 
 const BuilderId = "harvester.builder"
@@ -35,19 +37,10 @@ func (b *Builder) Prepare(raws ...interface{}) ([]string, []string, error) {
 func (b *Builder) Run(ctx context.Context, ui packer.Ui, hook packer.Hook) (packer.Artifact, error) {
 	steps := []multistep.Step{}
 
-	configuration := &harvester.Configuration{
-		DefaultHeader: make(map[string]string),
-		UserAgent:     "OpenAPI-Generator/1.0.0/go",
-		Debug:         false,
-		Servers: harvester.ServerConfigurations{
-			{
-				URL:         b.config.HarvesterURL,
-				Description: "Harvester API Server",
-			},
-		},
-	}
-	auth := context.WithValue(context.Background(), harvester.ContextAccessToken, b.config.HarvesterToken)
-	client := harvester.NewAPIClient(configuration)
+	// ties every resource the build creates together, see buildLabels
+	b.config.setBuildID(uuid.TimeOrderedUUID())
+
+	client, auth := newClient(b.config.HarvesterURL, b.config.HarvesterToken)
 
 	// Setup the state bag and initial state for the steps
 	state := new(multistep.BasicStateBag)
@@ -57,13 +50,39 @@ func (b *Builder) Run(ctx context.Context, ui packer.Ui, hook packer.Hook) (pack
 	state.Put("client", client)
 	state.Put("auth", auth)
 
+	ui.Say(fmt.Sprintf("Build ID is %s, resources are labeled %s=%s", b.config.buildID, LabelBuildID, b.config.buildID))
+
+	serialConsole := &StepSerialConsole{}
 	steps = append(steps,
+		&StepWatchEvents{},
 		&StepSourceBase{},
 		&StepCreateVolume{},
+		&StepHTTPIPDiscover{},
+		commonsteps.HTTPServerFromHTTPConfig(&b.config.HTTPConfig),
+		&StepCreateCloudInit{},
+		&commonsteps.StepCreateCD{
+			Files:   b.config.CDConfig.CDFiles,
+			Content: b.config.CDConfig.CDContent,
+			Label:   b.config.CDConfig.CDLabel,
+		},
+		&StepCreateCDImage{},
+		&StepCreateVirtioDriversVolume{},
 		&StepCreateVM{},
-		// TODO: on hold, cannot track status of exported VM
-		// new(commonsteps.StepProvision),
-		// &StepExportVMImage{},
+		serialConsole,
+		&StepTypeBootCommand{},
+		&StepWaitForIP{},
+		&communicator.StepConnect{
+			Config:    &b.config.Comm,
+			Host:      commHost,
+			SSHConfig: b.config.Comm.SSHConfigFunc(),
+		},
+		&StepStopSerialConsole{Console: serialConsole},
+		new(commonsteps.StepProvision),
+		&commonsteps.StepCleanupTempKeys{
+			Comm: &b.config.Comm,
+		},
+		&StepShutdown{},
+		&StepExportVMImage{},
 	)
 
 	// Set the value of the generated data that will become available to provisioners.
@@ -81,11 +100,22 @@ func (b *Builder) Run(ctx context.Context, ui packer.Ui, hook packer.Hook) (pack
 	if err, ok := state.GetOk("error"); ok {
 		return nil, err.(error)
 	}
+	if _, ok := state.GetOk(multistep.StateHalted); ok {
+		return nil, errors.New("build was halted")
+	}
+	if _, ok := state.GetOk(multistep.StateCancelled); ok {
+		return nil, errors.New("build was cancelled")
+	}
 
+	images, _ := state.Get("exportedImages").([]Image)
 	artifact := &Artifact{
+		Images: images,
 		// Add the builder generated data to the artifact StateData so that post-processors
 		// can access them.
-		StateData: map[string]interface{}{"generated_data": state.Get("generated_data")},
+		StateData: map[string]interface{}{
+			"generated_data": state.Get("generated_data"),
+			"build_id":       b.config.buildID,
+		},
 	}
 	return artifact, nil
 }
@@ -0,0 +1,130 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package harvester
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// runFakeBuild prepares and runs a build of f.raw(extra) against the fake.
+func runFakeBuild(t *testing.T, f *fakeHarvester, extra map[string]interface{}, hook packersdk.Hook) (packersdk.Artifact, error) {
+	var b Builder
+	if _, _, err := b.Prepare(f.raw(extra)); err != nil {
+		t.Fatalf("preparing builder: %s", err)
+	}
+	return b.Run(context.Background(), packersdk.TestUi(t), hook)
+}
+
+// assertCleanedUp fails the test when the build left a builder resource behind.
+func assertCleanedUp(t *testing.T, f *fakeHarvester) {
+	t.Helper()
+	for _, resource := range []string{fakeVMs, fakeVMIs, fakeVolumes, fakeSecrets} {
+		if names := f.names(resource); len(names) != 0 {
+			t.Errorf("%s %v left behind", resource, names)
+		}
+	}
+}
+
+func TestBuilderRun(t *testing.T) {
+	f := newFakeHarvester(t)
+	hook := &packersdk.MockHook{}
+
+	artifact, err := runFakeBuild(t, f, map[string]interface{}{
+		"user_data": "#cloud-config\n",
+		"builder_target": map[string]interface{}{
+			"display_name": "focal-golden",
+		},
+	}, hook)
+	if err != nil {
+		t.Fatalf("build failed: %s", err)
+	}
+	if !hook.RunCalled {
+		t.Error("provisioners were not run")
+	}
+
+	images := artifact.(*Artifact).Images
+	if len(images) != 1 || images[0].DisplayName != "focal-golden" {
+		t.Fatalf("unexpected artifact images %v", images)
+	}
+	if f.get(fakeImages, "default", images[0].Name) == nil {
+		t.Errorf("exported image %s does not exist", images[0].Name)
+	}
+	if f.get(fakeImages, "default", "focal") == nil {
+		t.Error("source image focal was deleted")
+	}
+	if artifact.State("build_id") == "" {
+		t.Error("artifact has no build_id")
+	}
+	assertCleanedUp(t, f)
+}
+
+func TestBuilderRun_provisionFailed(t *testing.T) {
+	f := newFakeHarvester(t)
+	hook := &packersdk.MockHook{
+		RunFunc: func(context.Context) error {
+			return errors.New("script exited with status 1")
+		},
+	}
+
+	if _, err := runFakeBuild(t, f, nil, hook); err == nil {
+		t.Fatal("build succeeded despite the provisioner failing")
+	}
+	assertCleanedUp(t, f)
+	if names := f.names(fakeImages); len(names) != 1 {
+		t.Errorf("images %v, want only the source image", names)
+	}
+}
+
+func TestBuilderRun_importFailed(t *testing.T) {
+	f := newFakeHarvester(t)
+	f.onCreate[fakeImages] = func(obj fakeObject) {
+		obj["status"] = map[string]interface{}{
+			"conditions": []interface{}{
+				map[string]interface{}{"type": "Imported", "status": "False", "message": "404 Not Found"},
+				map[string]interface{}{"type": "RetryLimitExceeded", "status": "True", "message": "404 Not Found"},
+			},
+		}
+	}
+
+	if _, err := runFakeBuild(t, f, nil, &packersdk.MockHook{}); err == nil {
+		t.Fatal("build succeeded despite the image failing to import")
+	}
+	if f.served("POST /api/v1/namespaces/default/persistentvolumeclaims") {
+		t.Error("volume created from an image that failed to import")
+	}
+	assertCleanedUp(t, f)
+}
+
+func TestBuilderRun_createVMFailed(t *testing.T) {
+	f := newFakeHarvester(t)
+	f.fail["POST "+fakeVMs] = http.StatusForbidden
+
+	if _, err := runFakeBuild(t, f, nil, &packersdk.MockHook{}); err == nil {
+		t.Fatal("build succeeded despite the VM not being created")
+	}
+	assertCleanedUp(t, f)
+}
+
+func TestBuilderRun_keepVMOnError(t *testing.T) {
+	f := newFakeHarvester(t)
+	hook := &packersdk.MockHook{
+		RunFunc: func(context.Context) error {
+			return errors.New("script exited with status 1")
+		},
+	}
+
+	if _, err := runFakeBuild(t, f, map[string]interface{}{"keep_vm_on_error": true}, hook); err == nil {
+		t.Fatal("build succeeded despite the provisioner failing")
+	}
+	for _, resource := range []string{fakeVMs, fakeVMIs, fakeVolumes} {
+		if names := f.names(resource); len(names) != 1 {
+			t.Errorf("%s %v, want the builder's kept for debugging", resource, names)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package harvester
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	getter "github.com/hashicorp/go-getter/v2"
+
+	harvester "github.com/drewmullen/harvester-go-sdk"
+)
+
+// ChecksumNone disables checksum verification of the source image.
+const ChecksumNone = "none"
+
+// AnnotationSourceChecksum records the checksum an image was created with, as
+// "<type>:<value>", so the image can be matched against a checksum other than
+// the SHA-512 Harvester stores without downloading it again.
+const AnnotationSourceChecksum = "packer.io/source-checksum"
+
+// resolveChecksum parses a Packer style checksum for the source, which is the
+// image URL or local path. It accepts "<type>:<value>", a bare value whose type
+// is inferred from its length, "file:<url or path>" pointing at a BSD or GNU
+// style checksum file, and "none". An empty or "none" checksum returns nil.
+func resolveChecksum(ctx context.Context, checksum string, source string) (*getter.FileChecksum, error) {
+	if checksum == "" || strings.EqualFold(checksum, ChecksumNone) {
+		return nil, nil
+	}
+
+	src := source
+	if u, err := url.Parse(source); err == nil && u.Scheme != "" && u.Host != "" {
+		q := u.Query()
+		q.Set("checksum", checksum)
+		u.RawQuery = q.Encode()
+		src = u.String()
+	} else {
+		src = fmt.Sprintf("%s?checksum=%s", source, url.QueryEscape(checksum))
+	}
+
+	pwd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	fc, err := getter.DefaultClient.GetChecksum(ctx, &getter.Request{Src: src, Pwd: pwd})
+	if err != nil {
+		return nil, err
+	}
+	if fc == nil {
+		return nil, fmt.Errorf("unable to parse checksum %q", checksum)
+	}
+	return fc, nil
+}
+
+// verifyLocalChecksum checks the local file against the checksum and returns
+// its SHA-512 for Harvester.
+func verifyLocalChecksum(fc *getter.FileChecksum, path string) (string, error) {
+	sum, err := fileSHA512(path)
+	if err != nil {
+		return "", err
+	}
+	if fc == nil {
+		return sum, nil
+	}
+	if fc.Type == "sha512" {
+		if !strings.EqualFold(sum, hex.EncodeToString(fc.Value)) {
+			return "", fmt.Errorf("checksum of %s does not match the provided checksum", path)
+		}
+		return sum, nil
+	}
+	if err := fc.Checksum(path); err != nil {
+		return "", err
+	}
+	return sum, nil
+}
+
+// checksumString formats the checksum as "<type>:<value>".
+func checksumString(fc *getter.FileChecksum) string {
+	return fmt.Sprintf("%s:%s", fc.Type, hex.EncodeToString(fc.Value))
+}
+
+// imageMatchesChecksum reports whether the existing image was created from the
+// image with the checksum fc, or whose SHA-512 is sha512Sum. The image is
+// matched against the checksum recorded in its annotation when that is of the
+// same type, and otherwise against the SHA-512 Harvester verified it with. An
+// image that can be matched against neither is an error.
+func imageMatchesChecksum(img harvester.HarvesterhciIoV1beta1VirtualMachineImage, fc *getter.FileChecksum, sha512Sum string) (bool, error) {
+	if fc != nil && img.Metadata != nil && img.Metadata.Annotations != nil {
+		recorded := (*img.Metadata.Annotations)[AnnotationSourceChecksum]
+		if strings.HasPrefix(recorded, fc.Type+":") {
+			return strings.EqualFold(recorded, checksumString(fc)), nil
+		}
+	}
+	if sha512Sum != "" {
+		if img.Spec.Checksum == nil || *img.Spec.Checksum == "" {
+			return false, fmt.Errorf("checksum not set for the image")
+		}
+		return strings.EqualFold(sha512Sum, *img.Spec.Checksum), nil
+	}
+	return false, fmt.Errorf("the image does not record its %s checksum, only sha512 checksums can be compared", fc.Type)
+}
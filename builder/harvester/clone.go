@@ -0,0 +1,149 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package harvester
+
+import (
+	"context"
+	"fmt"
+
+	harvester "github.com/drewmullen/harvester-go-sdk"
+)
+
+// vmRootVolume returns the name of the volume backing the boot disk of the VM,
+// falling back to its first volume claim when no disk has a boot order.
+func vmRootVolume(vm *harvester.KubevirtIoApiCoreV1VirtualMachine) (string, error) {
+	spec := vm.Spec.Template.Spec
+	if spec == nil {
+		return "", fmt.Errorf("vm has no template spec")
+	}
+
+	claims := map[string]string{}
+	firstClaim := ""
+	for _, volume := range spec.Volumes {
+		claimName := ""
+		if volume.PersistentVolumeClaim != nil {
+			claimName = volume.PersistentVolumeClaim.ClaimName
+		} else if volume.DataVolume != nil {
+			claimName = volume.DataVolume.Name
+		}
+		if claimName == "" {
+			continue
+		}
+		claims[volume.Name] = claimName
+		if firstClaim == "" {
+			firstClaim = claimName
+		}
+	}
+
+	var bootDisk *harvester.KubevirtIoApiCoreV1Disk
+	for i, disk := range spec.Domain.Devices.Disks {
+		if disk.BootOrder == nil || disk.Cdrom != nil {
+			continue
+		}
+		if bootDisk == nil || *disk.BootOrder < *bootDisk.BootOrder {
+			bootDisk = &spec.Domain.Devices.Disks[i]
+		}
+	}
+	if bootDisk != nil {
+		if claimName, ok := claims[bootDisk.Name]; ok {
+			return claimName, nil
+		}
+	}
+
+	if firstClaim == "" {
+		return "", fmt.Errorf("vm has no volumes backed by a persistent volume claim")
+	}
+	return firstClaim, nil
+}
+
+// cloneVolume creates a new volume as a CSI clone of the source volume. The
+// clone inherits the storage class and volume mode of the source, as CSI
+// cloning requires, and defaults to the size of the source, as a clone cannot
+// be smaller.
+func cloneVolume(client *harvester.APIClient, auth context.Context, c *Config, sourceName string) (string, error) {
+	namespace := c.HarvesterNamespace
+
+	readReq := client.VolumesAPI.ReadNamespacedPersistentVolumeClaim(auth, sourceName, namespace)
+	source, _, err := readReq.Execute()
+	if err != nil {
+		return "", fmt.Errorf("error reading source volume %s: %v", sourceName, err)
+	}
+	if source.Spec == nil {
+		return "", fmt.Errorf("source volume %s has no spec", sourceName)
+	}
+
+	size, err := cloneSize(c.BuilderTarget.VolumeSize, source)
+	if err != nil {
+		return "", fmt.Errorf("source volume %s: %v", sourceName, err)
+	}
+	if class := c.BuilderTarget.StorageClass; class != "" && (source.Spec.StorageClassName == nil || *source.Spec.StorageClassName != class) {
+		return "", fmt.Errorf("builder_target storage_class %q differs from the storage class of source volume %s, a clone must use the storage class of its source", class, sourceName)
+	}
+	if mode := c.BuilderTarget.VolumeMode; mode != "" && (source.Spec.VolumeMode == nil || *source.Spec.VolumeMode != mode) {
+		return "", fmt.Errorf("builder_target volume_mode %q differs from the volume mode of source volume %s, a clone must use the volume mode of its source", mode, sourceName)
+	}
+
+	claimInput := &harvester.K8sIoV1PersistentVolumeClaim{
+		Metadata: &harvester.K8sIoV1ObjectMeta{
+			GenerateName: &c.BuilderConfiguration.NamePrefix,
+			Labels:       buildLabels(c, nil),
+		},
+		Spec: &harvester.K8sIoV1PersistentVolumeClaimSpec{
+			AccessModes: c.BuilderTarget.AccessModes,
+			DataSource: &harvester.K8sIoV1TypedLocalObjectReference{
+				Kind: KindVolume,
+				Name: sourceName,
+			},
+			Resources: &harvester.K8sIoV1ResourceRequirements{
+				Requests: map[string]string{
+					"storage": size,
+				},
+			},
+			StorageClassName: source.Spec.StorageClassName,
+			VolumeMode:       source.Spec.VolumeMode,
+		},
+	}
+
+	req := client.VolumesAPI.CreateNamespacedPersistentVolumeClaim(auth, namespace)
+	req = req.K8sIoV1PersistentVolumeClaim(*claimInput)
+	claim, _, err := req.Execute()
+	if err != nil {
+		return "", err
+	}
+	if claim == nil || claim.Metadata == nil || claim.Metadata.Name == nil || *claim.Metadata.Name == "" {
+		return "", fmt.Errorf("volume name is empty")
+	}
+	return *claim.Metadata.Name, nil
+}
+
+// cloneSize returns the size of a clone of the source: volumeSize when it is
+// set, which must not be smaller than the source, else the size of the source.
+func cloneSize(volumeSize string, source *harvester.K8sIoV1PersistentVolumeClaim) (string, error) {
+	sourceSize := ""
+	if source.Spec.Resources != nil {
+		sourceSize = source.Spec.Resources.Requests["storage"]
+	}
+	if volumeSize == "" {
+		if sourceSize == "" {
+			return "", fmt.Errorf("no size requested, set builder_target volume_size")
+		}
+		return sourceSize, nil
+	}
+	if sourceSize == "" {
+		return volumeSize, nil
+	}
+
+	want, err := parseQuantity(volumeSize)
+	if err != nil {
+		return "", fmt.Errorf("builder_target volume_size: %v", err)
+	}
+	have, err := parseQuantity(sourceSize)
+	if err != nil {
+		return "", fmt.Errorf("size %q: %v", sourceSize, err)
+	}
+	if want.Cmp(have) < 0 {
+		return "", fmt.Errorf("builder_target volume_size %s is smaller than the source size %s, a clone cannot be smaller than its source", volumeSize, sourceSize)
+	}
+	return volumeSize, nil
+}
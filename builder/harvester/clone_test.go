@@ -0,0 +1,345 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package harvester
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	harvester "github.com/drewmullen/harvester-go-sdk"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+)
+
+// sourceVM returns a stopped VM with the disks and volumes given.
+func sourceVM(name string, disks []interface{}, volumes []interface{}) fakeObject {
+	return fakeObject{
+		"apiVersion": "kubevirt.io/v1",
+		"kind":       "VirtualMachine",
+		"metadata":   map[string]interface{}{"name": name},
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"domain":  map[string]interface{}{"devices": map[string]interface{}{"disks": disks}},
+					"volumes": volumes,
+				},
+			},
+		},
+	}
+}
+
+func claimVolume(name string, claimName string) map[string]interface{} {
+	return map[string]interface{}{
+		"name":                  name,
+		"persistentVolumeClaim": map[string]interface{}{"claimName": claimName},
+	}
+}
+
+func TestVMRootVolume(t *testing.T) {
+	cases := map[string]struct {
+		disks   []interface{}
+		volumes []interface{}
+		want    string
+		wantErr bool
+	}{
+		"lowest boot order": {
+			disks: []interface{}{
+				map[string]interface{}{"name": "data", "bootOrder": 2},
+				map[string]interface{}{"name": "rootdisk", "bootOrder": 1},
+			},
+			volumes: []interface{}{claimVolume("data", "golden-data"), claimVolume("rootdisk", "golden-root")},
+			want:    "golden-root",
+		},
+		"cdrom skipped": {
+			disks: []interface{}{
+				map[string]interface{}{"name": "cdrom", "bootOrder": 1, "cdrom": map[string]interface{}{"bus": "sata"}},
+				map[string]interface{}{"name": "rootdisk", "bootOrder": 2},
+			},
+			volumes: []interface{}{claimVolume("cdrom", "golden-iso"), claimVolume("rootdisk", "golden-root")},
+			want:    "golden-root",
+		},
+		"data volume": {
+			disks: []interface{}{map[string]interface{}{"name": "rootdisk", "bootOrder": 1}},
+			volumes: []interface{}{
+				map[string]interface{}{"name": "rootdisk", "dataVolume": map[string]interface{}{"name": "golden-dv"}},
+			},
+			want: "golden-dv",
+		},
+		"no boot order": {
+			disks: []interface{}{
+				map[string]interface{}{"name": "cloudinitdisk"},
+				map[string]interface{}{"name": "rootdisk"},
+			},
+			volumes: []interface{}{
+				map[string]interface{}{"name": "cloudinitdisk", "cloudInitNoCloud": map[string]interface{}{}},
+				claimVolume("rootdisk", "golden-root"),
+			},
+			want: "golden-root",
+		},
+		"no claims": {
+			disks: []interface{}{map[string]interface{}{"name": "rootdisk", "bootOrder": 1}},
+			volumes: []interface{}{
+				map[string]interface{}{"name": "rootdisk", "containerDisk": map[string]interface{}{"image": "example/disk"}},
+			},
+			wantErr: true,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			data, err := json.Marshal(sourceVM("golden", tc.disks, tc.volumes))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var vm harvester.KubevirtIoApiCoreV1VirtualMachine
+			if err := json.Unmarshal(data, &vm); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := vmRootVolume(&vm)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("vmRootVolume = %q, want an error", got)
+				}
+				return
+			}
+			if err != nil || got != tc.want {
+				t.Errorf("vmRootVolume = %q, %v, want %q", got, err, tc.want)
+			}
+		})
+	}
+}
+
+func TestConfigPrepare_cloneSource(t *testing.T) {
+	cases := map[string]struct {
+		source  map[string]interface{}
+		wantErr string
+	}{
+		"volume": {
+			source: map[string]interface{}{"volume": "golden-root"},
+		},
+		"vm": {
+			source: map[string]interface{}{"vm": "golden"},
+		},
+		"volume and vm": {
+			source:  map[string]interface{}{"volume": "golden-root", "vm": "golden"},
+			wantErr: "only one of volume or vm can be set",
+		},
+		"volume and image": {
+			source:  map[string]interface{}{"volume": "golden-root", "name": "focal"},
+			wantErr: "cannot be combined with volume or vm",
+		},
+		"iso": {
+			source:  map[string]interface{}{"vm": "golden", "image_type": ImageTypeISO},
+			wantErr: "cannot be combined with volume or vm",
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			c := &Config{}
+			_, err := c.Prepare(testConfigRaw(map[string]interface{}{"builder_source": tc.source}))
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Prepare: %s", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("Prepare error %v, want %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestStepSourceBase_cloneVM(t *testing.T) {
+	f := newFakeHarvester(t)
+	c := f.config(map[string]interface{}{"builder_source": map[string]interface{}{"vm": "golden"}})
+	f.put(fakeVMs, "default", sourceVM("golden",
+		[]interface{}{map[string]interface{}{"name": "rootdisk", "bootOrder": 1}},
+		[]interface{}{claimVolume("rootdisk", "golden-root")},
+	))
+	f.put(fakeVolumes, "default", fakeObject{
+		"metadata": map[string]interface{}{"name": "golden-root"},
+		"spec": map[string]interface{}{
+			"accessModes":      []interface{}{AccessModeReadWriteMany},
+			"resources":        map[string]interface{}{"requests": map[string]interface{}{"storage": "200Gi"}},
+			"storageClassName": "longhorn-golden",
+			"volumeMode":       VolumeModeBlock,
+		},
+	})
+	state := f.state(c)
+
+	if action := (&StepSourceBase{}).Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("unexpected action %v: %v", action, state.Get("error"))
+	}
+	if got := state.Get("sourceVolumeName"); got != "golden-root" {
+		t.Fatalf("source volume is %v, want golden-root", got)
+	}
+	if names := f.names(fakeImages); len(names) != 0 {
+		t.Errorf("images %v created for a clone", names)
+	}
+
+	if action := (&StepCreateVolume{}).Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("unexpected action %v: %v", action, state.Get("error"))
+	}
+	spec := f.get(fakeVolumes, "default", state.Get("volumeName").(string))["spec"].(map[string]interface{})
+	dataSource, _ := spec["dataSource"].(map[string]interface{})
+	if dataSource["name"] != "golden-root" || dataSource["kind"] != KindVolume {
+		t.Errorf("data source is %v, want a clone of golden-root", spec["dataSource"])
+	}
+	if got := spec["storageClassName"]; got != "longhorn-golden" {
+		t.Errorf("storage class is %v, want the source volume's", got)
+	}
+	if got := spec["resources"].(map[string]interface{})["requests"].(map[string]interface{})["storage"]; got != "200Gi" {
+		t.Errorf("clone size is %v, want the source volume's 200Gi", got)
+	}
+}
+
+func TestStepSourceBase_cloneVMNotFound(t *testing.T) {
+	f := newFakeHarvester(t)
+	c := f.config(map[string]interface{}{"builder_source": map[string]interface{}{"vm": "golden"}})
+	state := f.state(c)
+
+	if action := (&StepSourceBase{}).Run(context.Background(), state); action != multistep.ActionHalt {
+		t.Fatalf("unexpected action %v, want a missing VM to halt the build", action)
+	}
+	if err := state.Get("error").(error); !strings.Contains(err.Error(), "golden") {
+		t.Errorf("error %v does not name the VM", err)
+	}
+}
+
+func TestStepCreateVolume_cloneVolumeNotFound(t *testing.T) {
+	f := newFakeHarvester(t)
+	c := f.config(map[string]interface{}{"builder_source": map[string]interface{}{"volume": "golden-root"}})
+	state := f.state(c)
+	state.Put("sourceVolumeName", "golden-root")
+
+	if action := (&StepCreateVolume{}).Run(context.Background(), state); action != multistep.ActionHalt {
+		t.Fatalf("unexpected action %v, want a missing volume to halt the build", action)
+	}
+	if names := f.names(fakeVolumes); len(names) != 0 {
+		t.Errorf("volumes %v created without a source", names)
+	}
+}
+
+func TestParseQuantity(t *testing.T) {
+	cases := map[string]string{
+		"100Gi":      "107374182400",
+		"1.5Ti":      "1649267441664",
+		"10G":        "10000000000",
+		"1073741824": "1073741824",
+		"1e3":        "1000",
+		"500m":       "1/2",
+	}
+	for in, want := range cases {
+		got, err := parseQuantity(in)
+		if err != nil || got.RatString() != want {
+			t.Errorf("parseQuantity(%q) = %v, %v, want %s", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "Gi", "ten", "1/2", "10 Gi", "10GB"} {
+		if got, err := parseQuantity(in); err == nil {
+			t.Errorf("parseQuantity(%q) = %v, want an error", in, got)
+		}
+	}
+}
+
+func TestCloneSize(t *testing.T) {
+	cases := map[string]struct {
+		volumeSize string
+		sourceSize string
+		want       string
+		wantErr    string
+	}{
+		"source size":         {sourceSize: "200Gi", want: "200Gi"},
+		"larger":              {volumeSize: "300Gi", sourceSize: "200Gi", want: "300Gi"},
+		"same in other units": {volumeSize: "1024Mi", sourceSize: "1Gi", want: "1024Mi"},
+		"smaller":             {volumeSize: "100Gi", sourceSize: "200Gi", wantErr: "is smaller than the source size 200Gi"},
+		"source without size": {volumeSize: "100Gi", want: "100Gi"},
+		"no size":             {wantErr: "set builder_target volume_size"},
+		"invalid volume size": {volumeSize: "lots", sourceSize: "200Gi", wantErr: "builder_target volume_size"},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			source := &harvester.K8sIoV1PersistentVolumeClaim{Spec: &harvester.K8sIoV1PersistentVolumeClaimSpec{}}
+			if tc.sourceSize != "" {
+				source.Spec.Resources = &harvester.K8sIoV1ResourceRequirements{
+					Requests: map[string]string{"storage": tc.sourceSize},
+				}
+			}
+			got, err := cloneSize(tc.volumeSize, source)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Errorf("cloneSize error %v, want %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tc.want {
+				t.Errorf("cloneSize = %q, %v, want %q", got, err, tc.want)
+			}
+		})
+	}
+}
+
+func TestStepCreateVolume_cloneMismatch(t *testing.T) {
+	cases := map[string]struct {
+		target  map[string]interface{}
+		wantErr string
+	}{
+		"storage class": {
+			target:  map[string]interface{}{"storage_class": "ssd"},
+			wantErr: `builder_target storage_class "ssd" differs`,
+		},
+		"volume mode": {
+			target:  map[string]interface{}{"volume_mode": VolumeModeFilesystem},
+			wantErr: `builder_target volume_mode "Filesystem" differs`,
+		},
+		"size": {
+			target:  map[string]interface{}{"volume_size": "100Gi"},
+			wantErr: "a clone cannot be smaller than its source",
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := newFakeHarvester(t)
+			c := f.config(map[string]interface{}{
+				"builder_source": map[string]interface{}{"volume": "golden-root"},
+				"builder_target": tc.target,
+			})
+			f.put(fakeVolumes, "default", fakeObject{
+				"metadata": map[string]interface{}{"name": "golden-root"},
+				"spec": map[string]interface{}{
+					"resources":        map[string]interface{}{"requests": map[string]interface{}{"storage": "200Gi"}},
+					"storageClassName": "longhorn-golden",
+					"volumeMode":       VolumeModeBlock,
+				},
+			})
+			state := f.state(c)
+			state.Put("sourceVolumeName", "golden-root")
+
+			if action := (&StepCreateVolume{}).Run(context.Background(), state); action != multistep.ActionHalt {
+				t.Fatalf("unexpected action %v, want the build to halt", action)
+			}
+			if err := state.Get("error").(error); !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("error %v, want %q", err, tc.wantErr)
+			}
+			if names := f.names(fakeVolumes); len(names) != 1 {
+				t.Errorf("volumes %v, want only the source", names)
+			}
+		})
+	}
+}
+
+func TestConfigPrepare_cloneDefaults(t *testing.T) {
+	c := &Config{}
+	_, err := c.Prepare(testConfigRaw(map[string]interface{}{
+		"builder_source": map[string]interface{}{"volume": "golden-root"},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.BuilderTarget.VolumeSize != "" || c.BuilderTarget.VolumeMode != "" {
+		t.Errorf("volume size %q and mode %q set, want them taken from the source", c.BuilderTarget.VolumeSize, c.BuilderTarget.VolumeMode)
+	}
+}
@@ -1,12 +1,23 @@
-//go:generate packer-sdc mapstructure-to-hcl2 -type Config,BuilderSource,BuilderConfiguration,BuilderTarget
+//go:generate packer-sdc mapstructure-to-hcl2 -type Config,BuilderSource,BuilderConfiguration,BuilderTarget,AffinityRule,Toleration,NetworkInterface,Disk,ImageFilter
 
 package harvester
 
 import (
+	"fmt"
+	"net"
 	"os"
+	"regexp"
+	"strings"
+	"time"
 
+	"github.com/hashicorp/packer-plugin-sdk/bootcommand"
 	"github.com/hashicorp/packer-plugin-sdk/common"
+	"github.com/hashicorp/packer-plugin-sdk/communicator"
+	"github.com/hashicorp/packer-plugin-sdk/multistep/commonsteps"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/shutdowncommand"
 	"github.com/hashicorp/packer-plugin-sdk/template/config"
+	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
 )
 
 type Config struct {
@@ -18,17 +29,115 @@ type Config struct {
 	BuilderSource        BuilderSource        `mapstructure:"builder_source"`
 	BuilderConfiguration BuilderConfiguration `mapstructure:"builder_configuration"`
 	BuilderTarget        BuilderTarget        `mapstructure:"builder_target"`
+
+	// default to "winrm" for windows, "ssh" when ssh_username is set and
+	// "none" otherwise
+	Comm communicator.Config `mapstructure:",squash"`
+	// run over the communicator to stop the builder VM before export. when
+	// empty the VM is stopped through KubeVirt. default shutdown_timeout 5m
+	shutdowncommand.ShutdownConfig `mapstructure:",squash"`
+
+	// boot_command is typed over the VMI's VNC console after boot_wait
+	bootcommand.VNCConfig `mapstructure:",squash"`
+	// serves http_directory/http_content to the builder VM during the build
+	commonsteps.HTTPConfig `mapstructure:",squash"`
+	// cd_files and cd_content are built into an ISO and attached as a CD-ROM
+	commonsteps.CDConfig `mapstructure:",squash"`
+	// the IP the builder VM uses to reach the HTTP server, default to the
+	// address of http_interface or of the route to harvester_url. the
+	// server itself listens on http_bind_address
+	HTTPIP string `mapstructure:"http_ip" required:"false"`
+
+	// cloud-init user data for the builder VM. rendered with {{ .HTTPIP }}
+	// and {{ .HTTPPort }} and stored in a secret for the build. default to
+	// the existing "packer" secret
+	UserData     string `mapstructure:"user_data" required:"false"`
+	UserDataFile string `mapstructure:"user_data_file" required:"false"`
+	NetworkData  string `mapstructure:"network_data" required:"false"`
+
+	// keep the builder VM, its volumes and cloud-init secret when the build
+	// fails, and print how to reach its console
+	KeepVMOnError bool `mapstructure:"keep_vm_on_error" required:"false"`
+	// stream the builder VM's serial console to the Packer UI until the
+	// communicator connects
+	SerialConsoleLog bool `mapstructure:"serial_console_log" required:"false"`
+	// write the serial console to this file instead of the UI. implies
+	// serial_console_log
+	SerialConsoleLogPath string `mapstructure:"serial_console_log_path" required:"false"`
+
+	// how long to wait for the source, CD and virtio driver images to
+	// import, default 30m. large installer ISOs can take a while
+	ImageImportTimeout time.Duration `mapstructure:"image_import_timeout" required:"false"`
+	// how long to wait for the builder VM to start running, default 10m
+	VMStartTimeout time.Duration `mapstructure:"vm_start_timeout" required:"false"`
+	// how long to wait for the builder VM to report an IP address, default 30m
+	IPWaitTimeout time.Duration `mapstructure:"ip_wait_timeout" required:"false"`
+	// only use addresses inside one of these CIDRs
+	IPWaitCIDR []string `mapstructure:"ip_wait_cidr" required:"false"`
+	// one of "ipv4" or "ipv6", default "ipv4". the other family is used when
+	// no address of the preferred one is reported
+	IPFamily string `mapstructure:"ip_family" required:"false"`
+	// wait for the QEMU guest agent to connect before looking for an address
+	WaitForGuestAgent bool `mapstructure:"wait_for_guest_agent" required:"false"`
+
+	ctx interpolate.Context
+	// set by Builder.Run and stamped on every resource the build creates
+	buildID string
+}
+
+// setBuildID sets the ID of the build and the defaults derived from it, which
+// keep the images of every build of a template apart.
+func (c *Config) setBuildID(id string) {
+	c.buildID = id
+	if c.BuilderTarget.DisplayName == "" {
+		c.BuilderTarget.DisplayName = c.BuilderConfiguration.NamePrefix + id
+	}
+	for i := range c.BuilderConfiguration.Disks {
+		disk := &c.BuilderConfiguration.Disks[i]
+		if disk.DisplayName == "" {
+			disk.DisplayName = fmt.Sprintf("%s-%s", c.BuilderTarget.DisplayName, disk.Name)
+		}
+	}
 }
 
 type BuilderSource struct {
-	Name      string `mapstructure:"name"`
-	OSType    string `mapstructure:"os_type"`
+	// the Kubernetes object name of the image, used to find and create it
+	Name   string `mapstructure:"name"`
+	OSType string `mapstructure:"os_type"`
+	// one of "raw_qcow2" or "iso", default "raw_qcow2". an iso is attached as
+	// a CD-ROM and installed to a blank root volume of volume_size
 	ImageType string `mapstructure:"image_type"`
 
-	URL         string `mapstructure:"url" required:"false"`
+	URL string `mapstructure:"url" required:"false"`
+	// the name shown in the Harvester UI, default to Name. must be unique in
+	// the namespace
 	DisplayName string `mapstructure:"display_name" required:"false"`
-	Checksum    string `mapstructure:"checksum" required:"false"`
-	Cleanup     bool   `mapstructure:"cleanup" required:"false"`
+	// Packer style checksum: "<type>:<value>", "file:<url>" or "none". an
+	// image downloaded from url needs a sha512 checksum, as that is all
+	// Harvester verifies. other types are checked for local_path, and match
+	// an existing image created with the same checksum
+	Checksum string `mapstructure:"checksum" required:"false"`
+	Cleanup  bool   `mapstructure:"cleanup" required:"false"`
+
+	// path to a disk image on the build host to upload instead of downloading
+	// URL. the image is sent in a single request, an interrupted upload is
+	// retried from the start
+	LocalPath string `mapstructure:"local_path" required:"false"`
+	// clone an existing volume in harvester_namespace instead of using an image
+	Volume string `mapstructure:"volume" required:"false"`
+	// clone the root volume of an existing VM in harvester_namespace instead of using an image
+	VM string `mapstructure:"vm" required:"false"`
+	// look up an existing image instead of naming it
+	Filter ImageFilter `mapstructure:"filter" required:"false"`
+}
+
+type ImageFilter struct {
+	// labels the image must carry
+	Labels map[string]string `mapstructure:"labels" required:"false"`
+	// regular expression the image display name must match
+	DisplayName string `mapstructure:"display_name" required:"false"`
+	// pick the newest match instead of failing when several images match
+	MostRecent bool `mapstructure:"most_recent" required:"false"`
 }
 
 type BuilderConfiguration struct {
@@ -41,21 +150,153 @@ type BuilderConfiguration struct {
 	// default 2Gi
 	Memory string `mapstructure:"memory" required:"false"`
 	// PreventBuilderImageCleanup bool `mapstructure:"prevent_builder_image_cleanup" required:"false"`
+	// shorthand for a single bridge network_interface, ignored when
+	// network_interface blocks are set
 	NetworkNamespace string `mapstructure:"network_namespace"`
-	Network string `mapstructure:"network"`
+	Network          string `mapstructure:"network"`
+	// default to a bridge nic-1 on NetworkNamespace/Network, or to the pod
+	// network when no Network is set
+	NetworkInterfaces []NetworkInterface `mapstructure:"network_interface" required:"false"`
+	// one of "linux" or "windows", default "linux". windows adds Hyper-V
+	// enlightenments and a Windows clock, and defaults to sata disks and e1000
+	// NICs until virtio drivers are installed
+	OSFamily string `mapstructure:"os_family" required:"false"`
+	// default "virtio", or "sata" for windows
+	RootDiskBus string `mapstructure:"root_disk_bus" required:"false"`
+	// attach Windows virtio drivers as a second CD-ROM so the installer can load
+	// storage and network drivers. only the root volume is exported, so the
+	// drivers are not part of the image. implied by virtio_drivers_image and
+	// virtio_drivers_container_disk
+	VirtioDrivers bool `mapstructure:"virtio_drivers" required:"false"`
+	// a Harvester ISO image holding the drivers, as name or namespace/name,
+	// instead of the container disk. for example a virtio-win ISO
+	VirtioDriversImage string `mapstructure:"virtio_drivers_image" required:"false"`
+	// the container disk holding the drivers, default to the VMDP drivers
+	// Harvester bundles, registry.suse.com/suse/vmdp/vmdp:2.5.4.2. set it to
+	// e.g. quay.io/kubevirt/virtio-container-disk for the virtio-win drivers
+	VirtioDriversContainerDisk string `mapstructure:"virtio_drivers_container_disk" required:"false"`
+	// additional blank disks attached to the builder VM
+	Disks []Disk `mapstructure:"disk" required:"false"`
+
+	// node labels the builder VM must be scheduled on
+	NodeSelector map[string]string `mapstructure:"node_selector" required:"false"`
+	// replaces the default affinity unless default_affinity = true
+	AffinityRules []AffinityRule `mapstructure:"affinity_rules" required:"false"`
+	// default to true when no affinity_rules are set
+	DefaultAffinity   config.Trilean `mapstructure:"default_affinity" required:"false"`
+	Tolerations       []Toleration   `mapstructure:"tolerations" required:"false"`
+	PriorityClassName string         `mapstructure:"priority_class_name" required:"false"`
+
+	// added to the builder VM. tags show in the Harvester UI and are stored
+	// as tag.harvesterhci.io/<key> labels
+	Tags        map[string]string `mapstructure:"tags" required:"false"`
+	Labels      map[string]string `mapstructure:"labels" required:"false"`
+	Annotations map[string]string `mapstructure:"annotations" required:"false"`
+}
+
+type NetworkInterface struct {
+	// default to "nic-<index>"
+	Name string `mapstructure:"name" required:"false"`
+	// one of "bridge" or "masquerade", default to "bridge"
+	Type string `mapstructure:"type" required:"false"`
+	// "<namespace>/<name>" of the VM network, required for bridge interfaces
+	Network string `mapstructure:"network" required:"false"`
+	// default "virtio"
+	Model      string `mapstructure:"model" required:"false"`
+	MACAddress string `mapstructure:"mac_address" required:"false"`
+	// default to the first interface
+	Communicator bool `mapstructure:"communicator" required:"false"`
+}
+
+type Disk struct {
+	// default to "disk-<index>"
+	Name string `mapstructure:"name" required:"false"`
+	Size string `mapstructure:"size"`
+	// one of "virtio", "sata" or "scsi", default "virtio", or "sata" for
+	// windows
+	Bus string `mapstructure:"bus" required:"false"`
+	// default "harvester-longhorn"
+	StorageClass string `mapstructure:"storage_class" required:"false"`
+	// default "Block"
+	VolumeMode string `mapstructure:"volume_mode" required:"false"`
+	// default to not bootable. 1 is the root disk and, for iso builds, 2 the
+	// installer ISO, and no two disks can share a boot order
+	BootOrder int32 `mapstructure:"boot_order" required:"false"`
+	// export the disk as its own image alongside the root volume
+	Export bool `mapstructure:"export" required:"false"`
+	// default to "<builder_target.display_name>-<name>"
+	DisplayName string `mapstructure:"display_name" required:"false"`
+}
+
+type AffinityRule struct {
+	// one of "node", "pod" or "pod_anti"
+	Type string `mapstructure:"type"`
+	// default to false, a preferred rule weighted by Weight
+	Required bool `mapstructure:"required" required:"false"`
+	// default 100, ignored for required rules
+	Weight   int32    `mapstructure:"weight" required:"false"`
+	Key      string   `mapstructure:"key"`
+	Operator string   `mapstructure:"operator"`
+	Values   []string `mapstructure:"values" required:"false"`
+	// default to "kubernetes.io/hostname", ignored for node rules
+	TopologyKey string `mapstructure:"topology_key" required:"false"`
+}
+
+type Toleration struct {
+	Key string `mapstructure:"key" required:"false"`
+	// default to "Equal"
+	Operator          string `mapstructure:"operator" required:"false"`
+	Value             string `mapstructure:"value" required:"false"`
+	Effect            string `mapstructure:"effect" required:"false"`
+	TolerationSeconds int64  `mapstructure:"toleration_seconds" required:"false"`
 }
 
 type BuilderTarget struct {
 	// default to HarvesterNamespace
-	Namespace   string `mapstructure:"namespace" required:"false"`
+	Namespace string `mapstructure:"namespace" required:"false"`
+	// default to "<name_prefix><build id>"
 	DisplayName string `mapstructure:"display_name" required:"false"`
-	VolumeSize  string `mapstructure:"volume_size" required:"false"`
+	// default "100Gi", or the size of the source volume for volume and vm
+	// sources. a clone cannot be smaller than its source
+	VolumeSize string `mapstructure:"volume_size" required:"false"`
+	// storage class of the blank root volume of an iso build, default
+	// "harvester-longhorn". a root volume created from an image always uses
+	// the storage class the image reports, and a clone the storage class of
+	// its source. the build fails when this is set to another class
+	StorageClass string `mapstructure:"storage_class" required:"false"`
+	// default ["ReadWriteMany"]
+	AccessModes []string `mapstructure:"access_modes" required:"false"`
+	// default "Block". a clone always has the volume mode of its source, and
+	// the build fails when this is set to another mode
+	VolumeMode string `mapstructure:"volume_mode" required:"false"`
+
+	// added to the exported images, as for builder_configuration
+	Tags        map[string]string `mapstructure:"tags" required:"false"`
+	Labels      map[string]string `mapstructure:"labels" required:"false"`
+	Annotations map[string]string `mapstructure:"annotations" required:"false"`
+}
+
+// objectNameRegexp matches a valid Kubernetes object name (DNS subdomain).
+var objectNameRegexp = regexp.MustCompile(`^[a-z0-9]([-a-z0-9.]*[a-z0-9])?$`)
+
+// clonesVolume reports whether the build starts from an existing volume rather
+// than an image.
+func (s *BuilderSource) clonesVolume() bool {
+	return s.Volume != "" || s.VM != ""
 }
 
 func (c *Config) Prepare(raws ...interface{}) (generatedVars []string, err error) {
 	err = config.Decode(c, &config.DecodeOpts{
-		PluginType:  "packer.builder.harvester",
-		Interpolate: true,
+		PluginType:         "packer.builder.harvester",
+		Interpolate:        true,
+		InterpolateContext: &c.ctx,
+		InterpolateFilter: &interpolate.RenderFilter{
+			Exclude: []string{
+				"boot_command",
+				"user_data",
+				"network_data",
+			},
+		},
 	}, raws...)
 	if err != nil {
 		return nil, err
@@ -87,10 +328,47 @@ func (c *Config) Prepare(raws ...interface{}) (generatedVars []string, err error
 		c.BuilderConfiguration.Memory = "2Gi"
 	}
 
-	if c.BuilderTarget.VolumeSize == "" {
+	// clones default to the size and volume mode of their source, which is
+	// only known once it is read
+	if c.BuilderTarget.VolumeSize == "" && !c.BuilderSource.clonesVolume() {
 		c.BuilderTarget.VolumeSize = "100Gi"
 	}
 
+	if c.BuilderTarget.Namespace == "" {
+		c.BuilderTarget.Namespace = c.HarvesterNamespace
+	}
+
+	if len(c.BuilderTarget.AccessModes) == 0 {
+		c.BuilderTarget.AccessModes = []string{AccessModeReadWriteMany}
+	}
+
+	if c.BuilderTarget.VolumeMode == "" && !c.BuilderSource.clonesVolume() {
+		c.BuilderTarget.VolumeMode = VolumeModeBlock
+	}
+
+	if c.BuilderConfiguration.OSFamily == "" {
+		c.BuilderConfiguration.OSFamily = OSFamilyLinux
+	}
+	windows := c.BuilderConfiguration.OSFamily == OSFamilyWindows
+
+	if c.BuilderConfiguration.RootDiskBus == "" {
+		c.BuilderConfiguration.RootDiskBus = DiskBusVirtio
+		if windows {
+			c.BuilderConfiguration.RootDiskBus = DiskBusSata
+		}
+	}
+
+	if c.Comm.Type == "" {
+		switch {
+		case windows:
+			c.Comm.Type = "winrm"
+		case c.Comm.SSHUsername != "":
+			c.Comm.Type = "ssh"
+		default:
+			c.Comm.Type = "none"
+		}
+	}
+
 	if c.BuilderConfiguration.NamePrefix == "" {
 		c.BuilderConfiguration.NamePrefix = "packer-"
 	}
@@ -99,6 +377,292 @@ func (c *Config) Prepare(raws ...interface{}) (generatedVars []string, err error
 		c.BuilderConfiguration.NetworkNamespace = "harvester-public"
 	}
 
+	var errs *packersdk.MultiError
+
+	errs = packersdk.MultiErrorAppend(errs, c.VNCConfig.Prepare(&c.ctx)...)
+	errs = packersdk.MultiErrorAppend(errs, c.HTTPConfig.Prepare(&c.ctx)...)
+	errs = packersdk.MultiErrorAppend(errs, c.CDConfig.Prepare(&c.ctx)...)
+	errs = packersdk.MultiErrorAppend(errs, c.Comm.Prepare(&c.ctx)...)
+	errs = packersdk.MultiErrorAppend(errs, c.ShutdownConfig.Prepare(&c.ctx)...)
+
+	if !windows && c.BuilderConfiguration.OSFamily != OSFamilyLinux {
+		errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("os_family must be %q or %q", OSFamilyLinux, OSFamilyWindows))
+	}
+
+	if c.SerialConsoleLogPath != "" {
+		c.SerialConsoleLog = true
+	}
+
+	if c.ImageImportTimeout == 0 {
+		c.ImageImportTimeout = 30 * time.Minute
+	}
+	if c.VMStartTimeout == 0 {
+		c.VMStartTimeout = 10 * time.Minute
+	}
+	if c.IPWaitTimeout == 0 {
+		c.IPWaitTimeout = 30 * time.Minute
+	}
+	if c.IPFamily == "" {
+		c.IPFamily = IPFamilyIPv4
+	}
+	if c.IPFamily != IPFamilyIPv4 && c.IPFamily != IPFamilyIPv6 {
+		errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("ip_family must be %q or %q", IPFamilyIPv4, IPFamilyIPv6))
+	}
+	for _, cidr := range c.IPWaitCIDR {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("ip_wait_cidr: %s", err))
+		}
+	}
+
+	if c.HTTPIP != "" && net.ParseIP(c.HTTPIP) == nil {
+		errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("http_ip %q is not an IP address", c.HTTPIP))
+	}
+	if c.UserDataFile != "" {
+		if c.UserData != "" {
+			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("only one of user_data or user_data_file can be set"))
+		} else if data, err := os.ReadFile(c.UserDataFile); err != nil {
+			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("reading user_data_file: %s", err))
+		} else {
+			c.UserData = string(data)
+		}
+	}
+
+	if c.BuilderSource.URL != "" && c.BuilderSource.LocalPath != "" {
+		errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("builder_source: only one of url or local_path can be set"))
+	}
+	if checksumType, _, ok := strings.Cut(c.BuilderSource.Checksum, ":"); ok {
+		switch strings.ToLower(checksumType) {
+		case "md5", "sha1", "sha256", "sha512", "file":
+		default:
+			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("builder_source checksum: unsupported checksum type %q", checksumType))
+		}
+	}
+	if c.BuilderSource.ImageType == "" {
+		c.BuilderSource.ImageType = ImageTypeRawQcow2
+	}
+	switch c.BuilderSource.ImageType {
+	case ImageTypeRawQcow2:
+	case ImageTypeISO:
+		if c.BuilderSource.clonesVolume() {
+			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("builder_source: image_type %q cannot be combined with volume or vm", ImageTypeISO))
+		}
+	default:
+		errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("builder_source image_type must be %q or %q", ImageTypeRawQcow2, ImageTypeISO))
+	}
+	if c.BuilderSource.Volume != "" && c.BuilderSource.VM != "" {
+		errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("builder_source: only one of volume or vm can be set"))
+	}
+	if c.BuilderSource.clonesVolume() {
+		if c.BuilderSource.Name != "" || c.BuilderSource.URL != "" || c.BuilderSource.LocalPath != "" || !c.BuilderSource.Filter.Empty() {
+			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("builder_source: name, url, local_path and filter cannot be combined with volume or vm"))
+		}
+	} else if !c.BuilderSource.Filter.Empty() {
+		if c.BuilderSource.Name != "" || c.BuilderSource.URL != "" || c.BuilderSource.LocalPath != "" {
+			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("builder_source: name, url and local_path cannot be combined with filter"))
+		}
+		if c.BuilderSource.Filter.DisplayName != "" {
+			if _, err := regexp.Compile(c.BuilderSource.Filter.DisplayName); err != nil {
+				errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("builder_source filter display_name: %v", err))
+			}
+		}
+	} else if c.BuilderSource.Name == "" {
+		errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("builder_source: one of name, filter, volume or vm must be set"))
+	} else if len(c.BuilderSource.Name) > 253 || !objectNameRegexp.MatchString(c.BuilderSource.Name) {
+		errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("builder_source name %q is not a valid object name, use lowercase letters, digits, '-' and '.' and set display_name for the name shown in the UI", c.BuilderSource.Name))
+	}
+	if c.BuilderSource.LocalPath != "" {
+		if info, err := os.Stat(c.BuilderSource.LocalPath); err != nil {
+			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("builder_source local_path: %v", err))
+		} else if info.IsDir() {
+			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("builder_source local_path: %s is a directory", c.BuilderSource.LocalPath))
+		}
+	}
+
+	if len(c.BuilderConfiguration.NetworkInterfaces) == 0 {
+		if c.BuilderConfiguration.Network != "" {
+			c.BuilderConfiguration.NetworkInterfaces = []NetworkInterface{
+				{
+					Type:    InterfaceTypeBridge,
+					Network: fmt.Sprintf("%s/%s", c.BuilderConfiguration.NetworkNamespace, c.BuilderConfiguration.Network),
+				},
+			}
+		} else {
+			c.BuilderConfiguration.NetworkInterfaces = []NetworkInterface{
+				{
+					Type: InterfaceTypeMasquerade,
+				},
+			}
+		}
+	}
+
+	names := map[string]bool{}
+	communicators := 0
+	masquerades := 0
+	for i := range c.BuilderConfiguration.NetworkInterfaces {
+		nic := &c.BuilderConfiguration.NetworkInterfaces[i]
+		if nic.Name == "" {
+			nic.Name = fmt.Sprintf("nic-%d", i+1)
+		}
+		if names[nic.Name] {
+			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("network_interface[%d]: name %q is already in use", i, nic.Name))
+		}
+		names[nic.Name] = true
+		if nic.Type == "" {
+			nic.Type = InterfaceTypeBridge
+		}
+		switch nic.Type {
+		case InterfaceTypeBridge:
+			if nic.Network == "" {
+				errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("network_interface[%d]: network must be set for bridge interfaces", i))
+			} else if !strings.Contains(nic.Network, "/") {
+				nic.Network = fmt.Sprintf("%s/%s", c.BuilderConfiguration.NetworkNamespace, nic.Network)
+			}
+		case InterfaceTypeMasquerade:
+			masquerades++
+			if nic.Network != "" {
+				errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("network_interface[%d]: network must not be set for masquerade interfaces, they use the pod network", i))
+			}
+		default:
+			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("network_interface[%d]: type must be one of %q or %q", i, InterfaceTypeBridge, InterfaceTypeMasquerade))
+		}
+		if nic.Model == "" {
+			nic.Model = NICModelVirtio
+			if windows {
+				nic.Model = NICModelE1000
+			}
+		}
+		if nic.Communicator {
+			communicators++
+		}
+	}
+	if masquerades > 1 {
+		errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("only one masquerade network_interface is allowed"))
+	}
+	if communicators > 1 {
+		errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("only one network_interface can set communicator = true"))
+	}
+	if communicators == 0 {
+		c.BuilderConfiguration.NetworkInterfaces[0].Communicator = true
+	}
+
+	for _, mode := range c.BuilderTarget.AccessModes {
+		switch mode {
+		case AccessModeReadWriteOnce, AccessModeReadOnlyMany, AccessModeReadWriteMany, AccessModeReadWriteOncePod:
+		default:
+			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("builder_target access_modes: unknown access mode %q", mode))
+		}
+	}
+
+	if c.BuilderTarget.VolumeMode != "" && c.BuilderTarget.VolumeMode != VolumeModeBlock && c.BuilderTarget.VolumeMode != VolumeModeFilesystem {
+		errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("builder_target volume_mode must be %q or %q", VolumeModeBlock, VolumeModeFilesystem))
+	}
+
+	if !validDiskBus(c.BuilderConfiguration.RootDiskBus) {
+		errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("root_disk_bus must be one of %q, %q or %q", DiskBusVirtio, DiskBusSata, DiskBusScsi))
+	}
+
+	diskNames := map[string]bool{"rootdisk": true, "cloudinitdisk": true, "cdrom": true, "cd": true, virtioDriversDiskName: true}
+	bootOrders := map[int32]string{rootDiskBootOrder: "the root disk"}
+	if c.BuilderSource.ImageType == ImageTypeISO {
+		bootOrders[isoBootOrder] = "the installer ISO"
+	}
+	for i := range c.BuilderConfiguration.Disks {
+		disk := &c.BuilderConfiguration.Disks[i]
+		if disk.Name == "" {
+			disk.Name = fmt.Sprintf("disk-%d", i+1)
+		}
+		if diskNames[disk.Name] {
+			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("disk[%d]: name %q is already in use", i, disk.Name))
+		}
+		diskNames[disk.Name] = true
+		if disk.Size == "" {
+			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("disk[%d]: size must be set", i))
+		}
+		if disk.Bus == "" {
+			disk.Bus = DiskBusVirtio
+			if windows {
+				disk.Bus = DiskBusSata
+			}
+		}
+		if !validDiskBus(disk.Bus) {
+			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("disk[%d]: bus must be one of %q, %q or %q", i, DiskBusVirtio, DiskBusSata, DiskBusScsi))
+		}
+		if disk.StorageClass == "" {
+			disk.StorageClass = StorageClassName
+		}
+		if disk.VolumeMode == "" {
+			disk.VolumeMode = VolumeModeBlock
+		}
+		if disk.VolumeMode != VolumeModeBlock && disk.VolumeMode != VolumeModeFilesystem {
+			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("disk[%d]: volume_mode must be %q or %q", i, VolumeModeBlock, VolumeModeFilesystem))
+		}
+		if disk.BootOrder < 0 {
+			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("disk[%d]: boot_order must not be negative", i))
+		}
+		if disk.BootOrder > 0 {
+			if owner, ok := bootOrders[disk.BootOrder]; ok {
+				errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("disk[%d]: boot_order %d is already used by %s", i, disk.BootOrder, owner))
+			}
+			bootOrders[disk.BootOrder] = fmt.Sprintf("disk %q", disk.Name)
+		}
+	}
+
+	if c.BuilderConfiguration.VirtioDriversImage != "" || c.BuilderConfiguration.VirtioDriversContainerDisk != "" {
+		c.BuilderConfiguration.VirtioDrivers = true
+	}
+	if c.BuilderConfiguration.VirtioDriversImage != "" && c.BuilderConfiguration.VirtioDriversContainerDisk != "" {
+		errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("only one of virtio_drivers_image or virtio_drivers_container_disk can be set"))
+	}
+	if c.BuilderConfiguration.VirtioDrivers && c.BuilderConfiguration.VirtioDriversImage == "" && c.BuilderConfiguration.VirtioDriversContainerDisk == "" {
+		c.BuilderConfiguration.VirtioDriversContainerDisk = VirtioDriversContainerDisk
+	}
+
+	if c.BuilderConfiguration.DefaultAffinity == config.TriUnset {
+		c.BuilderConfiguration.DefaultAffinity = config.TrileanFromBool(len(c.BuilderConfiguration.AffinityRules) == 0)
+	}
+
+	for i := range c.BuilderConfiguration.AffinityRules {
+		rule := &c.BuilderConfiguration.AffinityRules[i]
+		switch rule.Type {
+		case AffinityTypeNode, AffinityTypePod, AffinityTypePodAnti:
+		default:
+			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("affinity_rules[%d]: type must be one of %q, %q or %q", i, AffinityTypeNode, AffinityTypePod, AffinityTypePodAnti))
+		}
+		if rule.Key == "" {
+			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("affinity_rules[%d]: key must be set", i))
+		}
+		if rule.Operator == "" {
+			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("affinity_rules[%d]: operator must be set", i))
+		}
+		if rule.Weight == 0 {
+			rule.Weight = 100
+		}
+		if rule.TopologyKey == "" {
+			rule.TopologyKey = "kubernetes.io/hostname"
+		}
+	}
+
+	for i := range c.BuilderConfiguration.Tolerations {
+		toleration := &c.BuilderConfiguration.Tolerations[i]
+		if toleration.Operator == "" {
+			toleration.Operator = "Equal"
+		}
+		if toleration.Operator == "Exists" && toleration.Value != "" {
+			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("tolerations[%d]: value must be empty when operator is \"Exists\"", i))
+		}
+	}
+
+	for _, err := range validateUserLabels("builder_configuration", c.BuilderConfiguration.Tags, c.BuilderConfiguration.Labels, c.BuilderConfiguration.Annotations) {
+		errs = packersdk.MultiErrorAppend(errs, err)
+	}
+	for _, err := range validateUserLabels("builder_target", c.BuilderTarget.Tags, c.BuilderTarget.Labels, c.BuilderTarget.Annotations) {
+		errs = packersdk.MultiErrorAppend(errs, err)
+	}
+
+	if errs != nil && len(errs.Errors) > 0 {
+		return nil, errs
+	}
+
 	// Return the placeholder for the generated data that will become available to provisioners and post-processors.
 	// If the builder doesn't generate any data, just return an empty slice of string: []string{}
 	// buildGeneratedData := []string{"GeneratedMockData"}
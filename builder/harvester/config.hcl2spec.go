@@ -7,13 +7,65 @@ import (
 	"github.com/zclconf/go-cty/cty"
 )
 
+// FlatAffinityRule is an auto-generated flat version of AffinityRule.
+// Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
+type FlatAffinityRule struct {
+	Type        *string  `mapstructure:"type" cty:"type" hcl:"type"`
+	Required    *bool    `mapstructure:"required" required:"false" cty:"required" hcl:"required"`
+	Weight      *int32   `mapstructure:"weight" required:"false" cty:"weight" hcl:"weight"`
+	Key         *string  `mapstructure:"key" cty:"key" hcl:"key"`
+	Operator    *string  `mapstructure:"operator" cty:"operator" hcl:"operator"`
+	Values      []string `mapstructure:"values" required:"false" cty:"values" hcl:"values"`
+	TopologyKey *string  `mapstructure:"topology_key" required:"false" cty:"topology_key" hcl:"topology_key"`
+}
+
+// FlatMapstructure returns a new FlatAffinityRule.
+// FlatAffinityRule is an auto-generated flat version of AffinityRule.
+// Where the contents a fields with a `mapstructure:,squash` tag are bubbled up.
+func (*AffinityRule) FlatMapstructure() interface{ HCL2Spec() map[string]hcldec.Spec } {
+	return new(FlatAffinityRule)
+}
+
+// HCL2Spec returns the hcl spec of a AffinityRule.
+// This spec is used by HCL to read the fields of AffinityRule.
+// The decoded values from this spec will then be applied to a FlatAffinityRule.
+func (*FlatAffinityRule) HCL2Spec() map[string]hcldec.Spec {
+	s := map[string]hcldec.Spec{
+		"type":         &hcldec.AttrSpec{Name: "type", Type: cty.String, Required: false},
+		"required":     &hcldec.AttrSpec{Name: "required", Type: cty.Bool, Required: false},
+		"weight":       &hcldec.AttrSpec{Name: "weight", Type: cty.Number, Required: false},
+		"key":          &hcldec.AttrSpec{Name: "key", Type: cty.String, Required: false},
+		"operator":     &hcldec.AttrSpec{Name: "operator", Type: cty.String, Required: false},
+		"values":       &hcldec.AttrSpec{Name: "values", Type: cty.List(cty.String), Required: false},
+		"topology_key": &hcldec.AttrSpec{Name: "topology_key", Type: cty.String, Required: false},
+	}
+	return s
+}
+
 // FlatBuilderConfiguration is an auto-generated flat version of BuilderConfiguration.
 // Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
 type FlatBuilderConfiguration struct {
-	Namespace  *string `mapstructure:"namespace" required:"false" cty:"namespace" hcl:"namespace"`
-	NamePrefix *string `mapstructure:"name_prefix" required:"false" cty:"name_prefix" hcl:"name_prefix"`
-	CPU        *int64  `mapstructure:"cpu" required:"false" cty:"cpu" hcl:"cpu"`
-	Memory     *string `mapstructure:"memory" required:"false" cty:"memory" hcl:"memory"`
+	Namespace                  *string                `mapstructure:"namespace" required:"false" cty:"namespace" hcl:"namespace"`
+	NamePrefix                 *string                `mapstructure:"name_prefix" required:"false" cty:"name_prefix" hcl:"name_prefix"`
+	CPU                        *int64                 `mapstructure:"cpu" required:"false" cty:"cpu" hcl:"cpu"`
+	Memory                     *string                `mapstructure:"memory" required:"false" cty:"memory" hcl:"memory"`
+	NetworkNamespace           *string                `mapstructure:"network_namespace" cty:"network_namespace" hcl:"network_namespace"`
+	Network                    *string                `mapstructure:"network" cty:"network" hcl:"network"`
+	NetworkInterfaces          []FlatNetworkInterface `mapstructure:"network_interface" required:"false" cty:"network_interface" hcl:"network_interface"`
+	OSFamily                   *string                `mapstructure:"os_family" required:"false" cty:"os_family" hcl:"os_family"`
+	RootDiskBus                *string                `mapstructure:"root_disk_bus" required:"false" cty:"root_disk_bus" hcl:"root_disk_bus"`
+	VirtioDrivers              *bool                  `mapstructure:"virtio_drivers" required:"false" cty:"virtio_drivers" hcl:"virtio_drivers"`
+	VirtioDriversImage         *string                `mapstructure:"virtio_drivers_image" required:"false" cty:"virtio_drivers_image" hcl:"virtio_drivers_image"`
+	VirtioDriversContainerDisk *string                `mapstructure:"virtio_drivers_container_disk" required:"false" cty:"virtio_drivers_container_disk" hcl:"virtio_drivers_container_disk"`
+	Disks                      []FlatDisk             `mapstructure:"disk" required:"false" cty:"disk" hcl:"disk"`
+	NodeSelector               map[string]string      `mapstructure:"node_selector" required:"false" cty:"node_selector" hcl:"node_selector"`
+	AffinityRules              []FlatAffinityRule     `mapstructure:"affinity_rules" required:"false" cty:"affinity_rules" hcl:"affinity_rules"`
+	DefaultAffinity            *bool                  `mapstructure:"default_affinity" required:"false" cty:"default_affinity" hcl:"default_affinity"`
+	Tolerations                []FlatToleration       `mapstructure:"tolerations" required:"false" cty:"tolerations" hcl:"tolerations"`
+	PriorityClassName          *string                `mapstructure:"priority_class_name" required:"false" cty:"priority_class_name" hcl:"priority_class_name"`
+	Tags                       map[string]string      `mapstructure:"tags" required:"false" cty:"tags" hcl:"tags"`
+	Labels                     map[string]string      `mapstructure:"labels" required:"false" cty:"labels" hcl:"labels"`
+	Annotations                map[string]string      `mapstructure:"annotations" required:"false" cty:"annotations" hcl:"annotations"`
 }
 
 // FlatMapstructure returns a new FlatBuilderConfiguration.
@@ -28,10 +80,27 @@ func (*BuilderConfiguration) FlatMapstructure() interface{ HCL2Spec() map[string
 // The decoded values from this spec will then be applied to a FlatBuilderConfiguration.
 func (*FlatBuilderConfiguration) HCL2Spec() map[string]hcldec.Spec {
 	s := map[string]hcldec.Spec{
-		"namespace":   &hcldec.AttrSpec{Name: "namespace", Type: cty.String, Required: false},
-		"name_prefix": &hcldec.AttrSpec{Name: "name_prefix", Type: cty.String, Required: false},
-		"cpu":         &hcldec.AttrSpec{Name: "cpu", Type: cty.Number, Required: false},
-		"memory":      &hcldec.AttrSpec{Name: "memory", Type: cty.String, Required: false},
+		"namespace":                     &hcldec.AttrSpec{Name: "namespace", Type: cty.String, Required: false},
+		"name_prefix":                   &hcldec.AttrSpec{Name: "name_prefix", Type: cty.String, Required: false},
+		"cpu":                           &hcldec.AttrSpec{Name: "cpu", Type: cty.Number, Required: false},
+		"memory":                        &hcldec.AttrSpec{Name: "memory", Type: cty.String, Required: false},
+		"network_namespace":             &hcldec.AttrSpec{Name: "network_namespace", Type: cty.String, Required: false},
+		"network":                       &hcldec.AttrSpec{Name: "network", Type: cty.String, Required: false},
+		"network_interface":             &hcldec.BlockListSpec{TypeName: "network_interface", Nested: hcldec.ObjectSpec((*FlatNetworkInterface)(nil).HCL2Spec())},
+		"os_family":                     &hcldec.AttrSpec{Name: "os_family", Type: cty.String, Required: false},
+		"root_disk_bus":                 &hcldec.AttrSpec{Name: "root_disk_bus", Type: cty.String, Required: false},
+		"virtio_drivers":                &hcldec.AttrSpec{Name: "virtio_drivers", Type: cty.Bool, Required: false},
+		"virtio_drivers_image":          &hcldec.AttrSpec{Name: "virtio_drivers_image", Type: cty.String, Required: false},
+		"virtio_drivers_container_disk": &hcldec.AttrSpec{Name: "virtio_drivers_container_disk", Type: cty.String, Required: false},
+		"disk":                          &hcldec.BlockListSpec{TypeName: "disk", Nested: hcldec.ObjectSpec((*FlatDisk)(nil).HCL2Spec())},
+		"node_selector":                 &hcldec.AttrSpec{Name: "node_selector", Type: cty.Map(cty.String), Required: false},
+		"affinity_rules":                &hcldec.BlockListSpec{TypeName: "affinity_rules", Nested: hcldec.ObjectSpec((*FlatAffinityRule)(nil).HCL2Spec())},
+		"default_affinity":              &hcldec.AttrSpec{Name: "default_affinity", Type: cty.Bool, Required: false},
+		"tolerations":                   &hcldec.BlockListSpec{TypeName: "tolerations", Nested: hcldec.ObjectSpec((*FlatToleration)(nil).HCL2Spec())},
+		"priority_class_name":           &hcldec.AttrSpec{Name: "priority_class_name", Type: cty.String, Required: false},
+		"tags":                          &hcldec.AttrSpec{Name: "tags", Type: cty.Map(cty.String), Required: false},
+		"labels":                        &hcldec.AttrSpec{Name: "labels", Type: cty.Map(cty.String), Required: false},
+		"annotations":                   &hcldec.AttrSpec{Name: "annotations", Type: cty.Map(cty.String), Required: false},
 	}
 	return s
 }
@@ -39,13 +108,17 @@ func (*FlatBuilderConfiguration) HCL2Spec() map[string]hcldec.Spec {
 // FlatBuilderSource is an auto-generated flat version of BuilderSource.
 // Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
 type FlatBuilderSource struct {
-	Name        *string `mapstructure:"name" cty:"name" hcl:"name"`
-	OSType      *string `mapstructure:"os_type" cty:"os_type" hcl:"os_type"`
-	ImageType   *string `mapstructure:"image_type" cty:"image_type" hcl:"image_type"`
-	URL         *string `mapstructure:"url" required:"false" cty:"url" hcl:"url"`
-	DisplayName *string `mapstructure:"display_name" required:"false" cty:"display_name" hcl:"display_name"`
-	Checksum    *string `mapstructure:"checksum" required:"false" cty:"checksum" hcl:"checksum"`
-	Cleanup     *bool   `mapstructure:"cleanup" required:"false" cty:"cleanup" hcl:"cleanup"`
+	Name        *string          `mapstructure:"name" cty:"name" hcl:"name"`
+	OSType      *string          `mapstructure:"os_type" cty:"os_type" hcl:"os_type"`
+	ImageType   *string          `mapstructure:"image_type" cty:"image_type" hcl:"image_type"`
+	URL         *string          `mapstructure:"url" required:"false" cty:"url" hcl:"url"`
+	DisplayName *string          `mapstructure:"display_name" required:"false" cty:"display_name" hcl:"display_name"`
+	Checksum    *string          `mapstructure:"checksum" required:"false" cty:"checksum" hcl:"checksum"`
+	Cleanup     *bool            `mapstructure:"cleanup" required:"false" cty:"cleanup" hcl:"cleanup"`
+	LocalPath   *string          `mapstructure:"local_path" required:"false" cty:"local_path" hcl:"local_path"`
+	Volume      *string          `mapstructure:"volume" required:"false" cty:"volume" hcl:"volume"`
+	VM          *string          `mapstructure:"vm" required:"false" cty:"vm" hcl:"vm"`
+	Filter      *FlatImageFilter `mapstructure:"filter" required:"false" cty:"filter" hcl:"filter"`
 }
 
 // FlatMapstructure returns a new FlatBuilderSource.
@@ -67,6 +140,10 @@ func (*FlatBuilderSource) HCL2Spec() map[string]hcldec.Spec {
 		"display_name": &hcldec.AttrSpec{Name: "display_name", Type: cty.String, Required: false},
 		"checksum":     &hcldec.AttrSpec{Name: "checksum", Type: cty.String, Required: false},
 		"cleanup":      &hcldec.AttrSpec{Name: "cleanup", Type: cty.Bool, Required: false},
+		"local_path":   &hcldec.AttrSpec{Name: "local_path", Type: cty.String, Required: false},
+		"volume":       &hcldec.AttrSpec{Name: "volume", Type: cty.String, Required: false},
+		"vm":           &hcldec.AttrSpec{Name: "vm", Type: cty.String, Required: false},
+		"filter":       &hcldec.BlockSpec{TypeName: "filter", Nested: hcldec.ObjectSpec((*FlatImageFilter)(nil).HCL2Spec())},
 	}
 	return s
 }
@@ -74,9 +151,15 @@ func (*FlatBuilderSource) HCL2Spec() map[string]hcldec.Spec {
 // FlatBuilderTarget is an auto-generated flat version of BuilderTarget.
 // Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
 type FlatBuilderTarget struct {
-	Namespace   *string `mapstructure:"namespace" required:"false" cty:"namespace" hcl:"namespace"`
-	DisplayName *string `mapstructure:"display_name" required:"false" cty:"display_name" hcl:"display_name"`
-	VolumeSize  *string `mapstructure:"volume_size" required:"false" cty:"volume_size" hcl:"volume_size"`
+	Namespace    *string           `mapstructure:"namespace" required:"false" cty:"namespace" hcl:"namespace"`
+	DisplayName  *string           `mapstructure:"display_name" required:"false" cty:"display_name" hcl:"display_name"`
+	VolumeSize   *string           `mapstructure:"volume_size" required:"false" cty:"volume_size" hcl:"volume_size"`
+	StorageClass *string           `mapstructure:"storage_class" required:"false" cty:"storage_class" hcl:"storage_class"`
+	AccessModes  []string          `mapstructure:"access_modes" required:"false" cty:"access_modes" hcl:"access_modes"`
+	VolumeMode   *string           `mapstructure:"volume_mode" required:"false" cty:"volume_mode" hcl:"volume_mode"`
+	Tags         map[string]string `mapstructure:"tags" required:"false" cty:"tags" hcl:"tags"`
+	Labels       map[string]string `mapstructure:"labels" required:"false" cty:"labels" hcl:"labels"`
+	Annotations  map[string]string `mapstructure:"annotations" required:"false" cty:"annotations" hcl:"annotations"`
 }
 
 // FlatMapstructure returns a new FlatBuilderTarget.
@@ -91,9 +174,15 @@ func (*BuilderTarget) FlatMapstructure() interface{ HCL2Spec() map[string]hcldec
 // The decoded values from this spec will then be applied to a FlatBuilderTarget.
 func (*FlatBuilderTarget) HCL2Spec() map[string]hcldec.Spec {
 	s := map[string]hcldec.Spec{
-		"namespace":    &hcldec.AttrSpec{Name: "namespace", Type: cty.String, Required: false},
-		"display_name": &hcldec.AttrSpec{Name: "display_name", Type: cty.String, Required: false},
-		"volume_size":  &hcldec.AttrSpec{Name: "volume_size", Type: cty.String, Required: false},
+		"namespace":     &hcldec.AttrSpec{Name: "namespace", Type: cty.String, Required: false},
+		"display_name":  &hcldec.AttrSpec{Name: "display_name", Type: cty.String, Required: false},
+		"volume_size":   &hcldec.AttrSpec{Name: "volume_size", Type: cty.String, Required: false},
+		"storage_class": &hcldec.AttrSpec{Name: "storage_class", Type: cty.String, Required: false},
+		"access_modes":  &hcldec.AttrSpec{Name: "access_modes", Type: cty.List(cty.String), Required: false},
+		"volume_mode":   &hcldec.AttrSpec{Name: "volume_mode", Type: cty.String, Required: false},
+		"tags":          &hcldec.AttrSpec{Name: "tags", Type: cty.Map(cty.String), Required: false},
+		"labels":        &hcldec.AttrSpec{Name: "labels", Type: cty.Map(cty.String), Required: false},
+		"annotations":   &hcldec.AttrSpec{Name: "annotations", Type: cty.Map(cty.String), Required: false},
 	}
 	return s
 }
@@ -101,20 +190,99 @@ func (*FlatBuilderTarget) HCL2Spec() map[string]hcldec.Spec {
 // FlatConfig is an auto-generated flat version of Config.
 // Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
 type FlatConfig struct {
-	PackerBuildName      *string                   `mapstructure:"packer_build_name" cty:"packer_build_name" hcl:"packer_build_name"`
-	PackerBuilderType    *string                   `mapstructure:"packer_builder_type" cty:"packer_builder_type" hcl:"packer_builder_type"`
-	PackerCoreVersion    *string                   `mapstructure:"packer_core_version" cty:"packer_core_version" hcl:"packer_core_version"`
-	PackerDebug          *bool                     `mapstructure:"packer_debug" cty:"packer_debug" hcl:"packer_debug"`
-	PackerForce          *bool                     `mapstructure:"packer_force" cty:"packer_force" hcl:"packer_force"`
-	PackerOnError        *string                   `mapstructure:"packer_on_error" cty:"packer_on_error" hcl:"packer_on_error"`
-	PackerUserVars       map[string]string         `mapstructure:"packer_user_variables" cty:"packer_user_variables" hcl:"packer_user_variables"`
-	PackerSensitiveVars  []string                  `mapstructure:"packer_sensitive_variables" cty:"packer_sensitive_variables" hcl:"packer_sensitive_variables"`
-	HarvesterURL         *string                   `mapstructure:"harvester_url" cty:"harvester_url" hcl:"harvester_url"`
-	HarvesterToken       *string                   `mapstructure:"harvester_token" cty:"harvester_token" hcl:"harvester_token"`
-	HarvesterNamespace   *string                   `mapstructure:"harvester_namespace" cty:"harvester_namespace" hcl:"harvester_namespace"`
-	BuilderSource        *FlatBuilderSource        `mapstructure:"builder_source" cty:"builder_source" hcl:"builder_source"`
-	BuilderConfiguration *FlatBuilderConfiguration `mapstructure:"builder_configuration" cty:"builder_configuration" hcl:"builder_configuration"`
-	BuilderTarget        *FlatBuilderTarget        `mapstructure:"builder_target" cty:"builder_target" hcl:"builder_target"`
+	PackerBuildName           *string                   `mapstructure:"packer_build_name" cty:"packer_build_name" hcl:"packer_build_name"`
+	PackerBuilderType         *string                   `mapstructure:"packer_builder_type" cty:"packer_builder_type" hcl:"packer_builder_type"`
+	PackerCoreVersion         *string                   `mapstructure:"packer_core_version" cty:"packer_core_version" hcl:"packer_core_version"`
+	PackerDebug               *bool                     `mapstructure:"packer_debug" cty:"packer_debug" hcl:"packer_debug"`
+	PackerForce               *bool                     `mapstructure:"packer_force" cty:"packer_force" hcl:"packer_force"`
+	PackerOnError             *string                   `mapstructure:"packer_on_error" cty:"packer_on_error" hcl:"packer_on_error"`
+	PackerUserVars            map[string]string         `mapstructure:"packer_user_variables" cty:"packer_user_variables" hcl:"packer_user_variables"`
+	PackerSensitiveVars       []string                  `mapstructure:"packer_sensitive_variables" cty:"packer_sensitive_variables" hcl:"packer_sensitive_variables"`
+	HarvesterURL              *string                   `mapstructure:"harvester_url" cty:"harvester_url" hcl:"harvester_url"`
+	HarvesterToken            *string                   `mapstructure:"harvester_token" cty:"harvester_token" hcl:"harvester_token"`
+	HarvesterNamespace        *string                   `mapstructure:"harvester_namespace" cty:"harvester_namespace" hcl:"harvester_namespace"`
+	BuilderSource             *FlatBuilderSource        `mapstructure:"builder_source" cty:"builder_source" hcl:"builder_source"`
+	BuilderConfiguration      *FlatBuilderConfiguration `mapstructure:"builder_configuration" cty:"builder_configuration" hcl:"builder_configuration"`
+	BuilderTarget             *FlatBuilderTarget        `mapstructure:"builder_target" cty:"builder_target" hcl:"builder_target"`
+	Type                      *string                   `mapstructure:"communicator" cty:"communicator" hcl:"communicator"`
+	PauseBeforeConnect        *string                   `mapstructure:"pause_before_connecting" cty:"pause_before_connecting" hcl:"pause_before_connecting"`
+	SSHHost                   *string                   `mapstructure:"ssh_host" cty:"ssh_host" hcl:"ssh_host"`
+	SSHPort                   *int                      `mapstructure:"ssh_port" cty:"ssh_port" hcl:"ssh_port"`
+	SSHUsername               *string                   `mapstructure:"ssh_username" cty:"ssh_username" hcl:"ssh_username"`
+	SSHPassword               *string                   `mapstructure:"ssh_password" cty:"ssh_password" hcl:"ssh_password"`
+	SSHKeyPairName            *string                   `mapstructure:"ssh_keypair_name" undocumented:"true" cty:"ssh_keypair_name" hcl:"ssh_keypair_name"`
+	SSHTemporaryKeyPairName   *string                   `mapstructure:"temporary_key_pair_name" undocumented:"true" cty:"temporary_key_pair_name" hcl:"temporary_key_pair_name"`
+	SSHTemporaryKeyPairType   *string                   `mapstructure:"temporary_key_pair_type" cty:"temporary_key_pair_type" hcl:"temporary_key_pair_type"`
+	SSHTemporaryKeyPairBits   *int                      `mapstructure:"temporary_key_pair_bits" cty:"temporary_key_pair_bits" hcl:"temporary_key_pair_bits"`
+	SSHCiphers                []string                  `mapstructure:"ssh_ciphers" cty:"ssh_ciphers" hcl:"ssh_ciphers"`
+	SSHClearAuthorizedKeys    *bool                     `mapstructure:"ssh_clear_authorized_keys" cty:"ssh_clear_authorized_keys" hcl:"ssh_clear_authorized_keys"`
+	SSHKEXAlgos               []string                  `mapstructure:"ssh_key_exchange_algorithms" cty:"ssh_key_exchange_algorithms" hcl:"ssh_key_exchange_algorithms"`
+	SSHPrivateKeyFile         *string                   `mapstructure:"ssh_private_key_file" undocumented:"true" cty:"ssh_private_key_file" hcl:"ssh_private_key_file"`
+	SSHCertificateFile        *string                   `mapstructure:"ssh_certificate_file" cty:"ssh_certificate_file" hcl:"ssh_certificate_file"`
+	SSHPty                    *bool                     `mapstructure:"ssh_pty" cty:"ssh_pty" hcl:"ssh_pty"`
+	SSHTimeout                *string                   `mapstructure:"ssh_timeout" cty:"ssh_timeout" hcl:"ssh_timeout"`
+	SSHWaitTimeout            *string                   `mapstructure:"ssh_wait_timeout" undocumented:"true" cty:"ssh_wait_timeout" hcl:"ssh_wait_timeout"`
+	SSHAgentAuth              *bool                     `mapstructure:"ssh_agent_auth" undocumented:"true" cty:"ssh_agent_auth" hcl:"ssh_agent_auth"`
+	SSHDisableAgentForwarding *bool                     `mapstructure:"ssh_disable_agent_forwarding" cty:"ssh_disable_agent_forwarding" hcl:"ssh_disable_agent_forwarding"`
+	SSHHandshakeAttempts      *int                      `mapstructure:"ssh_handshake_attempts" cty:"ssh_handshake_attempts" hcl:"ssh_handshake_attempts"`
+	SSHBastionHost            *string                   `mapstructure:"ssh_bastion_host" cty:"ssh_bastion_host" hcl:"ssh_bastion_host"`
+	SSHBastionPort            *int                      `mapstructure:"ssh_bastion_port" cty:"ssh_bastion_port" hcl:"ssh_bastion_port"`
+	SSHBastionAgentAuth       *bool                     `mapstructure:"ssh_bastion_agent_auth" cty:"ssh_bastion_agent_auth" hcl:"ssh_bastion_agent_auth"`
+	SSHBastionUsername        *string                   `mapstructure:"ssh_bastion_username" cty:"ssh_bastion_username" hcl:"ssh_bastion_username"`
+	SSHBastionPassword        *string                   `mapstructure:"ssh_bastion_password" cty:"ssh_bastion_password" hcl:"ssh_bastion_password"`
+	SSHBastionInteractive     *bool                     `mapstructure:"ssh_bastion_interactive" cty:"ssh_bastion_interactive" hcl:"ssh_bastion_interactive"`
+	SSHBastionPrivateKeyFile  *string                   `mapstructure:"ssh_bastion_private_key_file" cty:"ssh_bastion_private_key_file" hcl:"ssh_bastion_private_key_file"`
+	SSHBastionCertificateFile *string                   `mapstructure:"ssh_bastion_certificate_file" cty:"ssh_bastion_certificate_file" hcl:"ssh_bastion_certificate_file"`
+	SSHFileTransferMethod     *string                   `mapstructure:"ssh_file_transfer_method" cty:"ssh_file_transfer_method" hcl:"ssh_file_transfer_method"`
+	SSHProxyHost              *string                   `mapstructure:"ssh_proxy_host" cty:"ssh_proxy_host" hcl:"ssh_proxy_host"`
+	SSHProxyPort              *int                      `mapstructure:"ssh_proxy_port" cty:"ssh_proxy_port" hcl:"ssh_proxy_port"`
+	SSHProxyUsername          *string                   `mapstructure:"ssh_proxy_username" cty:"ssh_proxy_username" hcl:"ssh_proxy_username"`
+	SSHProxyPassword          *string                   `mapstructure:"ssh_proxy_password" cty:"ssh_proxy_password" hcl:"ssh_proxy_password"`
+	SSHKeepAliveInterval      *string                   `mapstructure:"ssh_keep_alive_interval" cty:"ssh_keep_alive_interval" hcl:"ssh_keep_alive_interval"`
+	SSHReadWriteTimeout       *string                   `mapstructure:"ssh_read_write_timeout" cty:"ssh_read_write_timeout" hcl:"ssh_read_write_timeout"`
+	SSHRemoteTunnels          []string                  `mapstructure:"ssh_remote_tunnels" cty:"ssh_remote_tunnels" hcl:"ssh_remote_tunnels"`
+	SSHLocalTunnels           []string                  `mapstructure:"ssh_local_tunnels" cty:"ssh_local_tunnels" hcl:"ssh_local_tunnels"`
+	SSHPublicKey              []byte                    `mapstructure:"ssh_public_key" undocumented:"true" cty:"ssh_public_key" hcl:"ssh_public_key"`
+	SSHPrivateKey             []byte                    `mapstructure:"ssh_private_key" undocumented:"true" cty:"ssh_private_key" hcl:"ssh_private_key"`
+	WinRMUser                 *string                   `mapstructure:"winrm_username" cty:"winrm_username" hcl:"winrm_username"`
+	WinRMPassword             *string                   `mapstructure:"winrm_password" cty:"winrm_password" hcl:"winrm_password"`
+	WinRMHost                 *string                   `mapstructure:"winrm_host" cty:"winrm_host" hcl:"winrm_host"`
+	WinRMNoProxy              *bool                     `mapstructure:"winrm_no_proxy" cty:"winrm_no_proxy" hcl:"winrm_no_proxy"`
+	WinRMPort                 *int                      `mapstructure:"winrm_port" cty:"winrm_port" hcl:"winrm_port"`
+	WinRMTimeout              *string                   `mapstructure:"winrm_timeout" cty:"winrm_timeout" hcl:"winrm_timeout"`
+	WinRMUseSSL               *bool                     `mapstructure:"winrm_use_ssl" cty:"winrm_use_ssl" hcl:"winrm_use_ssl"`
+	WinRMInsecure             *bool                     `mapstructure:"winrm_insecure" cty:"winrm_insecure" hcl:"winrm_insecure"`
+	WinRMUseNTLM              *bool                     `mapstructure:"winrm_use_ntlm" cty:"winrm_use_ntlm" hcl:"winrm_use_ntlm"`
+	ShutdownCommand           *string                   `mapstructure:"shutdown_command" required:"false" cty:"shutdown_command" hcl:"shutdown_command"`
+	ShutdownTimeout           *string                   `mapstructure:"shutdown_timeout" required:"false" cty:"shutdown_timeout" hcl:"shutdown_timeout"`
+	BootGroupInterval         *string                   `mapstructure:"boot_keygroup_interval" cty:"boot_keygroup_interval" hcl:"boot_keygroup_interval"`
+	BootWait                  *string                   `mapstructure:"boot_wait" cty:"boot_wait" hcl:"boot_wait"`
+	BootCommand               []string                  `mapstructure:"boot_command" cty:"boot_command" hcl:"boot_command"`
+	DisableVNC                *bool                     `mapstructure:"disable_vnc" cty:"disable_vnc" hcl:"disable_vnc"`
+	BootKeyInterval           *string                   `mapstructure:"boot_key_interval" cty:"boot_key_interval" hcl:"boot_key_interval"`
+	HTTPDir                   *string                   `mapstructure:"http_directory" cty:"http_directory" hcl:"http_directory"`
+	HTTPContent               map[string]string         `mapstructure:"http_content" cty:"http_content" hcl:"http_content"`
+	HTTPPortMin               *int                      `mapstructure:"http_port_min" cty:"http_port_min" hcl:"http_port_min"`
+	HTTPPortMax               *int                      `mapstructure:"http_port_max" cty:"http_port_max" hcl:"http_port_max"`
+	HTTPAddress               *string                   `mapstructure:"http_bind_address" cty:"http_bind_address" hcl:"http_bind_address"`
+	HTTPInterface             *string                   `mapstructure:"http_interface" undocumented:"true" cty:"http_interface" hcl:"http_interface"`
+	HTTPNetworkProtocol       *string                   `mapstructure:"http_network_protocol" cty:"http_network_protocol" hcl:"http_network_protocol"`
+	CDFiles                   []string                  `mapstructure:"cd_files" cty:"cd_files" hcl:"cd_files"`
+	CDContent                 map[string]string         `mapstructure:"cd_content" cty:"cd_content" hcl:"cd_content"`
+	CDLabel                   *string                   `mapstructure:"cd_label" cty:"cd_label" hcl:"cd_label"`
+	HTTPIP                    *string                   `mapstructure:"http_ip" required:"false" cty:"http_ip" hcl:"http_ip"`
+	UserData                  *string                   `mapstructure:"user_data" required:"false" cty:"user_data" hcl:"user_data"`
+	UserDataFile              *string                   `mapstructure:"user_data_file" required:"false" cty:"user_data_file" hcl:"user_data_file"`
+	NetworkData               *string                   `mapstructure:"network_data" required:"false" cty:"network_data" hcl:"network_data"`
+	KeepVMOnError             *bool                     `mapstructure:"keep_vm_on_error" required:"false" cty:"keep_vm_on_error" hcl:"keep_vm_on_error"`
+	SerialConsoleLog          *bool                     `mapstructure:"serial_console_log" required:"false" cty:"serial_console_log" hcl:"serial_console_log"`
+	SerialConsoleLogPath      *string                   `mapstructure:"serial_console_log_path" required:"false" cty:"serial_console_log_path" hcl:"serial_console_log_path"`
+	ImageImportTimeout        *string                   `mapstructure:"image_import_timeout" required:"false" cty:"image_import_timeout" hcl:"image_import_timeout"`
+	VMStartTimeout            *string                   `mapstructure:"vm_start_timeout" required:"false" cty:"vm_start_timeout" hcl:"vm_start_timeout"`
+	IPWaitTimeout             *string                   `mapstructure:"ip_wait_timeout" required:"false" cty:"ip_wait_timeout" hcl:"ip_wait_timeout"`
+	IPWaitCIDR                []string                  `mapstructure:"ip_wait_cidr" required:"false" cty:"ip_wait_cidr" hcl:"ip_wait_cidr"`
+	IPFamily                  *string                   `mapstructure:"ip_family" required:"false" cty:"ip_family" hcl:"ip_family"`
+	WaitForGuestAgent         *bool                     `mapstructure:"wait_for_guest_agent" required:"false" cty:"wait_for_guest_agent" hcl:"wait_for_guest_agent"`
 }
 
 // FlatMapstructure returns a new FlatConfig.
@@ -129,20 +297,227 @@ func (*Config) FlatMapstructure() interface{ HCL2Spec() map[string]hcldec.Spec }
 // The decoded values from this spec will then be applied to a FlatConfig.
 func (*FlatConfig) HCL2Spec() map[string]hcldec.Spec {
 	s := map[string]hcldec.Spec{
-		"packer_build_name":          &hcldec.AttrSpec{Name: "packer_build_name", Type: cty.String, Required: false},
-		"packer_builder_type":        &hcldec.AttrSpec{Name: "packer_builder_type", Type: cty.String, Required: false},
-		"packer_core_version":        &hcldec.AttrSpec{Name: "packer_core_version", Type: cty.String, Required: false},
-		"packer_debug":               &hcldec.AttrSpec{Name: "packer_debug", Type: cty.Bool, Required: false},
-		"packer_force":               &hcldec.AttrSpec{Name: "packer_force", Type: cty.Bool, Required: false},
-		"packer_on_error":            &hcldec.AttrSpec{Name: "packer_on_error", Type: cty.String, Required: false},
-		"packer_user_variables":      &hcldec.AttrSpec{Name: "packer_user_variables", Type: cty.Map(cty.String), Required: false},
-		"packer_sensitive_variables": &hcldec.AttrSpec{Name: "packer_sensitive_variables", Type: cty.List(cty.String), Required: false},
-		"harvester_url":              &hcldec.AttrSpec{Name: "harvester_url", Type: cty.String, Required: false},
-		"harvester_token":            &hcldec.AttrSpec{Name: "harvester_token", Type: cty.String, Required: false},
-		"harvester_namespace":        &hcldec.AttrSpec{Name: "harvester_namespace", Type: cty.String, Required: false},
-		"builder_source":             &hcldec.BlockSpec{TypeName: "builder_source", Nested: hcldec.ObjectSpec((*FlatBuilderSource)(nil).HCL2Spec())},
-		"builder_configuration":      &hcldec.BlockSpec{TypeName: "builder_configuration", Nested: hcldec.ObjectSpec((*FlatBuilderConfiguration)(nil).HCL2Spec())},
-		"builder_target":             &hcldec.BlockSpec{TypeName: "builder_target", Nested: hcldec.ObjectSpec((*FlatBuilderTarget)(nil).HCL2Spec())},
+		"packer_build_name":            &hcldec.AttrSpec{Name: "packer_build_name", Type: cty.String, Required: false},
+		"packer_builder_type":          &hcldec.AttrSpec{Name: "packer_builder_type", Type: cty.String, Required: false},
+		"packer_core_version":          &hcldec.AttrSpec{Name: "packer_core_version", Type: cty.String, Required: false},
+		"packer_debug":                 &hcldec.AttrSpec{Name: "packer_debug", Type: cty.Bool, Required: false},
+		"packer_force":                 &hcldec.AttrSpec{Name: "packer_force", Type: cty.Bool, Required: false},
+		"packer_on_error":              &hcldec.AttrSpec{Name: "packer_on_error", Type: cty.String, Required: false},
+		"packer_user_variables":        &hcldec.AttrSpec{Name: "packer_user_variables", Type: cty.Map(cty.String), Required: false},
+		"packer_sensitive_variables":   &hcldec.AttrSpec{Name: "packer_sensitive_variables", Type: cty.List(cty.String), Required: false},
+		"harvester_url":                &hcldec.AttrSpec{Name: "harvester_url", Type: cty.String, Required: false},
+		"harvester_token":              &hcldec.AttrSpec{Name: "harvester_token", Type: cty.String, Required: false},
+		"harvester_namespace":          &hcldec.AttrSpec{Name: "harvester_namespace", Type: cty.String, Required: false},
+		"builder_source":               &hcldec.BlockSpec{TypeName: "builder_source", Nested: hcldec.ObjectSpec((*FlatBuilderSource)(nil).HCL2Spec())},
+		"builder_configuration":        &hcldec.BlockSpec{TypeName: "builder_configuration", Nested: hcldec.ObjectSpec((*FlatBuilderConfiguration)(nil).HCL2Spec())},
+		"builder_target":               &hcldec.BlockSpec{TypeName: "builder_target", Nested: hcldec.ObjectSpec((*FlatBuilderTarget)(nil).HCL2Spec())},
+		"communicator":                 &hcldec.AttrSpec{Name: "communicator", Type: cty.String, Required: false},
+		"pause_before_connecting":      &hcldec.AttrSpec{Name: "pause_before_connecting", Type: cty.String, Required: false},
+		"ssh_host":                     &hcldec.AttrSpec{Name: "ssh_host", Type: cty.String, Required: false},
+		"ssh_port":                     &hcldec.AttrSpec{Name: "ssh_port", Type: cty.Number, Required: false},
+		"ssh_username":                 &hcldec.AttrSpec{Name: "ssh_username", Type: cty.String, Required: false},
+		"ssh_password":                 &hcldec.AttrSpec{Name: "ssh_password", Type: cty.String, Required: false},
+		"ssh_keypair_name":             &hcldec.AttrSpec{Name: "ssh_keypair_name", Type: cty.String, Required: false},
+		"temporary_key_pair_name":      &hcldec.AttrSpec{Name: "temporary_key_pair_name", Type: cty.String, Required: false},
+		"temporary_key_pair_type":      &hcldec.AttrSpec{Name: "temporary_key_pair_type", Type: cty.String, Required: false},
+		"temporary_key_pair_bits":      &hcldec.AttrSpec{Name: "temporary_key_pair_bits", Type: cty.Number, Required: false},
+		"ssh_ciphers":                  &hcldec.AttrSpec{Name: "ssh_ciphers", Type: cty.List(cty.String), Required: false},
+		"ssh_clear_authorized_keys":    &hcldec.AttrSpec{Name: "ssh_clear_authorized_keys", Type: cty.Bool, Required: false},
+		"ssh_key_exchange_algorithms":  &hcldec.AttrSpec{Name: "ssh_key_exchange_algorithms", Type: cty.List(cty.String), Required: false},
+		"ssh_private_key_file":         &hcldec.AttrSpec{Name: "ssh_private_key_file", Type: cty.String, Required: false},
+		"ssh_certificate_file":         &hcldec.AttrSpec{Name: "ssh_certificate_file", Type: cty.String, Required: false},
+		"ssh_pty":                      &hcldec.AttrSpec{Name: "ssh_pty", Type: cty.Bool, Required: false},
+		"ssh_timeout":                  &hcldec.AttrSpec{Name: "ssh_timeout", Type: cty.String, Required: false},
+		"ssh_wait_timeout":             &hcldec.AttrSpec{Name: "ssh_wait_timeout", Type: cty.String, Required: false},
+		"ssh_agent_auth":               &hcldec.AttrSpec{Name: "ssh_agent_auth", Type: cty.Bool, Required: false},
+		"ssh_disable_agent_forwarding": &hcldec.AttrSpec{Name: "ssh_disable_agent_forwarding", Type: cty.Bool, Required: false},
+		"ssh_handshake_attempts":       &hcldec.AttrSpec{Name: "ssh_handshake_attempts", Type: cty.Number, Required: false},
+		"ssh_bastion_host":             &hcldec.AttrSpec{Name: "ssh_bastion_host", Type: cty.String, Required: false},
+		"ssh_bastion_port":             &hcldec.AttrSpec{Name: "ssh_bastion_port", Type: cty.Number, Required: false},
+		"ssh_bastion_agent_auth":       &hcldec.AttrSpec{Name: "ssh_bastion_agent_auth", Type: cty.Bool, Required: false},
+		"ssh_bastion_username":         &hcldec.AttrSpec{Name: "ssh_bastion_username", Type: cty.String, Required: false},
+		"ssh_bastion_password":         &hcldec.AttrSpec{Name: "ssh_bastion_password", Type: cty.String, Required: false},
+		"ssh_bastion_interactive":      &hcldec.AttrSpec{Name: "ssh_bastion_interactive", Type: cty.Bool, Required: false},
+		"ssh_bastion_private_key_file": &hcldec.AttrSpec{Name: "ssh_bastion_private_key_file", Type: cty.String, Required: false},
+		"ssh_bastion_certificate_file": &hcldec.AttrSpec{Name: "ssh_bastion_certificate_file", Type: cty.String, Required: false},
+		"ssh_file_transfer_method":     &hcldec.AttrSpec{Name: "ssh_file_transfer_method", Type: cty.String, Required: false},
+		"ssh_proxy_host":               &hcldec.AttrSpec{Name: "ssh_proxy_host", Type: cty.String, Required: false},
+		"ssh_proxy_port":               &hcldec.AttrSpec{Name: "ssh_proxy_port", Type: cty.Number, Required: false},
+		"ssh_proxy_username":           &hcldec.AttrSpec{Name: "ssh_proxy_username", Type: cty.String, Required: false},
+		"ssh_proxy_password":           &hcldec.AttrSpec{Name: "ssh_proxy_password", Type: cty.String, Required: false},
+		"ssh_keep_alive_interval":      &hcldec.AttrSpec{Name: "ssh_keep_alive_interval", Type: cty.String, Required: false},
+		"ssh_read_write_timeout":       &hcldec.AttrSpec{Name: "ssh_read_write_timeout", Type: cty.String, Required: false},
+		"ssh_remote_tunnels":           &hcldec.AttrSpec{Name: "ssh_remote_tunnels", Type: cty.List(cty.String), Required: false},
+		"ssh_local_tunnels":            &hcldec.AttrSpec{Name: "ssh_local_tunnels", Type: cty.List(cty.String), Required: false},
+		"ssh_public_key":               &hcldec.AttrSpec{Name: "ssh_public_key", Type: cty.List(cty.Number), Required: false},
+		"ssh_private_key":              &hcldec.AttrSpec{Name: "ssh_private_key", Type: cty.List(cty.Number), Required: false},
+		"winrm_username":               &hcldec.AttrSpec{Name: "winrm_username", Type: cty.String, Required: false},
+		"winrm_password":               &hcldec.AttrSpec{Name: "winrm_password", Type: cty.String, Required: false},
+		"winrm_host":                   &hcldec.AttrSpec{Name: "winrm_host", Type: cty.String, Required: false},
+		"winrm_no_proxy":               &hcldec.AttrSpec{Name: "winrm_no_proxy", Type: cty.Bool, Required: false},
+		"winrm_port":                   &hcldec.AttrSpec{Name: "winrm_port", Type: cty.Number, Required: false},
+		"winrm_timeout":                &hcldec.AttrSpec{Name: "winrm_timeout", Type: cty.String, Required: false},
+		"winrm_use_ssl":                &hcldec.AttrSpec{Name: "winrm_use_ssl", Type: cty.Bool, Required: false},
+		"winrm_insecure":               &hcldec.AttrSpec{Name: "winrm_insecure", Type: cty.Bool, Required: false},
+		"winrm_use_ntlm":               &hcldec.AttrSpec{Name: "winrm_use_ntlm", Type: cty.Bool, Required: false},
+		"shutdown_command":             &hcldec.AttrSpec{Name: "shutdown_command", Type: cty.String, Required: false},
+		"shutdown_timeout":             &hcldec.AttrSpec{Name: "shutdown_timeout", Type: cty.String, Required: false},
+		"boot_keygroup_interval":       &hcldec.AttrSpec{Name: "boot_keygroup_interval", Type: cty.String, Required: false},
+		"boot_wait":                    &hcldec.AttrSpec{Name: "boot_wait", Type: cty.String, Required: false},
+		"boot_command":                 &hcldec.AttrSpec{Name: "boot_command", Type: cty.List(cty.String), Required: false},
+		"disable_vnc":                  &hcldec.AttrSpec{Name: "disable_vnc", Type: cty.Bool, Required: false},
+		"boot_key_interval":            &hcldec.AttrSpec{Name: "boot_key_interval", Type: cty.String, Required: false},
+		"http_directory":               &hcldec.AttrSpec{Name: "http_directory", Type: cty.String, Required: false},
+		"http_content":                 &hcldec.AttrSpec{Name: "http_content", Type: cty.Map(cty.String), Required: false},
+		"http_port_min":                &hcldec.AttrSpec{Name: "http_port_min", Type: cty.Number, Required: false},
+		"http_port_max":                &hcldec.AttrSpec{Name: "http_port_max", Type: cty.Number, Required: false},
+		"http_bind_address":            &hcldec.AttrSpec{Name: "http_bind_address", Type: cty.String, Required: false},
+		"http_interface":               &hcldec.AttrSpec{Name: "http_interface", Type: cty.String, Required: false},
+		"http_network_protocol":        &hcldec.AttrSpec{Name: "http_network_protocol", Type: cty.String, Required: false},
+		"cd_files":                     &hcldec.AttrSpec{Name: "cd_files", Type: cty.List(cty.String), Required: false},
+		"cd_content":                   &hcldec.AttrSpec{Name: "cd_content", Type: cty.Map(cty.String), Required: false},
+		"cd_label":                     &hcldec.AttrSpec{Name: "cd_label", Type: cty.String, Required: false},
+		"http_ip":                      &hcldec.AttrSpec{Name: "http_ip", Type: cty.String, Required: false},
+		"user_data":                    &hcldec.AttrSpec{Name: "user_data", Type: cty.String, Required: false},
+		"user_data_file":               &hcldec.AttrSpec{Name: "user_data_file", Type: cty.String, Required: false},
+		"network_data":                 &hcldec.AttrSpec{Name: "network_data", Type: cty.String, Required: false},
+		"keep_vm_on_error":             &hcldec.AttrSpec{Name: "keep_vm_on_error", Type: cty.Bool, Required: false},
+		"serial_console_log":           &hcldec.AttrSpec{Name: "serial_console_log", Type: cty.Bool, Required: false},
+		"serial_console_log_path":      &hcldec.AttrSpec{Name: "serial_console_log_path", Type: cty.String, Required: false},
+		"image_import_timeout":         &hcldec.AttrSpec{Name: "image_import_timeout", Type: cty.String, Required: false},
+		"vm_start_timeout":             &hcldec.AttrSpec{Name: "vm_start_timeout", Type: cty.String, Required: false},
+		"ip_wait_timeout":              &hcldec.AttrSpec{Name: "ip_wait_timeout", Type: cty.String, Required: false},
+		"ip_wait_cidr":                 &hcldec.AttrSpec{Name: "ip_wait_cidr", Type: cty.List(cty.String), Required: false},
+		"ip_family":                    &hcldec.AttrSpec{Name: "ip_family", Type: cty.String, Required: false},
+		"wait_for_guest_agent":         &hcldec.AttrSpec{Name: "wait_for_guest_agent", Type: cty.Bool, Required: false},
+	}
+	return s
+}
+
+// FlatDisk is an auto-generated flat version of Disk.
+// Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
+type FlatDisk struct {
+	Name         *string `mapstructure:"name" required:"false" cty:"name" hcl:"name"`
+	Size         *string `mapstructure:"size" cty:"size" hcl:"size"`
+	Bus          *string `mapstructure:"bus" required:"false" cty:"bus" hcl:"bus"`
+	StorageClass *string `mapstructure:"storage_class" required:"false" cty:"storage_class" hcl:"storage_class"`
+	VolumeMode   *string `mapstructure:"volume_mode" required:"false" cty:"volume_mode" hcl:"volume_mode"`
+	BootOrder    *int32  `mapstructure:"boot_order" required:"false" cty:"boot_order" hcl:"boot_order"`
+	Export       *bool   `mapstructure:"export" required:"false" cty:"export" hcl:"export"`
+	DisplayName  *string `mapstructure:"display_name" required:"false" cty:"display_name" hcl:"display_name"`
+}
+
+// FlatMapstructure returns a new FlatDisk.
+// FlatDisk is an auto-generated flat version of Disk.
+// Where the contents a fields with a `mapstructure:,squash` tag are bubbled up.
+func (*Disk) FlatMapstructure() interface{ HCL2Spec() map[string]hcldec.Spec } {
+	return new(FlatDisk)
+}
+
+// HCL2Spec returns the hcl spec of a Disk.
+// This spec is used by HCL to read the fields of Disk.
+// The decoded values from this spec will then be applied to a FlatDisk.
+func (*FlatDisk) HCL2Spec() map[string]hcldec.Spec {
+	s := map[string]hcldec.Spec{
+		"name":          &hcldec.AttrSpec{Name: "name", Type: cty.String, Required: false},
+		"size":          &hcldec.AttrSpec{Name: "size", Type: cty.String, Required: false},
+		"bus":           &hcldec.AttrSpec{Name: "bus", Type: cty.String, Required: false},
+		"storage_class": &hcldec.AttrSpec{Name: "storage_class", Type: cty.String, Required: false},
+		"volume_mode":   &hcldec.AttrSpec{Name: "volume_mode", Type: cty.String, Required: false},
+		"boot_order":    &hcldec.AttrSpec{Name: "boot_order", Type: cty.Number, Required: false},
+		"export":        &hcldec.AttrSpec{Name: "export", Type: cty.Bool, Required: false},
+		"display_name":  &hcldec.AttrSpec{Name: "display_name", Type: cty.String, Required: false},
+	}
+	return s
+}
+
+// FlatImageFilter is an auto-generated flat version of ImageFilter.
+// Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
+type FlatImageFilter struct {
+	Labels      map[string]string `mapstructure:"labels" required:"false" cty:"labels" hcl:"labels"`
+	DisplayName *string           `mapstructure:"display_name" required:"false" cty:"display_name" hcl:"display_name"`
+	MostRecent  *bool             `mapstructure:"most_recent" required:"false" cty:"most_recent" hcl:"most_recent"`
+}
+
+// FlatMapstructure returns a new FlatImageFilter.
+// FlatImageFilter is an auto-generated flat version of ImageFilter.
+// Where the contents a fields with a `mapstructure:,squash` tag are bubbled up.
+func (*ImageFilter) FlatMapstructure() interface{ HCL2Spec() map[string]hcldec.Spec } {
+	return new(FlatImageFilter)
+}
+
+// HCL2Spec returns the hcl spec of a ImageFilter.
+// This spec is used by HCL to read the fields of ImageFilter.
+// The decoded values from this spec will then be applied to a FlatImageFilter.
+func (*FlatImageFilter) HCL2Spec() map[string]hcldec.Spec {
+	s := map[string]hcldec.Spec{
+		"labels":       &hcldec.AttrSpec{Name: "labels", Type: cty.Map(cty.String), Required: false},
+		"display_name": &hcldec.AttrSpec{Name: "display_name", Type: cty.String, Required: false},
+		"most_recent":  &hcldec.AttrSpec{Name: "most_recent", Type: cty.Bool, Required: false},
+	}
+	return s
+}
+
+// FlatNetworkInterface is an auto-generated flat version of NetworkInterface.
+// Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
+type FlatNetworkInterface struct {
+	Name         *string `mapstructure:"name" required:"false" cty:"name" hcl:"name"`
+	Type         *string `mapstructure:"type" required:"false" cty:"type" hcl:"type"`
+	Network      *string `mapstructure:"network" required:"false" cty:"network" hcl:"network"`
+	Model        *string `mapstructure:"model" required:"false" cty:"model" hcl:"model"`
+	MACAddress   *string `mapstructure:"mac_address" required:"false" cty:"mac_address" hcl:"mac_address"`
+	Communicator *bool   `mapstructure:"communicator" required:"false" cty:"communicator" hcl:"communicator"`
+}
+
+// FlatMapstructure returns a new FlatNetworkInterface.
+// FlatNetworkInterface is an auto-generated flat version of NetworkInterface.
+// Where the contents a fields with a `mapstructure:,squash` tag are bubbled up.
+func (*NetworkInterface) FlatMapstructure() interface{ HCL2Spec() map[string]hcldec.Spec } {
+	return new(FlatNetworkInterface)
+}
+
+// HCL2Spec returns the hcl spec of a NetworkInterface.
+// This spec is used by HCL to read the fields of NetworkInterface.
+// The decoded values from this spec will then be applied to a FlatNetworkInterface.
+func (*FlatNetworkInterface) HCL2Spec() map[string]hcldec.Spec {
+	s := map[string]hcldec.Spec{
+		"name":         &hcldec.AttrSpec{Name: "name", Type: cty.String, Required: false},
+		"type":         &hcldec.AttrSpec{Name: "type", Type: cty.String, Required: false},
+		"network":      &hcldec.AttrSpec{Name: "network", Type: cty.String, Required: false},
+		"model":        &hcldec.AttrSpec{Name: "model", Type: cty.String, Required: false},
+		"mac_address":  &hcldec.AttrSpec{Name: "mac_address", Type: cty.String, Required: false},
+		"communicator": &hcldec.AttrSpec{Name: "communicator", Type: cty.Bool, Required: false},
+	}
+	return s
+}
+
+// FlatToleration is an auto-generated flat version of Toleration.
+// Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
+type FlatToleration struct {
+	Key               *string `mapstructure:"key" required:"false" cty:"key" hcl:"key"`
+	Operator          *string `mapstructure:"operator" required:"false" cty:"operator" hcl:"operator"`
+	Value             *string `mapstructure:"value" required:"false" cty:"value" hcl:"value"`
+	Effect            *string `mapstructure:"effect" required:"false" cty:"effect" hcl:"effect"`
+	TolerationSeconds *int64  `mapstructure:"toleration_seconds" required:"false" cty:"toleration_seconds" hcl:"toleration_seconds"`
+}
+
+// FlatMapstructure returns a new FlatToleration.
+// FlatToleration is an auto-generated flat version of Toleration.
+// Where the contents a fields with a `mapstructure:,squash` tag are bubbled up.
+func (*Toleration) FlatMapstructure() interface{ HCL2Spec() map[string]hcldec.Spec } {
+	return new(FlatToleration)
+}
+
+// HCL2Spec returns the hcl spec of a Toleration.
+// This spec is used by HCL to read the fields of Toleration.
+// The decoded values from this spec will then be applied to a FlatToleration.
+func (*FlatToleration) HCL2Spec() map[string]hcldec.Spec {
+	s := map[string]hcldec.Spec{
+		"key":                &hcldec.AttrSpec{Name: "key", Type: cty.String, Required: false},
+		"operator":           &hcldec.AttrSpec{Name: "operator", Type: cty.String, Required: false},
+		"value":              &hcldec.AttrSpec{Name: "value", Type: cty.String, Required: false},
+		"effect":             &hcldec.AttrSpec{Name: "effect", Type: cty.String, Required: false},
+		"toleration_seconds": &hcldec.AttrSpec{Name: "toleration_seconds", Type: cty.Number, Required: false},
 	}
 	return s
 }
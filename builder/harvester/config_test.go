@@ -0,0 +1,166 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package harvester
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// testConfigRaw returns the minimal settings of a build of the image focal,
+// with the settings of extra applied.
+func testConfigRaw(extra map[string]interface{}) map[string]interface{} {
+	raw := map[string]interface{}{
+		"harvester_url":       "https://harvester.example.com",
+		"harvester_token":     "token",
+		"harvester_namespace": "default",
+		"builder_source":      map[string]interface{}{"name": "focal", "url": fakeImageURL},
+		"communicator":        "none",
+	}
+	for k, v := range extra {
+		raw[k] = v
+	}
+	return raw
+}
+
+func TestConfigSetBuildID(t *testing.T) {
+	c := &Config{}
+	_, err := c.Prepare(testConfigRaw(map[string]interface{}{
+		"builder_configuration": map[string]interface{}{
+			"disk": []map[string]interface{}{
+				{"name": "data", "size": "10Gi", "export": true},
+				{"name": "logs", "size": "1Gi", "export": true, "display_name": "focal-logs"},
+			},
+		},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.BuilderTarget.DisplayName != "" {
+		t.Fatalf("display name %q set before the build", c.BuilderTarget.DisplayName)
+	}
+
+	c.setBuildID("build-1")
+	if c.buildID != "build-1" {
+		t.Errorf("build ID is %q", c.buildID)
+	}
+	if got := c.BuilderTarget.DisplayName; got != "packer-build-1" {
+		t.Errorf("display name is %q, want packer-build-1", got)
+	}
+	for i, want := range []string{"packer-build-1-data", "focal-logs"} {
+		if got := c.BuilderConfiguration.Disks[i].DisplayName; got != want {
+			t.Errorf("disk %d display name is %q, want %q", i, got, want)
+		}
+	}
+}
+
+func TestConfigSetBuildID_displayName(t *testing.T) {
+	c := &Config{}
+	_, err := c.Prepare(testConfigRaw(map[string]interface{}{
+		"builder_target": map[string]interface{}{"display_name": "focal-golden"},
+		"builder_configuration": map[string]interface{}{
+			"disk": []map[string]interface{}{{"name": "data", "size": "10Gi", "export": true}},
+		},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.setBuildID("build-1")
+	if got := c.BuilderTarget.DisplayName; got != "focal-golden" {
+		t.Errorf("display name is %q, want focal-golden", got)
+	}
+	if got := c.BuilderConfiguration.Disks[0].DisplayName; got != "focal-golden-data" {
+		t.Errorf("disk display name is %q, want focal-golden-data", got)
+	}
+}
+
+func TestConfigPrepare_timeouts(t *testing.T) {
+	c := &Config{}
+	if _, err := c.Prepare(testConfigRaw(nil)); err != nil {
+		t.Fatal(err)
+	}
+	if c.ImageImportTimeout != 30*time.Minute {
+		t.Errorf("image_import_timeout is %s, want the default 30m", c.ImageImportTimeout)
+	}
+	if c.VMStartTimeout != 10*time.Minute {
+		t.Errorf("vm_start_timeout is %s, want the default 10m", c.VMStartTimeout)
+	}
+
+	c = &Config{}
+	_, err := c.Prepare(testConfigRaw(map[string]interface{}{
+		"image_import_timeout": "2h",
+		"vm_start_timeout":     "15m",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.ImageImportTimeout != 2*time.Hour || c.VMStartTimeout != 15*time.Minute {
+		t.Errorf("timeouts are %s and %s, want the configured 2h and 15m", c.ImageImportTimeout, c.VMStartTimeout)
+	}
+}
+
+func TestConfigPrepare_diskBootOrder(t *testing.T) {
+	iso := map[string]interface{}{"name": "rhel9", "url": fakeImageURL, "image_type": ImageTypeISO}
+	cases := map[string]struct {
+		source  map[string]interface{}
+		disks   []map[string]interface{}
+		wantErr string
+	}{
+		"bootable disks": {
+			disks: []map[string]interface{}{
+				{"name": "a", "size": "1Gi", "boot_order": 2},
+				{"name": "b", "size": "1Gi", "boot_order": 3},
+				{"name": "c", "size": "1Gi"},
+				{"name": "d", "size": "1Gi"},
+			},
+		},
+		"root disk": {
+			disks:   []map[string]interface{}{{"size": "1Gi", "boot_order": 1}},
+			wantErr: "disk[0]: boot_order 1 is already used by the root disk",
+		},
+		"iso": {
+			source:  iso,
+			disks:   []map[string]interface{}{{"size": "1Gi", "boot_order": 2}},
+			wantErr: "disk[0]: boot_order 2 is already used by the installer ISO",
+		},
+		"iso with later disks": {
+			source: iso,
+			disks:  []map[string]interface{}{{"size": "1Gi", "boot_order": 3}},
+		},
+		"duplicate": {
+			disks: []map[string]interface{}{
+				{"name": "a", "size": "1Gi", "boot_order": 3},
+				{"name": "b", "size": "1Gi", "boot_order": 3},
+			},
+			wantErr: `disk[1]: boot_order 3 is already used by disk "a"`,
+		},
+		"negative": {
+			disks:   []map[string]interface{}{{"size": "1Gi", "boot_order": -1}},
+			wantErr: "disk[0]: boot_order must not be negative",
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			settings := map[string]interface{}{
+				"builder_configuration": map[string]interface{}{"disk": tc.disks},
+			}
+			if tc.source != nil {
+				settings["builder_source"] = tc.source
+			}
+			c := &Config{}
+			_, err := c.Prepare(testConfigRaw(settings))
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Prepare: %s", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("Prepare error %v, want %q", err, tc.wantErr)
+			}
+		})
+	}
+}
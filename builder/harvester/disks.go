@@ -0,0 +1,196 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package harvester
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+
+	harvester "github.com/drewmullen/harvester-go-sdk"
+)
+
+// diskVolume ties a configured disk to the volume created for it.
+type diskVolume struct {
+	Disk       Disk
+	VolumeName string
+}
+
+// The boot orders of the builder's own disks, which disk blocks cannot use.
+const (
+	rootDiskBootOrder int32 = 1
+	isoBootOrder      int32 = 2
+)
+
+// quantitySuffixes are the multipliers of the Kubernetes quantity suffixes,
+// binary suffixes first so "Mi" is not read as "M".
+var quantitySuffixes = []struct {
+	suffix     string
+	multiplier *big.Rat
+}{
+	{"Ki", new(big.Rat).SetInt(new(big.Int).Lsh(big.NewInt(1), 10))},
+	{"Mi", new(big.Rat).SetInt(new(big.Int).Lsh(big.NewInt(1), 20))},
+	{"Gi", new(big.Rat).SetInt(new(big.Int).Lsh(big.NewInt(1), 30))},
+	{"Ti", new(big.Rat).SetInt(new(big.Int).Lsh(big.NewInt(1), 40))},
+	{"Pi", new(big.Rat).SetInt(new(big.Int).Lsh(big.NewInt(1), 50))},
+	{"Ei", new(big.Rat).SetInt(new(big.Int).Lsh(big.NewInt(1), 60))},
+	{"k", big.NewRat(1e3, 1)},
+	{"M", big.NewRat(1e6, 1)},
+	{"G", big.NewRat(1e9, 1)},
+	{"T", big.NewRat(1e12, 1)},
+	{"P", big.NewRat(1e15, 1)},
+	{"E", big.NewRat(1e18, 1)},
+	{"m", big.NewRat(1, 1e3)},
+}
+
+// parseQuantity parses a Kubernetes resource quantity such as "100Gi",
+// "1.5T" or "1073741824" so sizes written with different suffixes can be
+// compared.
+func parseQuantity(s string) (*big.Rat, error) {
+	number, multiplier := s, big.NewRat(1, 1)
+	for _, q := range quantitySuffixes {
+		if strings.HasSuffix(s, q.suffix) {
+			number, multiplier = strings.TrimSuffix(s, q.suffix), q.multiplier
+			break
+		}
+	}
+	value, ok := new(big.Rat).SetString(number)
+	if !ok || number == "" || strings.ContainsAny(number, "/ ") {
+		return nil, fmt.Errorf("%q is not a valid quantity", s)
+	}
+	return value.Mul(value, multiplier), nil
+}
+
+func validDiskBus(bus string) bool {
+	switch bus {
+	case DiskBusVirtio, DiskBusSata, DiskBusScsi:
+		return true
+	}
+	return false
+}
+
+func createBlankVolume(client *harvester.APIClient, auth context.Context, c *Config, disk Disk, accessModes []string) (string, error) {
+	req := client.VolumesAPI.CreateNamespacedPersistentVolumeClaim(auth, c.HarvesterNamespace)
+
+	claimInput := &harvester.K8sIoV1PersistentVolumeClaim{
+		Metadata: &harvester.K8sIoV1ObjectMeta{
+			GenerateName: toStringPtr(fmt.Sprintf("%s%s-", c.BuilderConfiguration.NamePrefix, disk.Name)),
+			Labels:       buildLabels(c, nil),
+		},
+		Spec: &harvester.K8sIoV1PersistentVolumeClaimSpec{
+			AccessModes: accessModes,
+			Resources: &harvester.K8sIoV1ResourceRequirements{
+				Requests: map[string]string{
+					"storage": disk.Size,
+				},
+			},
+			StorageClassName: toStringPtr(disk.StorageClass),
+			VolumeMode:       toStringPtr(disk.VolumeMode),
+		},
+	}
+	req = req.K8sIoV1PersistentVolumeClaim(*claimInput)
+	claim, _, err := req.Execute()
+	if err != nil {
+		return "", err
+	}
+	if claim == nil || claim.Metadata == nil || claim.Metadata.Name == nil || *claim.Metadata.Name == "" {
+		return "", fmt.Errorf("volume name is empty")
+	}
+	return *claim.Metadata.Name, nil
+}
+
+func deleteVolume(client *harvester.APIClient, auth context.Context, name string, namespace string) error {
+	req := client.VolumesAPI.DeleteNamespacedPersistentVolumeClaim(auth, name, namespace)
+	req = req.K8sIoV1DeleteOptions(harvester.K8sIoV1DeleteOptions{})
+	_, _, err := req.Execute()
+	return err
+}
+
+func vmDataDisks(disks []diskVolume) []harvester.KubevirtIoApiCoreV1Disk {
+	var out []harvester.KubevirtIoApiCoreV1Disk
+	for _, d := range disks {
+		disk := harvester.KubevirtIoApiCoreV1Disk{
+			Disk: &harvester.KubevirtIoApiCoreV1DiskTarget{
+				Bus: toStringPtr(d.Disk.Bus),
+			},
+			Name: d.Disk.Name,
+		}
+		if d.Disk.BootOrder > 0 {
+			disk.BootOrder = toInt32Ptr(d.Disk.BootOrder)
+		}
+		out = append(out, disk)
+	}
+	return out
+}
+
+func vmDataVolumes(disks []diskVolume) []harvester.KubevirtIoApiCoreV1Volume {
+	var out []harvester.KubevirtIoApiCoreV1Volume
+	for _, d := range disks {
+		out = append(out, harvester.KubevirtIoApiCoreV1Volume{
+			Name: d.Disk.Name,
+			PersistentVolumeClaim: &harvester.KubevirtIoApiCoreV1PersistentVolumeClaimVolumeSource{
+				ClaimName: d.VolumeName,
+			},
+		})
+	}
+	return out
+}
+
+// vmCDROMDisks attaches the installer ISO on the SATA bus. It boots after the
+// root disk, so the installer runs while the root disk is blank and the
+// installed system boots once it is not.
+func vmCDROMDisks(c *Config, volumes builderVolumes) []harvester.KubevirtIoApiCoreV1Disk {
+	var out []harvester.KubevirtIoApiCoreV1Disk
+	if volumes.ISO != "" {
+		out = append(out, harvester.KubevirtIoApiCoreV1Disk{
+			BootOrder: toInt32Ptr(isoBootOrder),
+			Cdrom: &harvester.KubevirtIoApiCoreV1CDRomTarget{
+				Bus: toStringPtr(DiskBusSata),
+			},
+			Name: "cdrom",
+		})
+	}
+	if volumes.CD != "" {
+		out = append(out, harvester.KubevirtIoApiCoreV1Disk{
+			Cdrom: &harvester.KubevirtIoApiCoreV1CDRomTarget{
+				Bus: toStringPtr(DiskBusSata),
+			},
+			Name: "cd",
+		})
+	}
+	if c.BuilderConfiguration.VirtioDrivers {
+		out = append(out, harvester.KubevirtIoApiCoreV1Disk{
+			Cdrom: &harvester.KubevirtIoApiCoreV1CDRomTarget{
+				Bus: toStringPtr(DiskBusSata),
+			},
+			Name: virtioDriversDiskName,
+		})
+	}
+	return out
+}
+
+func vmCDROMVolumes(c *Config, volumes builderVolumes) []harvester.KubevirtIoApiCoreV1Volume {
+	var out []harvester.KubevirtIoApiCoreV1Volume
+	if volumes.ISO != "" {
+		out = append(out, harvester.KubevirtIoApiCoreV1Volume{
+			Name: "cdrom",
+			PersistentVolumeClaim: &harvester.KubevirtIoApiCoreV1PersistentVolumeClaimVolumeSource{
+				ClaimName: volumes.ISO,
+			},
+		})
+	}
+	if volumes.CD != "" {
+		out = append(out, harvester.KubevirtIoApiCoreV1Volume{
+			Name: "cd",
+			PersistentVolumeClaim: &harvester.KubevirtIoApiCoreV1PersistentVolumeClaimVolumeSource{
+				ClaimName: volumes.CD,
+			},
+		})
+	}
+	if c.BuilderConfiguration.VirtioDrivers {
+		out = append(out, vmVirtioDriversVolume(c, volumes))
+	}
+	return out
+}
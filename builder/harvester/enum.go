@@ -6,12 +6,81 @@ var (
 )
 
 var (
-	KindVirtualMachineImage string = "VirtualMachineImage"
-	KindVirtualMachine      string = "VirtualMachine"
-	KindVolume              string = "PersistentVolumeClaim"
+	KindVirtualMachineImage    string = "VirtualMachineImage"
+	KindVirtualMachine         string = "VirtualMachine"
+	KindVirtualMachineInstance string = "VirtualMachineInstance"
+	KindVolume                 string = "PersistentVolumeClaim"
+	KindSecret                 string = "Secret"
 )
 
 var (
 	VirtualMachineSpecRunStrategy string = "RerunOnFailure"
 	StorageClassName              string = "harvester-longhorn"
+	// the Windows drivers container disk Harvester attaches to Windows VMs, and
+	// ships in its air-gapped image bundle
+	VirtioDriversContainerDisk string = "registry.suse.com/suse/vmdp/vmdp:2.5.4.2"
+)
+
+var (
+	AffinityTypeNode    string = "node"
+	AffinityTypePod     string = "pod"
+	AffinityTypePodAnti string = "pod_anti"
+)
+
+var (
+	InterfaceTypeBridge     string = "bridge"
+	InterfaceTypeMasquerade string = "masquerade"
+)
+
+var (
+	DiskBusVirtio string = "virtio"
+	DiskBusSata   string = "sata"
+	DiskBusScsi   string = "scsi"
+)
+
+var (
+	VolumeModeBlock      string = "Block"
+	VolumeModeFilesystem string = "Filesystem"
+)
+
+var (
+	AccessModeReadWriteOnce    string = "ReadWriteOnce"
+	AccessModeReadOnlyMany     string = "ReadOnlyMany"
+	AccessModeReadWriteMany    string = "ReadWriteMany"
+	AccessModeReadWriteOncePod string = "ReadWriteOncePod"
+)
+
+var (
+	ImageSourceTypeDownload         string = "download"
+	ImageSourceTypeUpload           string = "upload"
+	ImageSourceTypeExportFromVolume string = "export-from-volume"
+)
+
+var (
+	ImageTypeRawQcow2 string = "raw_qcow2"
+	ImageTypeISO      string = "iso"
+)
+
+var (
+	OSFamilyLinux   string = "linux"
+	OSFamilyWindows string = "windows"
+)
+
+var (
+	NICModelVirtio string = "virtio"
+	NICModelE1000  string = "e1000"
+)
+
+var (
+	IPFamilyIPv4 string = "ipv4"
+	IPFamilyIPv6 string = "ipv6"
+)
+
+var (
+	LabelBuildID       string = "packer.io/build-id"
+	LabelBuildName     string = "packer.io/build-name"
+	LabelPluginVersion string = "packer.io/plugin-version"
+	// set on images the build deletes when it ends, see Sweeper
+	LabelTemporary string = "packer.io/temporary"
+	LabelTagPrefix string = "tag.harvesterhci.io/"
 )
@@ -0,0 +1,516 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package harvester
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	harvester "github.com/drewmullen/harvester-go-sdk"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// the resources served by fakeHarvester
+const (
+	fakeImages  = "virtualmachineimages"
+	fakeVolumes = "persistentvolumeclaims"
+	fakeVMs     = "virtualmachines"
+	fakeVMIs    = "virtualmachineinstances"
+	fakeSecrets = "secrets"
+	fakeEvents  = "events"
+)
+
+const fakeImageURL = "http://images.example.com/focal.img"
+
+// fakeObject is a stored resource as decoded JSON.
+type fakeObject = map[string]interface{}
+
+// fakeHarvester is an in-process stand-in for the parts of the Harvester,
+// KubeVirt and Kubernetes APIs the builder talks to. objects are kept as
+// decoded JSON, and a minimal controller fills in their status on create so
+// images import, volumes bind and VMs start right away. tests script other
+// transitions through the hooks, which run with the lock held and may change
+// the object they are passed.
+type fakeHarvester struct {
+	*httptest.Server
+	t *testing.T
+
+	mu       sync.Mutex
+	objects  map[string]fakeObject
+	nameSeq  int
+	requests []string
+	uploads  map[string]int64
+
+	// called after the controller with every created object, by resource
+	onCreate map[string]func(obj fakeObject)
+	// called before every read of an object, including in lists, by resource
+	onRead map[string]func(obj fakeObject)
+	// called for every delete, by resource. returning false keeps the object,
+	// as a finalizer would
+	onDelete map[string]func(obj fakeObject) bool
+	// called for the VM stop subresource. the default deletes the VMI
+	onStop func(f *fakeHarvester, namespace string, name string, gracePeriod *int64)
+	// requests matching "<METHOD> <resource>" fail with the status code
+	fail map[string]int
+}
+
+// newFakeHarvester starts a fake API server and shortens pollInterval for the
+// duration of the test.
+func newFakeHarvester(t *testing.T) *fakeHarvester {
+	f := &fakeHarvester{
+		t:        t,
+		objects:  map[string]fakeObject{},
+		uploads:  map[string]int64{},
+		onCreate: map[string]func(obj fakeObject){},
+		onRead:   map[string]func(obj fakeObject){},
+		onDelete: map[string]func(obj fakeObject) bool{},
+		fail:     map[string]int{},
+	}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serveHTTP))
+	t.Cleanup(f.Close)
+
+	interval := pollInterval
+	pollInterval = time.Millisecond
+	t.Cleanup(func() { pollInterval = interval })
+	return f
+}
+
+// client returns an SDK client for the fake and the context carrying its token.
+func (f *fakeHarvester) client() (*harvester.APIClient, context.Context) {
+	return newClient(f.URL, "token")
+}
+
+// raw returns the settings of a build against the fake of the image focal,
+// downloaded from fakeImageURL, with the settings of extra applied.
+func (f *fakeHarvester) raw(extra map[string]interface{}) map[string]interface{} {
+	raw := map[string]interface{}{
+		"harvester_url":       f.URL,
+		"harvester_token":     "token",
+		"harvester_namespace": "default",
+		"builder_source": map[string]interface{}{
+			"name": "focal",
+			"url":  fakeImageURL,
+		},
+		"communicator": "none",
+	}
+	for k, v := range extra {
+		raw[k] = v
+	}
+	return raw
+}
+
+// config prepares the config of f.raw(extra) as Builder.Run would.
+func (f *fakeHarvester) config(extra map[string]interface{}) *Config {
+	c := &Config{}
+	if _, err := c.Prepare(f.raw(extra)); err != nil {
+		f.t.Fatalf("preparing config: %s", err)
+	}
+	c.setBuildID("test-build")
+	return c
+}
+
+// state returns a state bag set up as Builder.Run does for the config.
+func (f *fakeHarvester) state(c *Config) *multistep.BasicStateBag {
+	client, auth := f.client()
+	state := new(multistep.BasicStateBag)
+	state.Put("client", client)
+	state.Put("auth", auth)
+	state.Put("ui", packersdk.TestUi(f.t))
+	state.Put("config", c)
+	state.Put("hook", &packersdk.MockHook{})
+	return state
+}
+
+func fakeKey(resource string, namespace string, name string) string {
+	return resource + "/" + namespace + "/" + name
+}
+
+// put stores obj, as created by the test rather than the builder.
+func (f *fakeHarvester) put(resource string, namespace string, obj fakeObject) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	meta := fakeMeta(obj)
+	meta["namespace"] = namespace
+	if _, ok := meta["creationTimestamp"]; !ok {
+		meta["creationTimestamp"] = time.Now().UTC().Format(time.RFC3339)
+	}
+	f.objects[fakeKey(resource, namespace, meta["name"].(string))] = obj
+}
+
+// putRunningVM stores a VM, as created by the test, and starts its VMI.
+func (f *fakeHarvester) putRunningVM(namespace string, name string) {
+	f.put(fakeVMs, namespace, fakeObject{
+		"metadata": map[string]interface{}{"name": name},
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"domain": map[string]interface{}{"devices": map[string]interface{}{}},
+				},
+			},
+		},
+	})
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.startVMI(namespace, name, f.objects[fakeKey(fakeVMs, namespace, name)])
+}
+
+// get returns the stored object, or nil.
+func (f *fakeHarvester) get(resource string, namespace string, name string) fakeObject {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.objects[fakeKey(resource, namespace, name)]
+}
+
+// names returns the names of the stored objects of the resource.
+func (f *fakeHarvester) names(resource string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var names []string
+	for key := range f.objects {
+		if strings.HasPrefix(key, resource+"/") {
+			names = append(names, key[strings.LastIndex(key, "/")+1:])
+		}
+	}
+	return names
+}
+
+// served reports whether a request "<METHOD> <path>" was served.
+func (f *fakeHarvester) served(request string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, r := range f.requests {
+		if r == request {
+			return true
+		}
+	}
+	return false
+}
+
+func fakeMeta(obj fakeObject) map[string]interface{} {
+	meta, ok := obj["metadata"].(map[string]interface{})
+	if !ok {
+		meta = map[string]interface{}{}
+		obj["metadata"] = meta
+	}
+	return meta
+}
+
+func (f *fakeHarvester) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, r.Method+" "+r.URL.Path)
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case len(parts) == 5 && parts[0] == "v1" && parts[1] == "harvester" && r.URL.Query().Get("action") == "upload":
+		f.upload(w, r, parts[3], parts[4])
+		return
+	case len(parts) >= 3 && parts[0] == "api":
+		parts = parts[2:]
+	case len(parts) >= 4 && parts[0] == "apis":
+		if parts[1] == "subresources.kubevirt.io" && len(parts) == 8 {
+			f.subresource(w, r, parts[4], parts[6], parts[7])
+			return
+		}
+		parts = parts[3:]
+	default:
+		f.status(w, http.StatusNotFound, "unknown path "+r.URL.Path)
+		return
+	}
+	if len(parts) < 3 || len(parts) > 4 || parts[0] != "namespaces" {
+		f.status(w, http.StatusNotFound, "unknown path "+r.URL.Path)
+		return
+	}
+	namespace, resource := parts[1], parts[2]
+	if code, ok := f.fail[r.Method+" "+resource]; ok {
+		f.status(w, code, "injected failure")
+		return
+	}
+
+	if len(parts) == 3 {
+		switch r.Method {
+		case http.MethodGet:
+			f.list(w, r, resource, namespace)
+		case http.MethodPost:
+			f.create(w, r, resource, namespace)
+		default:
+			f.status(w, http.StatusMethodNotAllowed, r.Method)
+		}
+		return
+	}
+
+	name := parts[3]
+	key := fakeKey(resource, namespace, name)
+	obj, ok := f.objects[key]
+	if !ok {
+		f.status(w, http.StatusNotFound, fmt.Sprintf("%s %q not found", resource, name))
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		if hook := f.onRead[resource]; hook != nil {
+			hook(obj)
+		}
+		f.write(w, http.StatusOK, obj)
+	case http.MethodPut:
+		var updated fakeObject
+		if err := json.NewDecoder(r.Body).Decode(&updated); err != nil {
+			f.status(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		updated["status"] = obj["status"]
+		f.objects[key] = updated
+		f.write(w, http.StatusOK, updated)
+	case http.MethodDelete:
+		if hook := f.onDelete[resource]; hook != nil && !hook(obj) {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		delete(f.objects, key)
+		if resource == fakeVMs {
+			delete(f.objects, fakeKey(fakeVMIs, namespace, name))
+		}
+		w.WriteHeader(http.StatusOK)
+	default:
+		f.status(w, http.StatusMethodNotAllowed, r.Method)
+	}
+}
+
+func (f *fakeHarvester) list(w http.ResponseWriter, r *http.Request, resource string, namespace string) {
+	selector := map[string]string{}
+	if s := r.URL.Query().Get("labelSelector"); s != "" {
+		for _, term := range strings.Split(s, ",") {
+			k, v, _ := strings.Cut(term, "=")
+			selector[k] = v
+		}
+	}
+
+	items := []fakeObject{}
+	for key, obj := range f.objects {
+		if !strings.HasPrefix(key, resource+"/"+namespace+"/") {
+			continue
+		}
+		labels, _ := fakeMeta(obj)["labels"].(map[string]interface{})
+		matches := true
+		for k, v := range selector {
+			got, ok := labels[k].(string)
+			if !ok || (v != "" && got != v) {
+				matches = false
+			}
+		}
+		if !matches {
+			continue
+		}
+		if hook := f.onRead[resource]; hook != nil {
+			hook(obj)
+		}
+		items = append(items, obj)
+	}
+	f.write(w, http.StatusOK, fakeObject{
+		"apiVersion": "v1",
+		"kind":       "List",
+		"metadata":   map[string]interface{}{},
+		"items":      items,
+	})
+}
+
+func (f *fakeHarvester) create(w http.ResponseWriter, r *http.Request, resource string, namespace string) {
+	var obj fakeObject
+	if err := json.NewDecoder(r.Body).Decode(&obj); err != nil {
+		f.status(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	meta := fakeMeta(obj)
+	name, _ := meta["name"].(string)
+	if name == "" {
+		generateName, _ := meta["generateName"].(string)
+		if generateName == "" {
+			f.status(w, http.StatusUnprocessableEntity, "name or generateName is required")
+			return
+		}
+		f.nameSeq++
+		name = fmt.Sprintf("%s%05d", generateName, f.nameSeq)
+	}
+	key := fakeKey(resource, namespace, name)
+	if _, ok := f.objects[key]; ok {
+		f.status(w, http.StatusConflict, fmt.Sprintf("%s %q already exists", resource, name))
+		return
+	}
+	meta["name"] = name
+	meta["namespace"] = namespace
+	meta["uid"] = fmt.Sprintf("uid-%s", name)
+	meta["creationTimestamp"] = time.Now().UTC().Format(time.RFC3339)
+
+	f.reconcile(resource, namespace, name, obj)
+	if hook := f.onCreate[resource]; hook != nil {
+		hook(obj)
+	}
+	f.objects[key] = obj
+	f.write(w, http.StatusCreated, obj)
+}
+
+// reconcile plays the part of the Harvester and KubeVirt controllers for a
+// created object.
+func (f *fakeHarvester) reconcile(resource string, namespace string, name string, obj fakeObject) {
+	switch resource {
+	case fakeImages:
+		obj["status"] = importedStatus(name)
+	case fakeVolumes:
+		obj["status"] = map[string]interface{}{"phase": "Bound"}
+	case fakeVMs:
+		f.startVMI(namespace, name, obj)
+	}
+}
+
+// startVMI creates the running VMI of the VM, reporting an address on its
+// first interface.
+func (f *fakeHarvester) startVMI(namespace string, name string, vm fakeObject) {
+	spec, _ := vm["spec"].(map[string]interface{})
+	template, _ := spec["template"].(map[string]interface{})
+	vmiSpec, _ := template["spec"].(map[string]interface{})
+
+	iface := "nic-1"
+	if networks, ok := vmiSpec["networks"].([]interface{}); ok && len(networks) > 0 {
+		iface, _ = networks[0].(map[string]interface{})["name"].(string)
+	}
+	f.objects[fakeKey(fakeVMIs, namespace, name)] = fakeObject{
+		"apiVersion": "kubevirt.io/v1",
+		"kind":       "VirtualMachineInstance",
+		"metadata": map[string]interface{}{
+			"name":              name,
+			"namespace":         namespace,
+			"creationTimestamp": time.Now().UTC().Format(time.RFC3339),
+		},
+		"spec": vmiSpec,
+		"status": map[string]interface{}{
+			"phase": "Running",
+			"interfaces": []interface{}{
+				map[string]interface{}{
+					"name":        iface,
+					"ipAddress":   "10.0.0.10",
+					"ipAddresses": []interface{}{"10.0.0.10"},
+				},
+			},
+		},
+	}
+}
+
+func (f *fakeHarvester) subresource(w http.ResponseWriter, r *http.Request, namespace string, name string, action string) {
+	if _, ok := f.objects[fakeKey(fakeVMs, namespace, name)]; !ok {
+		f.status(w, http.StatusNotFound, fmt.Sprintf("virtualmachine %q not found", name))
+		return
+	}
+	switch action {
+	case "stop":
+		var options struct {
+			GracePeriod *int64 `json:"gracePeriod"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&options); err != nil {
+			f.status(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if f.onStop != nil {
+			f.onStop(f, namespace, name, options.GracePeriod)
+		} else {
+			delete(f.objects, fakeKey(fakeVMIs, namespace, name))
+		}
+	case "start":
+		f.startVMI(namespace, name, f.objects[fakeKey(fakeVMs, namespace, name)])
+	default:
+		f.status(w, http.StatusNotFound, "unknown subresource "+action)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (f *fakeHarvester) upload(w http.ResponseWriter, r *http.Request, namespace string, name string) {
+	if _, ok := f.objects[fakeKey(fakeImages, namespace, name)]; !ok {
+		f.status(w, http.StatusNotFound, fmt.Sprintf("image %q not found", name))
+		return
+	}
+	file, _, err := r.FormFile("chunk")
+	if err != nil {
+		f.status(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer file.Close()
+	n, err := io.Copy(io.Discard, file)
+	if err != nil {
+		f.status(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	f.uploads[name] = n
+	w.WriteHeader(http.StatusOK)
+}
+
+func (f *fakeHarvester) write(w http.ResponseWriter, code int, obj interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(obj); err != nil {
+		f.t.Errorf("encoding response: %s", err)
+	}
+}
+
+// status writes a Kubernetes Status failure.
+func (f *fakeHarvester) status(w http.ResponseWriter, code int, message string) {
+	f.write(w, code, fakeObject{
+		"apiVersion": "v1",
+		"kind":       "Status",
+		"metadata":   map[string]interface{}{},
+		"status":     "Failure",
+		"message":    message,
+		"code":       code,
+	})
+}
+
+// fakeImage returns an image as Harvester stores it once imported.
+func fakeImage(name string, displayName string, status map[string]interface{}) fakeObject {
+	return fakeObject{
+		"apiVersion": ApiVersionHarvesterKey,
+		"kind":       KindVirtualMachineImage,
+		"metadata": map[string]interface{}{
+			"name": name,
+		},
+		"spec": map[string]interface{}{
+			"displayName": displayName,
+			"sourceType":  ImageSourceTypeDownload,
+			"url":         fakeImageURL,
+		},
+		"status": status,
+	}
+}
+
+// sdkImage decodes the image as the SDK does when reading it from the fake.
+func sdkImage(t *testing.T, obj fakeObject) harvester.HarvesterhciIoV1beta1VirtualMachineImage {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var image harvester.HarvesterhciIoV1beta1VirtualMachineImage
+	if err := json.Unmarshal(data, &image); err != nil {
+		t.Fatal(err)
+	}
+	return image
+}
+
+// importedStatus is the status of an image that finished importing.
+func importedStatus(name string) map[string]interface{} {
+	return map[string]interface{}{
+		"progress":         100,
+		"size":             1 << 30,
+		"storageClassName": "longhorn-" + name,
+		"conditions": []interface{}{
+			map[string]interface{}{"type": "Imported", "status": "True"},
+		},
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package harvester
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	harvester "github.com/drewmullen/harvester-go-sdk"
+)
+
+// Empty reports whether no filter criteria are set.
+func (f *ImageFilter) Empty() bool {
+	return len(f.Labels) == 0 && f.DisplayName == "" && !f.MostRecent
+}
+
+// labelSelector renders the filter labels as a Kubernetes label selector.
+func (f *ImageFilter) labelSelector() string {
+	selectors := make([]string, 0, len(f.Labels))
+	for k, v := range f.Labels {
+		selectors = append(selectors, fmt.Sprintf("%s=%s", k, v))
+	}
+	sort.Strings(selectors)
+	return strings.Join(selectors, ",")
+}
+
+// findImage lists the images in the namespace matching the filter. Images that
+// are being deleted or have not finished importing are never selected. More
+// than one match is an error unless MostRecent is set.
+func findImage(client *harvester.APIClient, auth context.Context, filter ImageFilter, namespace string) (harvester.HarvesterhciIoV1beta1VirtualMachineImage, error) {
+	req := client.ImagesAPI.ListNamespacedVirtualMachineImage(auth, namespace)
+	if selector := filter.labelSelector(); selector != "" {
+		req = req.LabelSelector(selector)
+	}
+	list, _, err := req.Execute()
+	if err != nil {
+		return harvester.HarvesterhciIoV1beta1VirtualMachineImage{}, err
+	}
+
+	var displayName *regexp.Regexp
+	if filter.DisplayName != "" {
+		displayName, err = regexp.Compile(filter.DisplayName)
+		if err != nil {
+			return harvester.HarvesterhciIoV1beta1VirtualMachineImage{}, err
+		}
+	}
+
+	var matches []harvester.HarvesterhciIoV1beta1VirtualMachineImage
+	for _, image := range list.Items {
+		if image.Metadata == nil || image.Metadata.Name == nil || image.Metadata.DeletionTimestamp != nil {
+			continue
+		}
+		if image.Status == nil || image.Status.Progress == nil || *image.Status.Progress != 100 {
+			continue
+		}
+		if displayName != nil && !displayName.MatchString(image.Spec.DisplayName) {
+			continue
+		}
+		matches = append(matches, image)
+	}
+
+	if len(matches) == 0 {
+		return harvester.HarvesterhciIoV1beta1VirtualMachineImage{}, fmt.Errorf("no images in namespace %s match the filter", namespace)
+	}
+	if len(matches) > 1 && !filter.MostRecent {
+		names := make([]string, 0, len(matches))
+		for _, image := range matches {
+			names = append(names, *image.Metadata.Name)
+		}
+		return harvester.HarvesterhciIoV1beta1VirtualMachineImage{}, fmt.Errorf("filter matches %d images (%s), narrow the filter or set most_recent = true", len(matches), strings.Join(names, ", "))
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return imageCreationTime(matches[i]).After(imageCreationTime(matches[j]))
+	})
+	return matches[0], nil
+}
+
+func imageCreationTime(image harvester.HarvesterhciIoV1beta1VirtualMachineImage) time.Time {
+	if image.Metadata.CreationTimestamp == nil {
+		return time.Time{}
+	}
+	t, err := time.Parse(time.RFC3339, *image.Metadata.CreationTimestamp)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// LookupImage finds an imported image for the harvester-image data source: the
+// image called name when name is set, otherwise the image matching filter.
+func LookupImage(harvesterURL string, token string, namespace string, name string, filter ImageFilter) (harvester.HarvesterhciIoV1beta1VirtualMachineImage, error) {
+	client, auth := newClient(harvesterURL, token)
+	if name == "" {
+		return findImage(client, auth, filter, namespace)
+	}
+
+	image, err := getImageByName(client, auth, name, namespace)
+	if err != nil {
+		return harvester.HarvesterhciIoV1beta1VirtualMachineImage{}, err
+	}
+	if image == nil {
+		return harvester.HarvesterhciIoV1beta1VirtualMachineImage{}, fmt.Errorf("image %s does not exist in namespace %s", name, namespace)
+	}
+	ready, err := imageReady(*image)
+	if err != nil {
+		return harvester.HarvesterhciIoV1beta1VirtualMachineImage{}, fmt.Errorf("image %s cannot be used: %v", name, err)
+	}
+	if !ready {
+		return harvester.HarvesterhciIoV1beta1VirtualMachineImage{}, fmt.Errorf("image %s has not finished importing", name)
+	}
+	return *image, nil
+}
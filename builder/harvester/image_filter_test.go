@@ -0,0 +1,154 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package harvester
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+)
+
+func TestImageFilterLabelSelector(t *testing.T) {
+	filter := ImageFilter{Labels: map[string]string{"os": "ubuntu", "channel": "stable"}}
+	if got := filter.labelSelector(); got != "channel=stable,os=ubuntu" {
+		t.Errorf("labelSelector = %q, want the labels sorted", got)
+	}
+	if got := (&ImageFilter{}).labelSelector(); got != "" {
+		t.Errorf("labelSelector of an empty filter = %q", got)
+	}
+}
+
+// putPublishedImages stores the images a pipeline published, oldest first.
+func putPublishedImages(f *fakeHarvester) {
+	for _, image := range []struct {
+		name, displayName, created string
+		labels                     map[string]interface{}
+		status                     map[string]interface{}
+	}{
+		{"ubuntu-1", "ubuntu-2204-20260101", "2026-01-01T00:00:00Z", map[string]interface{}{"os": "ubuntu", "channel": "stable"}, importedStatus("ubuntu-1")},
+		{"ubuntu-2", "ubuntu-2204-20260201", "2026-02-01T00:00:00Z", map[string]interface{}{"os": "ubuntu", "channel": "stable"}, importedStatus("ubuntu-2")},
+		{"ubuntu-3", "ubuntu-2404-20260301", "2026-03-01T00:00:00Z", map[string]interface{}{"os": "ubuntu", "channel": "beta"}, importedStatus("ubuntu-3")},
+		{"ubuntu-4", "ubuntu-2204-20260401", "2026-04-01T00:00:00Z", map[string]interface{}{"os": "ubuntu", "channel": "stable"}, map[string]interface{}{"progress": 40}},
+		{"rocky-1", "rocky-9-20260101", "2026-01-01T00:00:00Z", map[string]interface{}{"os": "rocky", "channel": "stable"}, importedStatus("rocky-1")},
+	} {
+		obj := fakeImage(image.name, image.displayName, image.status)
+		fakeMeta(obj)["labels"] = image.labels
+		fakeMeta(obj)["creationTimestamp"] = image.created
+		f.put(fakeImages, "default", obj)
+	}
+}
+
+func TestFindImage(t *testing.T) {
+	cases := map[string]struct {
+		filter  ImageFilter
+		want    string
+		wantErr string
+	}{
+		"most recent by labels": {
+			filter: ImageFilter{Labels: map[string]string{"os": "ubuntu", "channel": "stable"}, MostRecent: true},
+			want:   "ubuntu-2",
+		},
+		"display name": {
+			filter: ImageFilter{Labels: map[string]string{"os": "ubuntu"}, DisplayName: "^ubuntu-2404-"},
+			want:   "ubuntu-3",
+		},
+		"ambiguous": {
+			filter:  ImageFilter{Labels: map[string]string{"os": "ubuntu", "channel": "stable"}},
+			wantErr: "filter matches 2 images",
+		},
+		"no match": {
+			filter:  ImageFilter{Labels: map[string]string{"os": "debian"}},
+			wantErr: "no images in namespace default match the filter",
+		},
+		"importing images skipped": {
+			filter:  ImageFilter{DisplayName: "20260401$"},
+			wantErr: "no images in namespace default match the filter",
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := newFakeHarvester(t)
+			putPublishedImages(f)
+			client, auth := f.client()
+
+			image, err := findImage(client, auth, tc.filter, "default")
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Errorf("findImage error %v, want %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := *image.Metadata.Name; got != tc.want {
+				t.Errorf("findImage = %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestConfigPrepare_filter(t *testing.T) {
+	cases := map[string]struct {
+		source  map[string]interface{}
+		wantErr string
+	}{
+		"filter": {
+			source: map[string]interface{}{"filter": map[string]interface{}{"labels": map[string]string{"os": "ubuntu"}, "most_recent": true}},
+		},
+		"filter and name": {
+			source:  map[string]interface{}{"name": "focal", "filter": map[string]interface{}{"most_recent": true}},
+			wantErr: "name, url and local_path cannot be combined with filter",
+		},
+		"invalid display name": {
+			source:  map[string]interface{}{"filter": map[string]interface{}{"display_name": "ubuntu-("}},
+			wantErr: "builder_source filter display_name",
+		},
+		"nothing set": {
+			source:  map[string]interface{}{},
+			wantErr: "one of name, filter, volume or vm must be set",
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			c := &Config{}
+			_, err := c.Prepare(testConfigRaw(map[string]interface{}{"builder_source": tc.source}))
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Prepare: %s", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("Prepare error %v, want %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestStepSourceBase_filter(t *testing.T) {
+	f := newFakeHarvester(t)
+	putPublishedImages(f)
+	c := f.config(map[string]interface{}{
+		"builder_source": map[string]interface{}{
+			"filter": map[string]interface{}{
+				"labels":      map[string]string{"os": "ubuntu", "channel": "stable"},
+				"most_recent": true,
+			},
+		},
+	})
+	state := f.state(c)
+
+	if action := (&StepSourceBase{}).Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("unexpected action %v: %v", action, state.Get("error"))
+	}
+	if got := state.Get("imageName"); got != "ubuntu-2" {
+		t.Errorf("image is %v, want the newest stable image ubuntu-2", got)
+	}
+	if f.served(createImagePath) {
+		t.Error("an image was created for a filter source")
+	}
+}
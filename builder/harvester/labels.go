@@ -0,0 +1,123 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package harvester
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/rptcloud/packer-plugin-harvester/version"
+)
+
+// invalidLabelValueRegexp matches the characters not allowed in a label value.
+var invalidLabelValueRegexp = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// labelNameRegexp matches the name part of a label or annotation key, which
+// is also what a label value must look like.
+var labelNameRegexp = regexp.MustCompile(`^[A-Za-z0-9]([-A-Za-z0-9_.]*[A-Za-z0-9])?$`)
+
+// labelValue turns s into a valid label value: at most 63 characters of
+// letters, digits, '-', '_' and '.', beginning and ending with a letter or
+// digit.
+func labelValue(s string) string {
+	s = invalidLabelValueRegexp.ReplaceAllString(s, "-")
+	if len(s) > 63 {
+		s = s[:63]
+	}
+	return strings.Trim(s, "-_.")
+}
+
+// buildLabels adds the labels tying a resource to this build to labels. they
+// are added last so user labels cannot override them.
+func buildLabels(c *Config, labels map[string]string) *map[string]string {
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels[LabelBuildID] = c.buildID
+	labels[LabelBuildName] = labelValue(c.PackerBuildName)
+	labels[LabelPluginVersion] = labelValue(version.PluginVersion.FormattedVersion())
+	return &labels
+}
+
+// addUserLabels adds the user's tags, as tag.harvesterhci.io/<key> labels,
+// and labels to labels.
+func addUserLabels(labels map[string]string, tags map[string]string, extra map[string]string) {
+	for k, v := range tags {
+		labels[LabelTagPrefix+k] = v
+	}
+	for k, v := range extra {
+		labels[k] = v
+	}
+}
+
+// addUserAnnotations adds the user's annotations to annotations.
+func addUserAnnotations(annotations map[string]string, extra map[string]string) {
+	for k, v := range extra {
+		annotations[k] = v
+	}
+}
+
+// validateLabelKey checks a label or annotation key: a name of at most 63
+// letters, digits, '-', '_' and '.', optionally prefixed by a DNS subdomain
+// and '/'.
+func validateLabelKey(key string) error {
+	name := key
+	if prefix, rest, ok := strings.Cut(key, "/"); ok {
+		if len(prefix) > 253 || !objectNameRegexp.MatchString(prefix) {
+			return fmt.Errorf("%q: prefix %q is not a DNS subdomain", key, prefix)
+		}
+		name = rest
+	}
+	if len(name) > 63 || !labelNameRegexp.MatchString(name) {
+		return fmt.Errorf("%q: name must be at most 63 letters, digits, '-', '_' or '.', beginning and ending with a letter or digit", key)
+	}
+	return nil
+}
+
+// validateLabelValue checks a label value, which may be empty.
+func validateLabelValue(key string, value string) error {
+	if value != "" && (len(value) > 63 || !labelNameRegexp.MatchString(value)) {
+		return fmt.Errorf("%q: value %q must be at most 63 letters, digits, '-', '_' or '.', beginning and ending with a letter or digit", key, value)
+	}
+	return nil
+}
+
+// validateUserLabels checks the tags, labels and annotations of field, so
+// invalid ones fail the build before anything is created.
+func validateUserLabels(field string, tags map[string]string, labels map[string]string, annotations map[string]string) []error {
+	var errs []error
+	for _, k := range sortedKeys(tags) {
+		if err := validateLabelKey(LabelTagPrefix + k); err != nil {
+			errs = append(errs, fmt.Errorf("%s tags: %q is not a valid tag name", field, k))
+		}
+		if err := validateLabelValue(k, tags[k]); err != nil {
+			errs = append(errs, fmt.Errorf("%s tags: %s", field, err))
+		}
+	}
+	for _, k := range sortedKeys(labels) {
+		if err := validateLabelKey(k); err != nil {
+			errs = append(errs, fmt.Errorf("%s labels: %s", field, err))
+		}
+		if err := validateLabelValue(k, labels[k]); err != nil {
+			errs = append(errs, fmt.Errorf("%s labels: %s", field, err))
+		}
+	}
+	for _, k := range sortedKeys(annotations) {
+		if err := validateLabelKey(k); err != nil {
+			errs = append(errs, fmt.Errorf("%s annotations: %s", field, err))
+		}
+	}
+	return errs
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,113 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package harvester
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLabelValue(t *testing.T) {
+	cases := map[string]string{
+		"harvester.example":      "harvester.example",
+		"my build (ubuntu)":      "my-build-ubuntu",
+		"0.0.1-dev":              "0.0.1-dev",
+		"-leading-and-trailing-": "leading-and-trailing",
+		strings.Repeat("a", 70):  strings.Repeat("a", 63),
+	}
+	for in, want := range cases {
+		if got := labelValue(in); got != want {
+			t.Errorf("labelValue(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestBuildLabels(t *testing.T) {
+	c := &Config{buildID: "id"}
+	c.PackerBuildName = "example"
+
+	labels := map[string]string{LabelBuildID: "user"}
+	addUserLabels(labels, map[string]string{"team": "infra"}, map[string]string{"app": "web"})
+	got := *buildLabels(c, labels)
+
+	for k, want := range map[string]string{
+		LabelBuildID:               "id",
+		LabelBuildName:             "example",
+		"tag.harvesterhci.io/team": "infra",
+		"app":                      "web",
+	} {
+		if got[k] != want {
+			t.Errorf("label %s = %q, want %q", k, got[k], want)
+		}
+	}
+	if got[LabelPluginVersion] == "" {
+		t.Errorf("label %s is not set", LabelPluginVersion)
+	}
+}
+
+func TestValidateUserLabels(t *testing.T) {
+	cases := map[string]struct {
+		tags, labels, annotations map[string]string
+		wantErrs                  int
+	}{
+		"valid": {
+			tags:        map[string]string{"team": "platform"},
+			labels:      map[string]string{"app": "web", "example.com/tier": "", "os": "ubuntu_22.04"},
+			annotations: map[string]string{"example.com/note": "built by packer, any text is fine"},
+		},
+		"tag with a prefix": {
+			tags:     map[string]string{"example.com/team": "platform"},
+			wantErrs: 1,
+		},
+		"tag value with spaces": {
+			tags:     map[string]string{"team": "platform team"},
+			wantErrs: 1,
+		},
+		"label key too long": {
+			labels:   map[string]string{strings.Repeat("a", 64): "x"},
+			wantErrs: 1,
+		},
+		"label prefix not a subdomain": {
+			labels:   map[string]string{"Example_com/app": "web"},
+			wantErrs: 1,
+		},
+		"label value too long": {
+			labels:   map[string]string{"app": strings.Repeat("a", 64)},
+			wantErrs: 1,
+		},
+		"label value with a slash": {
+			labels:   map[string]string{"app": "web/api"},
+			wantErrs: 1,
+		},
+		"annotation key with spaces": {
+			annotations: map[string]string{"my note": "x"},
+			wantErrs:    1,
+		},
+		"empty keys": {
+			labels:      map[string]string{"": "x"},
+			annotations: map[string]string{"example.com/": "x"},
+			wantErrs:    2,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			errs := validateUserLabels("builder_target", tc.tags, tc.labels, tc.annotations)
+			if len(errs) != tc.wantErrs {
+				t.Errorf("got errors %v, want %d", errs, tc.wantErrs)
+			}
+		})
+	}
+}
+
+func TestConfigPrepare_invalidLabels(t *testing.T) {
+	c := &Config{}
+	_, err := c.Prepare(testConfigRaw(map[string]interface{}{
+		"builder_configuration": map[string]interface{}{
+			"labels": map[string]string{"app": "web server"},
+		},
+	}))
+	if err == nil || !strings.Contains(err.Error(), "builder_configuration labels") {
+		t.Errorf("Prepare error %v, want the invalid label reported", err)
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package harvester
+
+import (
+	"encoding/json"
+	"fmt"
+
+	harvester "github.com/drewmullen/harvester-go-sdk"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+)
+
+func vmInterfaces(c *Config) []harvester.KubevirtIoApiCoreV1Interface {
+	var interfaces []harvester.KubevirtIoApiCoreV1Interface
+	for _, nic := range c.BuilderConfiguration.NetworkInterfaces {
+		iface := harvester.KubevirtIoApiCoreV1Interface{
+			Model: toStringPtr(nic.Model),
+			Name:  nic.Name,
+		}
+		if nic.MACAddress != "" {
+			iface.MacAddress = toStringPtr(nic.MACAddress)
+		}
+		switch nic.Type {
+		case InterfaceTypeMasquerade:
+			iface.Masquerade = map[string]interface{}{}
+		default:
+			iface.Bridge = map[string]interface{}{}
+		}
+		interfaces = append(interfaces, iface)
+	}
+	return interfaces
+}
+
+func vmNetworks(c *Config) []harvester.KubevirtIoApiCoreV1Network {
+	var networks []harvester.KubevirtIoApiCoreV1Network
+	for _, nic := range c.BuilderConfiguration.NetworkInterfaces {
+		network := harvester.KubevirtIoApiCoreV1Network{
+			Name: nic.Name,
+		}
+		switch nic.Type {
+		case InterfaceTypeMasquerade:
+			network.Pod = &harvester.KubevirtIoApiCoreV1PodNetwork{}
+		default:
+			network.Multus = &harvester.KubevirtIoApiCoreV1MultusNetwork{
+				NetworkName: nic.Network,
+			}
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+// waitForLeaseInterfaceNames lists the bridge interfaces Harvester should wait
+// on a DHCP lease for, as the JSON array it expects in the VMI annotation.
+func waitForLeaseInterfaceNames(c *Config) string {
+	names := []string{}
+	for _, nic := range c.BuilderConfiguration.NetworkInterfaces {
+		if nic.Type == InterfaceTypeBridge {
+			names = append(names, nic.Name)
+		}
+	}
+	out, _ := json.Marshal(names)
+	return string(out)
+}
+
+// communicatorInterface returns the name of the interface the communicator
+// connects through.
+func communicatorInterface(c *Config) string {
+	for _, nic := range c.BuilderConfiguration.NetworkInterfaces {
+		if nic.Communicator {
+			return nic.Name
+		}
+	}
+	return ""
+}
+
+// commHost returns ssh_host or winrm_host when set, else the address
+// StepWaitForIP discovered.
+func commHost(state multistep.StateBag) (string, error) {
+	c := state.Get("config").(*Config)
+	if host := c.Comm.Host(); host != "" {
+		return host, nil
+	}
+	if ip, ok := state.GetOk("ip"); ok {
+		return ip.(string), nil
+	}
+	return "", fmt.Errorf("no IP address discovered for the builder VM")
+}
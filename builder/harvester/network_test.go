@@ -0,0 +1,196 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package harvester
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+)
+
+func TestConfigPrepare_networkInterfaces(t *testing.T) {
+	cases := map[string]struct {
+		settings map[string]interface{}
+		want     []NetworkInterface
+		wantErr  string
+	}{
+		"pod network by default": {
+			settings: map[string]interface{}{},
+			want: []NetworkInterface{
+				{Name: "nic-1", Type: InterfaceTypeMasquerade, Model: NICModelVirtio, Communicator: true},
+			},
+		},
+		"network shorthand": {
+			settings: map[string]interface{}{"network": "vlan10"},
+			want: []NetworkInterface{
+				{Name: "nic-1", Type: InterfaceTypeBridge, Network: "harvester-public/vlan10", Model: NICModelVirtio, Communicator: true},
+			},
+		},
+		"interfaces": {
+			settings: map[string]interface{}{
+				"network_namespace": "infra",
+				"network_interface": []map[string]interface{}{
+					{"network": "vlan10", "mac_address": "52:54:00:00:00:01"},
+					{"name": "pod", "type": "masquerade", "model": "e1000", "communicator": true},
+				},
+			},
+			want: []NetworkInterface{
+				{Name: "nic-1", Type: InterfaceTypeBridge, Network: "infra/vlan10", Model: NICModelVirtio, MACAddress: "52:54:00:00:00:01"},
+				{Name: "pod", Type: InterfaceTypeMasquerade, Model: "e1000", Communicator: true},
+			},
+		},
+		"duplicate names": {
+			settings: map[string]interface{}{
+				"network_interface": []map[string]interface{}{
+					{"name": "lan", "network": "a/vlan10"},
+					{"name": "lan", "network": "a/vlan20"},
+				},
+			},
+			wantErr: `network_interface[1]: name "lan" is already in use`,
+		},
+		"bridge without a network": {
+			settings: map[string]interface{}{
+				"network_interface": []map[string]interface{}{{"type": "bridge"}},
+			},
+			wantErr: "network_interface[0]: network must be set for bridge interfaces",
+		},
+		"masquerade with a network": {
+			settings: map[string]interface{}{
+				"network_interface": []map[string]interface{}{{"type": "masquerade", "network": "a/vlan10"}},
+			},
+			wantErr: "network must not be set for masquerade interfaces",
+		},
+		"unknown type": {
+			settings: map[string]interface{}{
+				"network_interface": []map[string]interface{}{{"type": "sriov", "network": "a/vlan10"}},
+			},
+			wantErr: "network_interface[0]: type must be one of",
+		},
+		"two masquerades": {
+			settings: map[string]interface{}{
+				"network_interface": []map[string]interface{}{{"type": "masquerade"}, {"type": "masquerade"}},
+			},
+			wantErr: "only one masquerade network_interface is allowed",
+		},
+		"two communicators": {
+			settings: map[string]interface{}{
+				"network_interface": []map[string]interface{}{
+					{"network": "a/vlan10", "communicator": true},
+					{"network": "a/vlan20", "communicator": true},
+				},
+			},
+			wantErr: "only one network_interface can set communicator = true",
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			c := &Config{}
+			_, err := c.Prepare(testConfigRaw(map[string]interface{}{"builder_configuration": tc.settings}))
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Errorf("Prepare error %v, want %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Prepare: %s", err)
+			}
+			got := c.BuilderConfiguration.NetworkInterfaces
+			if len(got) != len(tc.want) {
+				t.Fatalf("interfaces are %+v, want %+v", got, tc.want)
+			}
+			for i := range tc.want {
+				if got[i] != tc.want[i] {
+					t.Errorf("interface %d is %+v, want %+v", i, got[i], tc.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestVMInterfacesAndNetworks(t *testing.T) {
+	c := &Config{}
+	_, err := c.Prepare(testConfigRaw(map[string]interface{}{
+		"builder_configuration": map[string]interface{}{
+			"network_interface": []map[string]interface{}{
+				{"name": "lan", "network": "infra/vlan10", "mac_address": "52:54:00:00:00:01"},
+				{"name": "pod", "type": "masquerade", "communicator": true},
+			},
+		},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	interfaces := vmInterfaces(c)
+	if len(interfaces) != 2 {
+		t.Fatalf("got %d interfaces, want 2", len(interfaces))
+	}
+	if interfaces[0].Bridge == nil || interfaces[0].Masquerade != nil || *interfaces[0].MacAddress != "52:54:00:00:00:01" {
+		t.Errorf("lan interface is %+v, want a bridge with the MAC address", interfaces[0])
+	}
+	if interfaces[1].Masquerade == nil || interfaces[1].Bridge != nil || interfaces[1].MacAddress != nil {
+		t.Errorf("pod interface is %+v, want masquerade", interfaces[1])
+	}
+
+	networks := vmNetworks(c)
+	if len(networks) != 2 {
+		t.Fatalf("got %d networks, want 2", len(networks))
+	}
+	if networks[0].Name != "lan" || networks[0].Multus == nil || networks[0].Multus.NetworkName != "infra/vlan10" {
+		t.Errorf("lan network is %+v, want multus infra/vlan10", networks[0])
+	}
+	if networks[1].Name != "pod" || networks[1].Pod == nil {
+		t.Errorf("pod network is %+v, want the pod network", networks[1])
+	}
+
+	if got := waitForLeaseInterfaceNames(c); got != `["lan"]` {
+		t.Errorf("wait-for-lease interfaces are %s, want only the bridge", got)
+	}
+	if got := communicatorInterface(c); got != "pod" {
+		t.Errorf("communicator interface is %q, want pod", got)
+	}
+}
+
+func TestWaitForLeaseInterfaceNames_none(t *testing.T) {
+	c := &Config{}
+	if _, err := c.Prepare(testConfigRaw(nil)); err != nil {
+		t.Fatal(err)
+	}
+	if got := waitForLeaseInterfaceNames(c); got != "[]" {
+		t.Errorf("wait-for-lease interfaces are %s, want an empty list", got)
+	}
+}
+
+func TestCommHost(t *testing.T) {
+	c := &Config{}
+	if _, err := c.Prepare(testConfigRaw(nil)); err != nil {
+		t.Fatal(err)
+	}
+	state := new(multistep.BasicStateBag)
+	state.Put("config", c)
+
+	if _, err := commHost(state); err == nil {
+		t.Error("commHost succeeded before an IP was discovered")
+	}
+	state.Put("ip", "10.0.0.7")
+	if host, err := commHost(state); err != nil || host != "10.0.0.7" {
+		t.Errorf("commHost = %q, %v, want the discovered IP", host, err)
+	}
+
+	c = &Config{}
+	_, err := c.Prepare(testConfigRaw(map[string]interface{}{
+		"communicator": "ssh",
+		"ssh_username": "ubuntu",
+		"ssh_host":     "build.example.com",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	state.Put("config", c)
+	if host, err := commHost(state); err != nil || host != "build.example.com" {
+		t.Errorf("commHost = %q, %v, want ssh_host", host, err)
+	}
+}
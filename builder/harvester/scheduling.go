@@ -0,0 +1,175 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package harvester
+
+import (
+	harvester "github.com/drewmullen/harvester-go-sdk"
+)
+
+// vmAffinity builds the builder VM affinity from the configured rules, adding
+// the Harvester defaults (management network node affinity and creator pod
+// anti-affinity) when DefaultAffinity is set.
+func vmAffinity(c *Config) *harvester.K8sIoV1Affinity {
+	bc := c.BuilderConfiguration
+	affinity := &harvester.K8sIoV1Affinity{}
+
+	if bc.DefaultAffinity.True() {
+		affinity.NodeAffinity = &harvester.K8sIoV1NodeAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: &harvester.K8sIoV1NodeSelector{
+				NodeSelectorTerms: []harvester.K8sIoV1NodeSelectorTerm{
+					{
+						MatchExpressions: []harvester.K8sIoV1NodeSelectorRequirement{
+							{
+								Key:      "network.harvesterhci.io/mgmt",
+								Operator: "In",
+								Values:   []string{"true"},
+							},
+						},
+					},
+				},
+			},
+		}
+		affinity.PodAntiAffinity = &harvester.K8sIoV1PodAntiAffinity{
+			PreferredDuringSchedulingIgnoredDuringExecution: []harvester.K8sIoV1WeightedPodAffinityTerm{
+				{
+					PodAffinityTerm: harvester.K8sIoV1PodAffinityTerm{
+						LabelSelector: &harvester.K8sIoV1LabelSelector{
+							MatchExpressions: []harvester.K8sIoV1LabelSelectorRequirement{
+								{
+									Key:      "harvesterhci.io/creator",
+									Operator: "Exists",
+								},
+							},
+						},
+						TopologyKey: "kubernetes.io/hostname",
+					},
+					Weight: 100,
+				},
+			},
+		}
+	}
+
+	for _, rule := range bc.AffinityRules {
+		switch rule.Type {
+		case AffinityTypeNode:
+			if affinity.NodeAffinity == nil {
+				affinity.NodeAffinity = &harvester.K8sIoV1NodeAffinity{}
+			}
+			addNodeAffinityRule(affinity.NodeAffinity, rule)
+		case AffinityTypePod:
+			if affinity.PodAffinity == nil {
+				affinity.PodAffinity = &harvester.K8sIoV1PodAffinity{}
+			}
+			term := podAffinityTerm(rule)
+			if rule.Required {
+				affinity.PodAffinity.RequiredDuringSchedulingIgnoredDuringExecution = append(affinity.PodAffinity.RequiredDuringSchedulingIgnoredDuringExecution, term)
+			} else {
+				affinity.PodAffinity.PreferredDuringSchedulingIgnoredDuringExecution = append(affinity.PodAffinity.PreferredDuringSchedulingIgnoredDuringExecution, harvester.K8sIoV1WeightedPodAffinityTerm{
+					PodAffinityTerm: term,
+					Weight:          rule.Weight,
+				})
+			}
+		case AffinityTypePodAnti:
+			if affinity.PodAntiAffinity == nil {
+				affinity.PodAntiAffinity = &harvester.K8sIoV1PodAntiAffinity{}
+			}
+			term := podAffinityTerm(rule)
+			if rule.Required {
+				affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution = append(affinity.PodAntiAffinity.RequiredDuringSchedulingIgnoredDuringExecution, term)
+			} else {
+				affinity.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution = append(affinity.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution, harvester.K8sIoV1WeightedPodAffinityTerm{
+					PodAffinityTerm: term,
+					Weight:          rule.Weight,
+				})
+			}
+		}
+	}
+
+	if affinity.NodeAffinity == nil && affinity.PodAffinity == nil && affinity.PodAntiAffinity == nil {
+		return nil
+	}
+	return affinity
+}
+
+// addNodeAffinityRule appends a node rule to the affinity. Required rules are
+// ANDed into every node selector term so they compose with the defaults.
+func addNodeAffinityRule(nodeAffinity *harvester.K8sIoV1NodeAffinity, rule AffinityRule) {
+	requirement := harvester.K8sIoV1NodeSelectorRequirement{
+		Key:      rule.Key,
+		Operator: rule.Operator,
+		Values:   rule.Values,
+	}
+
+	if !rule.Required {
+		nodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution = append(nodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution, harvester.K8sIoV1PreferredSchedulingTerm{
+			Preference: harvester.K8sIoV1NodeSelectorTerm{
+				MatchExpressions: []harvester.K8sIoV1NodeSelectorRequirement{requirement},
+			},
+			Weight: rule.Weight,
+		})
+		return
+	}
+
+	if nodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		nodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution = &harvester.K8sIoV1NodeSelector{
+			NodeSelectorTerms: []harvester.K8sIoV1NodeSelectorTerm{{}},
+		}
+	}
+	terms := nodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+	for i := range terms {
+		terms[i].MatchExpressions = append(terms[i].MatchExpressions, requirement)
+	}
+}
+
+func podAffinityTerm(rule AffinityRule) harvester.K8sIoV1PodAffinityTerm {
+	return harvester.K8sIoV1PodAffinityTerm{
+		LabelSelector: &harvester.K8sIoV1LabelSelector{
+			MatchExpressions: []harvester.K8sIoV1LabelSelectorRequirement{
+				{
+					Key:      rule.Key,
+					Operator: rule.Operator,
+					Values:   rule.Values,
+				},
+			},
+		},
+		TopologyKey: rule.TopologyKey,
+	}
+}
+
+func vmTolerations(c *Config) []harvester.K8sIoV1Toleration {
+	var tolerations []harvester.K8sIoV1Toleration
+	for _, t := range c.BuilderConfiguration.Tolerations {
+		toleration := harvester.K8sIoV1Toleration{
+			Operator: toStringPtr(t.Operator),
+		}
+		if t.Key != "" {
+			toleration.Key = toStringPtr(t.Key)
+		}
+		if t.Value != "" {
+			toleration.Value = toStringPtr(t.Value)
+		}
+		if t.Effect != "" {
+			toleration.Effect = toStringPtr(t.Effect)
+		}
+		if t.TolerationSeconds != 0 {
+			toleration.TolerationSeconds = toInt64Ptr(t.TolerationSeconds)
+		}
+		tolerations = append(tolerations, toleration)
+	}
+	return tolerations
+}
+
+func vmNodeSelector(c *Config) *map[string]string {
+	if len(c.BuilderConfiguration.NodeSelector) == 0 {
+		return nil
+	}
+	return &c.BuilderConfiguration.NodeSelector
+}
+
+func vmPriorityClassName(c *Config) *string {
+	if c.BuilderConfiguration.PriorityClassName == "" {
+		return nil
+	}
+	return &c.BuilderConfiguration.PriorityClassName
+}
@@ -0,0 +1,199 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package harvester
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestConfigPrepare_scheduling(t *testing.T) {
+	cases := map[string]struct {
+		settings map[string]interface{}
+		wantErr  string
+	}{
+		"defaults": {
+			settings: map[string]interface{}{},
+		},
+		"rules": {
+			settings: map[string]interface{}{
+				"affinity_rules": []map[string]interface{}{
+					{"type": "node", "key": "zone", "operator": "In", "values": []string{"a"}},
+				},
+				"tolerations": []map[string]interface{}{{"key": "gpu", "effect": "NoSchedule"}},
+			},
+		},
+		"unknown rule type": {
+			settings: map[string]interface{}{
+				"affinity_rules": []map[string]interface{}{{"type": "zone", "key": "zone", "operator": "In"}},
+			},
+			wantErr: "affinity_rules[0]: type must be one of",
+		},
+		"rule without a key": {
+			settings: map[string]interface{}{
+				"affinity_rules": []map[string]interface{}{{"type": "pod", "operator": "Exists"}},
+			},
+			wantErr: "affinity_rules[0]: key must be set",
+		},
+		"rule without an operator": {
+			settings: map[string]interface{}{
+				"affinity_rules": []map[string]interface{}{{"type": "pod", "key": "app"}},
+			},
+			wantErr: "affinity_rules[0]: operator must be set",
+		},
+		"exists toleration with a value": {
+			settings: map[string]interface{}{
+				"tolerations": []map[string]interface{}{{"key": "gpu", "operator": "Exists", "value": "true"}},
+			},
+			wantErr: "tolerations[0]: value must be empty",
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			c := &Config{}
+			_, err := c.Prepare(testConfigRaw(map[string]interface{}{"builder_configuration": tc.settings}))
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Prepare: %s", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("Prepare error %v, want %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestVMAffinity_defaults(t *testing.T) {
+	c := &Config{}
+	if _, err := c.Prepare(testConfigRaw(nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	affinity := vmAffinity(c)
+	if affinity == nil {
+		t.Fatal("no affinity, want the Harvester defaults")
+	}
+	terms := affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+	if len(terms) != 1 || terms[0].MatchExpressions[0].Key != "network.harvesterhci.io/mgmt" {
+		t.Errorf("node selector terms are %+v, want the management network", terms)
+	}
+	preferred := affinity.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution
+	if len(preferred) != 1 || preferred[0].PodAffinityTerm.LabelSelector.MatchExpressions[0].Key != "harvesterhci.io/creator" {
+		t.Errorf("pod anti-affinity is %+v, want the creator default", preferred)
+	}
+}
+
+func TestVMAffinity_rules(t *testing.T) {
+	c := &Config{}
+	_, err := c.Prepare(testConfigRaw(map[string]interface{}{
+		"builder_configuration": map[string]interface{}{
+			"affinity_rules": []map[string]interface{}{
+				{"type": "node", "required": true, "key": "zone", "operator": "In", "values": []string{"a"}},
+				{"type": "node", "key": "ssd", "operator": "Exists"},
+				{"type": "pod", "required": true, "key": "app", "operator": "In", "values": []string{"db"}},
+				{"type": "pod_anti", "key": "app", "operator": "In", "values": []string{"builder"}, "weight": 50},
+			},
+		},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	affinity := vmAffinity(c)
+	if affinity == nil {
+		t.Fatal("no affinity")
+	}
+
+	terms := affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+	if len(terms) != 1 || len(terms[0].MatchExpressions) != 1 || terms[0].MatchExpressions[0].Key != "zone" {
+		t.Errorf("required node terms are %+v, want only the zone rule", terms)
+	}
+	preferredNodes := affinity.NodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution
+	if len(preferredNodes) != 1 || preferredNodes[0].Weight != 100 {
+		t.Errorf("preferred node terms are %+v, want the ssd rule with the default weight", preferredNodes)
+	}
+
+	required := affinity.PodAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+	if len(required) != 1 || required[0].TopologyKey != "kubernetes.io/hostname" {
+		t.Errorf("required pod terms are %+v, want the default topology key", required)
+	}
+
+	anti := affinity.PodAntiAffinity.PreferredDuringSchedulingIgnoredDuringExecution
+	if len(anti) != 1 || anti[0].Weight != 50 {
+		t.Errorf("pod anti-affinity is %+v, want only the configured rule", anti)
+	}
+}
+
+func TestVMAffinity_defaultsAndRules(t *testing.T) {
+	c := &Config{}
+	_, err := c.Prepare(testConfigRaw(map[string]interface{}{
+		"builder_configuration": map[string]interface{}{
+			"default_affinity": true,
+			"affinity_rules": []map[string]interface{}{
+				{"type": "node", "required": true, "key": "zone", "operator": "In", "values": []string{"a"}},
+			},
+		},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	terms := vmAffinity(c).NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+	if len(terms) != 1 || len(terms[0].MatchExpressions) != 2 {
+		t.Fatalf("node selector terms are %+v, want the rule ANDed into the default term", terms)
+	}
+	if terms[0].MatchExpressions[1].Key != "zone" {
+		t.Errorf("second requirement is %+v, want the zone rule", terms[0].MatchExpressions[1])
+	}
+}
+
+func TestVMAffinity_none(t *testing.T) {
+	c := &Config{}
+	_, err := c.Prepare(testConfigRaw(map[string]interface{}{
+		"builder_configuration": map[string]interface{}{"default_affinity": false},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if affinity := vmAffinity(c); affinity != nil {
+		t.Errorf("affinity is %+v, want none", affinity)
+	}
+}
+
+func TestVMTolerations(t *testing.T) {
+	c := &Config{}
+	_, err := c.Prepare(testConfigRaw(map[string]interface{}{
+		"builder_configuration": map[string]interface{}{
+			"tolerations": []map[string]interface{}{
+				{"key": "gpu", "value": "true", "effect": "NoSchedule"},
+				{"operator": "Exists", "toleration_seconds": 30},
+			},
+			"node_selector":       map[string]string{"gpu": "true"},
+			"priority_class_name": "builds",
+		},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tolerations := vmTolerations(c)
+	if len(tolerations) != 2 {
+		t.Fatalf("got %d tolerations, want 2", len(tolerations))
+	}
+	if *tolerations[0].Operator != "Equal" || *tolerations[0].Key != "gpu" || *tolerations[0].Effect != "NoSchedule" {
+		t.Errorf("first toleration is %+v", tolerations[0])
+	}
+	if *tolerations[1].Operator != "Exists" || tolerations[1].Key != nil || *tolerations[1].TolerationSeconds != 30 {
+		t.Errorf("second toleration is %+v", tolerations[1])
+	}
+
+	if selector := vmNodeSelector(c); selector == nil || (*selector)["gpu"] != "true" {
+		t.Errorf("node selector is %v", selector)
+	}
+	if name := vmPriorityClassName(c); name == nil || *name != "builds" {
+		t.Errorf("priority class name is %v", name)
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package harvester
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	harvester "github.com/drewmullen/harvester-go-sdk"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// StepCreateCDImage uploads the ISO built from cd_files and cd_content as a
+// temporary image and creates the volume the builder VM mounts as a CD-ROM.
+type StepCreateCDImage struct{}
+
+func (s *StepCreateCDImage) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	client := state.Get("client").(*harvester.APIClient)
+	auth := state.Get("auth").(context.Context)
+	ui := state.Get("ui").(packersdk.Ui)
+	c := state.Get("config").(*Config)
+
+	cdPath, ok := state.Get("cd_path").(string)
+	if !ok || cdPath == "" {
+		return multistep.ActionContinue
+	}
+	namespace := c.HarvesterNamespace
+
+	img := harvester.HarvesterhciIoV1beta1VirtualMachineImage{
+		ApiVersion: &ApiVersionHarvesterKey,
+		Kind:       &KindVirtualMachineImage,
+		Metadata: &harvester.K8sIoV1ObjectMeta{
+			GenerateName: toStringPtr(c.BuilderConfiguration.NamePrefix + "cd-"),
+			Namespace:    &namespace,
+			Labels: buildLabels(c, map[string]string{
+				"harvesterhci.io/image-type": ImageTypeISO,
+				"harvesterhci.io/os-type":    c.BuilderSource.OSType,
+				LabelTemporary:               "true",
+			}),
+		},
+		Spec: harvester.HarvesterhciIoV1beta1VirtualMachineImageSpec{
+			DisplayName: fmt.Sprintf("%scd-%d", c.BuilderConfiguration.NamePrefix, time.Now().UnixNano()),
+			SourceType:  ImageSourceTypeUpload,
+		},
+	}
+
+	req := client.ImagesAPI.CreateNamespacedVirtualMachineImage(auth, namespace)
+	req = req.HarvesterhciIoV1beta1VirtualMachineImage(img)
+	created, _, err := req.Execute()
+	if err != nil {
+		err := fmt.Errorf("error creating CD image: %v", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+	name := *created.Metadata.Name
+	state.Put("cdImageName", name)
+	img.Metadata.Name = &name
+
+	ui.Say(fmt.Sprintf("Uploading CD %s to image %s...", cdPath, name))
+	if err := uploadImageWithRetry(ctx, client, auth, ui, img, cdPath); err != nil {
+		err := fmt.Errorf("error uploading CD image: %v", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+	if err := waitForImageDownload(100, name, namespace, *client, auth, c.ImageImportTimeout, ui); err != nil {
+		err := fmt.Errorf("error waiting for CD image %s: %v", name, err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	volumeName, err := createImageVolume(client, auth, c, namespace, name)
+	if err != nil {
+		err := fmt.Errorf("error creating CD volume from image %s: %v", name, err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+	state.Put("cdVolumeName", volumeName)
+	ui.Say(fmt.Sprintf("CD volume %s created from image %s", volumeName, name))
+
+	return multistep.ActionContinue
+}
+
+func (s *StepCreateCDImage) Cleanup(state multistep.StateBag) {
+	client := state.Get("client").(*harvester.APIClient)
+	auth := state.Get("auth").(context.Context)
+	ui := state.Get("ui").(packersdk.Ui)
+	c := state.Get("config").(*Config)
+
+	if keepOnError(state) {
+		if volumeName, ok := state.GetOk("cdVolumeName"); ok {
+			ui.Say(fmt.Sprintf("Keeping volume %s for debugging", volumeName))
+		}
+		if imageName, ok := state.GetOk("cdImageName"); ok {
+			ui.Say(fmt.Sprintf("Keeping CD image %s for debugging", imageName))
+		}
+		return
+	}
+
+	if volumeName, ok := state.GetOk("cdVolumeName"); ok {
+		ui.Say(fmt.Sprintf("Deleting volume %s in namespace %s", volumeName, c.HarvesterNamespace))
+		if err := deleteVolume(client, auth, volumeName.(string), c.HarvesterNamespace); err != nil {
+			ui.Error(fmt.Sprintf("Error deleting volume: %v", err))
+		}
+	}
+
+	if imageName, ok := state.GetOk("cdImageName"); ok {
+		ui.Say(fmt.Sprintf("Deleting CD image %s in namespace %s", imageName, c.HarvesterNamespace))
+		if err := deleteImage(client, auth, imageName.(string), c.HarvesterNamespace); err != nil {
+			ui.Error(fmt.Sprintf("Error deleting image: %v", err))
+		}
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package harvester
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+)
+
+func TestStepCreateCDImage(t *testing.T) {
+	f := newFakeHarvester(t)
+	state := f.state(f.config(nil))
+	state.Put("cd_path", writeLocalImage(t, 4096))
+
+	step := &StepCreateCDImage{}
+	if action := step.Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("unexpected action %v: %v", action, state.Get("error"))
+	}
+
+	imageName := state.Get("cdImageName").(string)
+	image := f.get(fakeImages, "default", imageName)
+	if image == nil {
+		t.Fatalf("CD image %s was not created", imageName)
+	}
+	if got := image["spec"].(map[string]interface{})["sourceType"]; got != ImageSourceTypeUpload {
+		t.Errorf("CD image source type is %v, want %s", got, ImageSourceTypeUpload)
+	}
+	labels := fakeMeta(image)["labels"].(map[string]interface{})
+	if labels[LabelTemporary] != "true" || labels[LabelBuildID] != "test-build" {
+		t.Errorf("unexpected CD image labels %v", labels)
+	}
+	f.mu.Lock()
+	uploaded := f.uploads[imageName]
+	f.mu.Unlock()
+	if uploaded != 4096 {
+		t.Errorf("uploaded %d bytes, want 4096", uploaded)
+	}
+
+	volumeName := state.Get("cdVolumeName").(string)
+	if f.get(fakeVolumes, "default", volumeName) == nil {
+		t.Fatalf("CD volume %s was not created", volumeName)
+	}
+
+	step.Cleanup(state)
+	if f.get(fakeVolumes, "default", volumeName) != nil || f.get(fakeImages, "default", imageName) != nil {
+		t.Errorf("CD volume %s or image %s left behind after cleanup", volumeName, imageName)
+	}
+}
+
+func TestStepCreateCDImage_noCD(t *testing.T) {
+	f := newFakeHarvester(t)
+	state := f.state(f.config(nil))
+
+	step := &StepCreateCDImage{}
+	if action := step.Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("unexpected action %v: %v", action, state.Get("error"))
+	}
+	step.Cleanup(state)
+	if names := f.names(fakeImages); len(names) != 0 {
+		t.Errorf("unexpected images %v", names)
+	}
+}
+
+func TestStepCreateCDImage_keepOnError(t *testing.T) {
+	f := newFakeHarvester(t)
+	state := f.state(f.config(map[string]interface{}{"keep_vm_on_error": true}))
+	state.Put("cd_path", writeLocalImage(t, 4096))
+
+	step := &StepCreateCDImage{}
+	if action := step.Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("unexpected action %v: %v", action, state.Get("error"))
+	}
+	state.Put(multistep.StateHalted, true)
+
+	step.Cleanup(state)
+	if f.get(fakeImages, "default", state.Get("cdImageName").(string)) == nil {
+		t.Error("CD image deleted despite keep_vm_on_error")
+	}
+}
+
+func TestStepCreateCDImage_createFailed(t *testing.T) {
+	f := newFakeHarvester(t)
+	f.fail["POST "+fakeImages] = http.StatusForbidden
+	state := f.state(f.config(nil))
+	state.Put("cd_path", writeLocalImage(t, 4096))
+
+	if action := (&StepCreateCDImage{}).Run(context.Background(), state); action != multistep.ActionHalt {
+		t.Fatalf("unexpected action %v, want a failed create to halt the build", action)
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package harvester
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	harvester "github.com/drewmullen/harvester-go-sdk"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
+)
+
+// the secret used for cloud-init when no user_data or network_data is given
+const defaultCloudInitSecret = "packer"
+
+type cloudInitTemplateData struct {
+	HTTPIP   string
+	HTTPPort int
+}
+
+// StepCreateCloudInit renders user_data and network_data and stores them in a
+// secret the builder VM's cloud-init disk points at.
+type StepCreateCloudInit struct{}
+
+func (s *StepCreateCloudInit) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	client := state.Get("client").(*harvester.APIClient)
+	auth := state.Get("auth").(context.Context)
+	ui := state.Get("ui").(packersdk.Ui)
+	c := state.Get("config").(*Config)
+
+	if c.UserData == "" && c.NetworkData == "" {
+		state.Put("cloudInitSecretName", defaultCloudInitSecret)
+		return multistep.ActionContinue
+	}
+
+	c.ctx.Data = &cloudInitTemplateData{
+		HTTPIP:   state.Get("http_ip").(string),
+		HTTPPort: state.Get("http_port").(int),
+	}
+	data := map[string]string{}
+	for key, value := range map[string]string{"userdata": c.UserData, "networkdata": c.NetworkData} {
+		rendered, err := interpolate.Render(value, &c.ctx)
+		if err != nil {
+			err := fmt.Errorf("error rendering cloud-init %s: %s", key, err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+		data[key] = rendered
+	}
+
+	name, err := createSecret(ctx, client, auth, c.BuilderConfiguration.NamePrefix+"cloudinit-", c.HarvesterNamespace, *buildLabels(c, nil), data)
+	if err != nil {
+		err := fmt.Errorf("error creating cloud-init secret: %s", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+	ui.Say(fmt.Sprintf("Created cloud-init secret %s", name))
+	state.Put("cloudInitSecretName", name)
+	state.Put("createdCloudInitSecret", true)
+
+	return multistep.ActionContinue
+}
+
+func (s *StepCreateCloudInit) Cleanup(state multistep.StateBag) {
+	if created, _ := state.Get("createdCloudInitSecret").(bool); !created {
+		return
+	}
+	client := state.Get("client").(*harvester.APIClient)
+	auth := state.Get("auth").(context.Context)
+	ui := state.Get("ui").(packersdk.Ui)
+	c := state.Get("config").(*Config)
+	name := state.Get("cloudInitSecretName").(string)
+
+	if keepOnError(state) {
+		ui.Say(fmt.Sprintf("Keeping cloud-init secret %s for debugging", name))
+		return
+	}
+
+	ui.Say(fmt.Sprintf("Deleting cloud-init secret %s", name))
+	if err := deleteSecret(context.Background(), client, auth, name, c.HarvesterNamespace); err != nil {
+		ui.Error(fmt.Sprintf("Error deleting cloud-init secret %s: %s", name, err))
+	}
+}
+
+// createSecret creates an opaque secret with a generated name and returns
+// that name. the SDK has no API for core resources.
+func createSecret(ctx context.Context, client *harvester.APIClient, auth context.Context, generateName string, namespace string, labels map[string]string, data map[string]string) (string, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata": map[string]interface{}{
+			"generateName": generateName,
+			"namespace":    namespace,
+			"labels":       labels,
+		},
+		"type":       "Opaque",
+		"stringData": data,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	req, err := rawRequest(ctx, client, auth, http.MethodPost, fmt.Sprintf("/api/v1/namespaces/%s/secrets", namespace), bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := doRawRequest(client, req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var secret struct {
+		Metadata struct {
+			Name string `json:"name"`
+		} `json:"metadata"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&secret); err != nil {
+		return "", err
+	}
+	return secret.Metadata.Name, nil
+}
+
+func deleteSecret(ctx context.Context, client *harvester.APIClient, auth context.Context, name string, namespace string) error {
+	req, err := rawRequest(ctx, client, auth, http.MethodDelete, fmt.Sprintf("/api/v1/namespaces/%s/secrets/%s", namespace, name), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := doRawRequest(client, req)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
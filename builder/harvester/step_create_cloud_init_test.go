@@ -0,0 +1,84 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package harvester
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+)
+
+func TestStepCreateCloudInit(t *testing.T) {
+	f := newFakeHarvester(t)
+	c := f.config(map[string]interface{}{
+		"user_data": "#cloud-config\nbootcmd:\n  - curl http://{{ .HTTPIP }}:{{ .HTTPPort }}/ks.cfg\n",
+	})
+	state := f.state(c)
+	state.Put("http_ip", "10.0.0.1")
+	state.Put("http_port", 8080)
+
+	step := &StepCreateCloudInit{}
+	if action := step.Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("unexpected action %v: %v", action, state.Get("error"))
+	}
+
+	name := state.Get("cloudInitSecretName").(string)
+	secret := f.get(fakeSecrets, "default", name)
+	if secret == nil {
+		t.Fatalf("secret %s was not created", name)
+	}
+	want := "#cloud-config\nbootcmd:\n  - curl http://10.0.0.1:8080/ks.cfg\n"
+	if got := secret["stringData"].(map[string]interface{})["userdata"]; got != want {
+		t.Errorf("userdata is %q, want %q", got, want)
+	}
+	if labels := fakeMeta(secret)["labels"].(map[string]interface{}); labels[LabelBuildID] != "test-build" {
+		t.Errorf("unexpected secret labels %v", labels)
+	}
+
+	step.Cleanup(state)
+	if f.get(fakeSecrets, "default", name) != nil {
+		t.Errorf("secret %s left behind after cleanup", name)
+	}
+}
+
+func TestStepCreateCloudInit_default(t *testing.T) {
+	f := newFakeHarvester(t)
+	f.put(fakeSecrets, "default", fakeObject{"metadata": map[string]interface{}{"name": defaultCloudInitSecret}})
+	state := f.state(f.config(nil))
+
+	step := &StepCreateCloudInit{}
+	if action := step.Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("unexpected action %v: %v", action, state.Get("error"))
+	}
+	if got := state.Get("cloudInitSecretName"); got != defaultCloudInitSecret {
+		t.Errorf("cloudInitSecretName is %v, want %s", got, defaultCloudInitSecret)
+	}
+	// the default secret is not the build's to delete
+	step.Cleanup(state)
+	if f.get(fakeSecrets, "default", defaultCloudInitSecret) == nil {
+		t.Errorf("cleanup deleted the shared secret %s", defaultCloudInitSecret)
+	}
+}
+
+func TestStepCreateCloudInit_keepOnError(t *testing.T) {
+	f := newFakeHarvester(t)
+	state := f.state(f.config(map[string]interface{}{
+		"user_data":        "#cloud-config\n",
+		"keep_vm_on_error": true,
+	}))
+	state.Put("http_ip", "10.0.0.1")
+	state.Put("http_port", 8080)
+
+	step := &StepCreateCloudInit{}
+	if action := step.Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("unexpected action %v: %v", action, state.Get("error"))
+	}
+	state.Put(multistep.StateHalted, true)
+
+	step.Cleanup(state)
+	if name := state.Get("cloudInitSecretName").(string); f.get(fakeSecrets, "default", name) == nil {
+		t.Errorf("secret %s deleted despite keep_vm_on_error", name)
+	}
+}
@@ -6,6 +6,7 @@ package harvester
 import (
 	"context"
 	"fmt"
+	"math/rand"
 	"time"
 
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
@@ -26,23 +27,26 @@ func (s *StepCreateVM) Run(_ context.Context, state multistep.StateBag) multiste
 	auth := state.Get("auth").(context.Context)
 	ui := state.Get("ui").(packersdk.Ui)
 	c := state.Get("config").(*Config)
-	volName := state.Get("volumeName").(string)
+	volumes := builderVolumesFromState(state)
 
-	vm := vmTemplate(c, volName)
+	vm := vmTemplate(c, vmName(c.BuilderConfiguration.NamePrefix), volumes)
 
 	req := client.VirtualMachinesAPI.CreateNamespacedVirtualMachine(auth, c.HarvesterNamespace)
 
 	req = req.KubevirtIoApiCoreV1VirtualMachine(*vm)
 	vm, _, err := client.VirtualMachinesAPI.CreateNamespacedVirtualMachineExecute(req)
 
-	// TODO: Gracefully fail if VM with name already exists
 	if err != nil {
-		ui.Error(fmt.Sprintf("Error creating VM: %v", err))
+		err := fmt.Errorf("error creating VM: %v", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
 	}
 
-	// could use generateName
-	if vm.Metadata.Name == nil {
-		ui.Error("VM name is nil")
+	if vm.Metadata == nil || vm.Metadata.Name == nil {
+		err := fmt.Errorf("VM name is nil")
+		state.Put("error", err)
+		ui.Error(err.Error())
 		return multistep.ActionHalt
 	}
 	name := *vm.Metadata.Name
@@ -51,9 +55,10 @@ func (s *StepCreateVM) Run(_ context.Context, state multistep.StateBag) multiste
 	ui.Say(fmt.Sprintf("Creating builder VM. Name is %v", name))
 	ui.Say(fmt.Sprintf("Waiting for VM, %v, to report as \"Running\"", name))
 
-	timeout := 2 * time.Minute
+	timeout := c.VMStartTimeout
 	desiredState := "Running"
-	time.Sleep(3 * time.Second)
+	// give KubeVirt a moment to create the VMI
+	time.Sleep(pollInterval)
 	err = waitForVMState(desiredState, name, c.HarvesterNamespace, *client, auth, timeout, ui)
 
 	if err != nil {
@@ -82,6 +87,13 @@ func (s *StepCreateVM) Cleanup(state multistep.StateBag) {
 		return
 	}
 	name := state.Get("Name").(string)
+
+	if keepOnError(state) {
+		ui.Say(fmt.Sprintf("keep_vm_on_error is set, keeping VM %s in namespace %s for debugging", name, c.HarvesterNamespace))
+		ui.Say(fmt.Sprintf("Connect to its serial console with: virtctl console %s -n %s", name, c.HarvesterNamespace))
+		return
+	}
+
 	delReq := client.VirtualMachinesAPI.DeleteNamespacedVirtualMachine(auth, name, c.HarvesterNamespace)
 	delReq = delReq.K8sIoV1DeleteOptions(harvester.K8sIoV1DeleteOptions{})
 
@@ -98,110 +110,110 @@ func (s *StepCreateVM) Cleanup(state multistep.StateBag) {
 
 }
 
-func vmTemplate(c *Config, volName string) *harvester.KubevirtIoApiCoreV1VirtualMachine {
+// builderVolumes are the volumes created for the builder VM by earlier steps
+type builderVolumes struct {
+	Root string
+	ISO  string
+	// the volume holding the ISO built from cd_files and cd_content
+	CD string
+	// the volume holding the virtio drivers when virtio_drivers_image is set
+	VirtioDrivers string
+	Disks         []diskVolume
+	// the secret holding cloud-init user and network data
+	CloudInit string
+}
+
+func builderVolumesFromState(state multistep.StateBag) builderVolumes {
+	volumes := builderVolumes{
+		Root: state.Get("volumeName").(string),
+	}
+	volumes.ISO, _ = state.Get("isoVolumeName").(string)
+	volumes.CD, _ = state.Get("cdVolumeName").(string)
+	volumes.VirtioDrivers, _ = state.Get("virtioDriversVolumeName").(string)
+	volumes.Disks, _ = state.Get("diskVolumes").([]diskVolume)
+	volumes.CloudInit, _ = state.Get("cloudInitSecretName").(string)
+	if volumes.CloudInit == "" {
+		volumes.CloudInit = defaultCloudInitSecret
+	}
+	return volumes
+}
+
+// vmNameChars are the characters Kubernetes generates name suffixes from.
+const vmNameChars = "bcdfghjklmnpqrstvwxz2456789"
+
+// vmName returns prefix followed by a random suffix, as generateName would.
+// the name is picked before the VM is created so the VM template can carry it
+// in the harvesterhci.io/vmName label.
+func vmName(prefix string) string {
+	suffix := make([]byte, 5)
+	for i := range suffix {
+		suffix[i] = vmNameChars[rand.Intn(len(vmNameChars))]
+	}
+	return prefix + string(suffix)
+}
+
+func vmTemplate(c *Config, name string, volumes builderVolumes) *harvester.KubevirtIoApiCoreV1VirtualMachine {
+	annotations := map[string]string{
+		"harvesterhci.io/vmRunStrategy":            "RerunOnFailure",
+		"kubevirt.io/latest-observed-api-version":  "v1",
+		"kubevirt.io/storage-observed-api-version": "v1alpha3",
+		"network.harvesterhci.io/ips":              "[]",
+	}
+	addUserAnnotations(annotations, c.BuilderConfiguration.Annotations)
+	labels := map[string]string{
+		"harvesterhci.io/creator": "packer-plugin-harvester",
+	}
+	addUserLabels(labels, c.BuilderConfiguration.Tags, c.BuilderConfiguration.Labels)
+	guestLabels(c, labels)
+
 	return &harvester.KubevirtIoApiCoreV1VirtualMachine{
 		ApiVersion: &ApiVersionKubevirt,
 		Kind:       &KindVirtualMachine,
 		Metadata: &harvester.K8sIoV1ObjectMeta{
-			Annotations: &map[string]string{
-				"harvesterhci.io/vmRunStrategy":            "RerunOnFailure",
-				"kubevirt.io/latest-observed-api-version":  "v1",
-				"kubevirt.io/storage-observed-api-version": "v1alpha3",
-				"network.harvesterhci.io/ips":              "[]",
-			},
-			Labels: &map[string]string{
-				"harvesterhci.io/creator":      "harvester",
-				"harvesterhci.io/os":           "linux",
-				"harvesterhci.io/vmName":       "runner",
-				"tag.harvesterhci.io/ssh-user": "ubuntu",
-			},
-			GenerateName: &c.BuilderConfiguration.NamePrefix,
-			Namespace:    &c.BuilderConfiguration.Namespace,
+			Annotations: &annotations,
+			Labels:      buildLabels(c, labels),
+			Name:        &name,
+			Namespace:   &c.BuilderConfiguration.Namespace,
 		},
 		Spec: harvester.KubevirtIoApiCoreV1VirtualMachineSpec{
 			RunStrategy: &VirtualMachineSpecRunStrategy,
 			Template: harvester.KubevirtIoApiCoreV1VirtualMachineInstanceTemplateSpec{
 				Metadata: &harvester.K8sIoV1ObjectMeta{
 					Annotations: &map[string]string{
-						"harvesterhci.io/waitForLeaseInterfaceNames": "[\"nic-1\"]",
-					},
-					Labels: &map[string]string{
-						"harvesterhci.io/creator":      "packer-plugin-terraform",
-						"harvesterhci.io/vmName":       "test",
-						"tag.harvesterhci.io/ssh-user": "ubuntu",
+						"harvesterhci.io/waitForLeaseInterfaceNames": waitForLeaseInterfaceNames(c),
 					},
+					Labels: buildLabels(c, *guestLabels(c, map[string]string{
+						"harvesterhci.io/creator": "packer-plugin-harvester",
+						"harvesterhci.io/vmName":  name,
+					})),
 				},
 				Spec: &harvester.KubevirtIoApiCoreV1VirtualMachineInstanceSpec{
-					Affinity: &harvester.K8sIoV1Affinity{
-						NodeAffinity: &harvester.K8sIoV1NodeAffinity{
-							RequiredDuringSchedulingIgnoredDuringExecution: &harvester.K8sIoV1NodeSelector{
-								NodeSelectorTerms: []harvester.K8sIoV1NodeSelectorTerm{
-									{
-										MatchExpressions: []harvester.K8sIoV1NodeSelectorRequirement{
-											{
-												Key:      "network.harvesterhci.io/mgmt",
-												Operator: "In",
-												Values:   []string{"true"},
-											},
-										},
-									},
-								},
-							},
-						},
-						PodAntiAffinity: &harvester.K8sIoV1PodAntiAffinity{
-							PreferredDuringSchedulingIgnoredDuringExecution: []harvester.K8sIoV1WeightedPodAffinityTerm{
-								{
-									PodAffinityTerm: harvester.K8sIoV1PodAffinityTerm{
-										LabelSelector: &harvester.K8sIoV1LabelSelector{
-											MatchExpressions: []harvester.K8sIoV1LabelSelectorRequirement{
-												{
-													Key:      "harvesterhci.io/creator",
-													Operator: "Exists",
-												},
-											},
-										},
-										TopologyKey: "kubernetes.io/hostname",
-									},
-									Weight: 100,
-								},
-							},
-						},
-					},
+					Affinity: vmAffinity(c),
 					Domain: harvester.KubevirtIoApiCoreV1DomainSpec{
 						Cpu: &harvester.KubevirtIoApiCoreV1CPU{
 							Cores: &c.BuilderConfiguration.CPU,
 						},
 						Devices: harvester.KubevirtIoApiCoreV1Devices{
-							Disks: []harvester.KubevirtIoApiCoreV1Disk{
+							Disks: append([]harvester.KubevirtIoApiCoreV1Disk{
 								{
-									BootOrder: toInt32Ptr(1),
+									BootOrder: toInt32Ptr(rootDiskBootOrder),
 									Disk: &harvester.KubevirtIoApiCoreV1DiskTarget{
-										Bus: toStringPtr("virtio"),
+										Bus: toStringPtr(c.BuilderConfiguration.RootDiskBus),
 									},
 									Name: "rootdisk",
 								},
 								{
 									Disk: &harvester.KubevirtIoApiCoreV1DiskTarget{
-										Bus: toStringPtr("virtio"),
+										Bus: toStringPtr(cloudInitDiskBus(c)),
 									},
 									Name: "cloudinitdisk",
 								},
-							},
-							Interfaces: []harvester.KubevirtIoApiCoreV1Interface{
-								{
-									Bridge:     map[string]interface{}{},
-									MacAddress: toStringPtr("1e:31:ed:d3:83:9c"),
-									Model:      toStringPtr("virtio"),
-									Name:       "nic-1",
-								},
-							},
-						},
-						Features: &harvester.KubevirtIoApiCoreV1Features{
-							Acpi: &harvester.KubevirtIoApiCoreV1FeatureState{},
-							Smm: &harvester.KubevirtIoApiCoreV1FeatureState{
-								Enabled: toBoolPtr(true),
-							},
+							}, append(vmCDROMDisks(c, volumes), vmDataDisks(volumes.Disks)...)...),
+							Inputs:     vmInputs(c),
+							Interfaces: vmInterfaces(c),
 						},
+						Clock:    vmClock(c),
+						Features: vmFeatures(c),
 						Firmware: &harvester.KubevirtIoApiCoreV1Firmware{
 							Bootloader: &harvester.KubevirtIoApiCoreV1Bootloader{
 								Efi: &harvester.KubevirtIoApiCoreV1EFI{
@@ -218,42 +230,50 @@ func vmTemplate(c *Config, volName string) *harvester.KubevirtIoApiCoreV1Virtual
 							},
 						},
 					},
-					EvictionStrategy: toStringPtr("LiveMigrate"),
-					Hostname:         toStringPtr("test"),
-					Networks: []harvester.KubevirtIoApiCoreV1Network{
-						{
-							Multus: &harvester.KubevirtIoApiCoreV1MultusNetwork{
-								NetworkName: fmt.Sprintf("%s/%s", c.BuilderConfiguration.NetworkNamespace, c.BuilderConfiguration.Network),
-							},
-							Name: "nic-1",
-						},
-					},
+					EvictionStrategy:              toStringPtr("LiveMigrate"),
+					Hostname:                      toStringPtr("test"),
+					NodeSelector:                  vmNodeSelector(c),
+					PriorityClassName:             vmPriorityClassName(c),
+					Networks:                      vmNetworks(c),
 					TerminationGracePeriodSeconds: toInt64Ptr(120),
-					Volumes: []harvester.KubevirtIoApiCoreV1Volume{
+					Tolerations:                   vmTolerations(c),
+					Volumes: append([]harvester.KubevirtIoApiCoreV1Volume{
 						{
 							Name: "rootdisk",
 							PersistentVolumeClaim: &harvester.KubevirtIoApiCoreV1PersistentVolumeClaimVolumeSource{
-								ClaimName: volName,
+								ClaimName: volumes.Root,
 							},
 						},
 						{
 							CloudInitNoCloud: &harvester.KubevirtIoApiCoreV1CloudInitNoCloudSource{
 								NetworkDataSecretRef: &harvester.K8sIoV1LocalObjectReference{
-									Name: toStringPtr("packer"),
+									Name: toStringPtr(volumes.CloudInit),
 								},
 								SecretRef: &harvester.K8sIoV1LocalObjectReference{
-									Name: toStringPtr("packer"),
+									Name: toStringPtr(volumes.CloudInit),
 								},
 							},
 							Name: "cloudinitdisk",
 						},
-					},
+					}, append(vmCDROMVolumes(c, volumes), vmDataVolumes(volumes.Disks)...)...),
 				},
 			},
 		},
 	}
 }
 
+// keepOnError reports whether keep_vm_on_error applies: the build failed or
+// was cancelled and the builder resources should be left for debugging.
+func keepOnError(state multistep.StateBag) bool {
+	c := state.Get("config").(*Config)
+	if !c.KeepVMOnError {
+		return false
+	}
+	_, halted := state.GetOk(multistep.StateHalted)
+	_, cancelled := state.GetOk(multistep.StateCancelled)
+	return halted || cancelled
+}
+
 func toStringPtr(s string) *string {
 	return &s
 }
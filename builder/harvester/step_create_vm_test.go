@@ -0,0 +1,194 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package harvester
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+func TestStepCreateVM(t *testing.T) {
+	f := newFakeHarvester(t)
+	c := f.config(nil)
+	state := f.state(c)
+	state.Put("volumeName", "packer-root")
+
+	step := &StepCreateVM{}
+	if action := step.Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("unexpected action %v: %v", action, state.Get("error"))
+	}
+
+	name := state.Get("Name").(string)
+	vm := f.get(fakeVMs, "default", name)
+	if vm == nil {
+		t.Fatalf("VM %s was not created", name)
+	}
+	labels := fakeMeta(vm)["labels"].(map[string]interface{})
+	if labels[LabelBuildID] != "test-build" {
+		t.Errorf("unexpected VM labels %v", labels)
+	}
+	template := vm["spec"].(map[string]interface{})["template"].(map[string]interface{})
+	templateLabels := fakeMeta(template)["labels"].(map[string]interface{})
+	if templateLabels["harvesterhci.io/vmName"] != name || templateLabels[LabelBuildID] != "test-build" {
+		t.Errorf("unexpected VM template labels %v", templateLabels)
+	}
+	if f.get(fakeVMIs, "default", name) == nil {
+		t.Fatalf("VMI %s was not started", name)
+	}
+
+	step.Cleanup(state)
+	if f.get(fakeVMs, "default", name) != nil || f.get(fakeVMIs, "default", name) != nil {
+		t.Errorf("VM %s left behind after cleanup", name)
+	}
+}
+
+func TestStepCreateVM_keepOnError(t *testing.T) {
+	f := newFakeHarvester(t)
+	c := f.config(map[string]interface{}{"keep_vm_on_error": true})
+	state := f.state(c)
+	state.Put("volumeName", "packer-root")
+
+	step := &StepCreateVM{}
+	if action := step.Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("unexpected action %v: %v", action, state.Get("error"))
+	}
+	state.Put(multistep.StateHalted, true)
+	var out bytes.Buffer
+	state.Put("ui", &packersdk.BasicUi{Writer: &out, ErrorWriter: io.Discard})
+
+	step.Cleanup(state)
+	name := state.Get("Name").(string)
+	if f.get(fakeVMs, "default", name) == nil {
+		t.Errorf("VM %s deleted despite keep_vm_on_error", name)
+	}
+	if want := "virtctl console " + name + " -n default"; !strings.Contains(out.String(), want) {
+		t.Errorf("output %q does not include %q", out.String(), want)
+	}
+}
+
+func TestKeepOnError(t *testing.T) {
+	cases := map[string]struct {
+		keep     bool
+		stateKey string
+		wantKeep bool
+	}{
+		"halted":              {keep: true, stateKey: multistep.StateHalted, wantKeep: true},
+		"cancelled":           {keep: true, stateKey: multistep.StateCancelled, wantKeep: true},
+		"succeeded":           {keep: true},
+		"halted without keep": {stateKey: multistep.StateHalted},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			state := new(multistep.BasicStateBag)
+			state.Put("config", &Config{KeepVMOnError: tc.keep})
+			if tc.stateKey != "" {
+				state.Put(tc.stateKey, true)
+			}
+			if got := keepOnError(state); got != tc.wantKeep {
+				t.Errorf("keepOnError = %v, want %v", got, tc.wantKeep)
+			}
+		})
+	}
+}
+
+func TestStepCreateVM_createFailed(t *testing.T) {
+	f := newFakeHarvester(t)
+	c := f.config(nil)
+	f.fail["POST "+fakeVMs] = http.StatusUnprocessableEntity
+	state := f.state(c)
+	state.Put("volumeName", "packer-root")
+
+	step := &StepCreateVM{}
+	if action := step.Run(context.Background(), state); action != multistep.ActionHalt {
+		t.Fatalf("unexpected action %v, want a failed create to halt the build", action)
+	}
+	if _, ok := state.GetOk("error"); !ok {
+		t.Error("no error in state")
+	}
+	// cleanup must cope with the VM never having been created
+	step.Cleanup(state)
+}
+
+func TestStepCreateVM_startTimeout(t *testing.T) {
+	f := newFakeHarvester(t)
+	// the VMI never gets past scheduling
+	f.onRead[fakeVMIs] = func(obj fakeObject) {
+		obj["status"].(map[string]interface{})["phase"] = "Scheduling"
+	}
+	state := f.state(f.config(map[string]interface{}{"vm_start_timeout": "20ms"}))
+	state.Put("volumeName", "packer-root")
+
+	step := &StepCreateVM{}
+	if action := step.Run(context.Background(), state); action != multistep.ActionHalt {
+		t.Fatalf("unexpected action %v, want the VM start to time out", action)
+	}
+
+	step.Cleanup(state)
+	if name := state.Get("Name").(string); f.get(fakeVMs, "default", name) != nil {
+		t.Errorf("VM %s left behind after cleanup", name)
+	}
+}
+
+func TestVMName(t *testing.T) {
+	name := vmName("packer-")
+	if !strings.HasPrefix(name, "packer-") || len(name) != len("packer-")+5 {
+		t.Fatalf("vmName is %q, want packer- and a 5 character suffix", name)
+	}
+	if !objectNameRegexp.MatchString(name) {
+		t.Errorf("vmName %q is not a valid object name", name)
+	}
+}
+
+func TestStepCreateVM_iso(t *testing.T) {
+	f := newFakeHarvester(t)
+	c := f.config(map[string]interface{}{
+		"builder_source": map[string]interface{}{"name": "rhel9", "url": fakeImageURL, "image_type": ImageTypeISO},
+	})
+	state := f.state(c)
+	state.Put("volumeName", "packer-root")
+	state.Put("isoVolumeName", "packer-rhel9")
+
+	if action := (&StepCreateVM{}).Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("unexpected action %v: %v", action, state.Get("error"))
+	}
+
+	vm := f.get(fakeVMs, "default", state.Get("Name").(string))
+	spec := vm["spec"].(map[string]interface{})["template"].(map[string]interface{})["spec"].(map[string]interface{})
+	disks := map[string]map[string]interface{}{}
+	for _, d := range spec["domain"].(map[string]interface{})["devices"].(map[string]interface{})["disks"].([]interface{}) {
+		disk := d.(map[string]interface{})
+		disks[disk["name"].(string)] = disk
+	}
+	if got := disks["rootdisk"]["bootOrder"]; got != float64(1) {
+		t.Errorf("root disk boot order is %v, want 1", got)
+	}
+	cdrom := disks["cdrom"]
+	if cdrom == nil {
+		t.Fatalf("no cdrom disk in %v", disks)
+	}
+	if got := cdrom["bootOrder"]; got != float64(2) {
+		t.Errorf("cdrom boot order is %v, want 2 so the installed system boots once installed", got)
+	}
+	if got := cdrom["cdrom"].(map[string]interface{})["bus"]; got != DiskBusSata {
+		t.Errorf("cdrom bus is %v, want %s", got, DiskBusSata)
+	}
+
+	claims := map[string]string{}
+	for _, v := range spec["volumes"].([]interface{}) {
+		volume := v.(map[string]interface{})
+		if pvc, ok := volume["persistentVolumeClaim"].(map[string]interface{}); ok {
+			claims[volume["name"].(string)] = pvc["claimName"].(string)
+		}
+	}
+	if claims["cdrom"] != "packer-rhel9" || claims["rootdisk"] != "packer-root" {
+		t.Errorf("volume claims are %v, want the ISO on cdrom and the root volume on rootdisk", claims)
+	}
+}
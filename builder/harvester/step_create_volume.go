@@ -26,34 +26,74 @@ func (s *StepCreateVolume) Run(_ context.Context, state multistep.StateBag) mult
 	ui := state.Get("ui").(packersdk.Ui)
 	c := state.Get("config").(*Config)
 
+	if sourceVolume, ok := state.GetOk("sourceVolumeName"); ok {
+		ui.Say(fmt.Sprintf("Cloning volume %s...", sourceVolume))
+		volumeName, err := cloneVolume(client, auth, c, sourceVolume.(string))
+		if err != nil {
+			err := fmt.Errorf("error cloning volume %s: %v", sourceVolume, err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+		state.Put("volumeName", volumeName)
+		ui.Say(fmt.Sprintf("Volume %s cloned from %s", volumeName, sourceVolume))
+		return s.createDisks(state)
+	}
+
+	imageName := state.Get("imageName").(string)
+
+	if c.BuilderSource.ImageType == ImageTypeISO {
+		return s.createInstallVolumes(state, imageName)
+	}
+
+	// the volume is filled from the image's backing image, which only exists
+	// in the image's storage class
+	storageClass, err := imageStorageClassName(client, auth, imageName, c.HarvesterNamespace)
+	if err != nil {
+		err := fmt.Errorf("error resolving storage class of image %s: %v", imageName, err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+	if c.BuilderTarget.StorageClass != "" && c.BuilderTarget.StorageClass != storageClass {
+		err := fmt.Errorf("builder_target storage_class %q cannot be used with image %s/%s, a volume created from the image must use its storage class %q", c.BuilderTarget.StorageClass, c.HarvesterNamespace, imageName, storageClass)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
 	req := client.VolumesAPI.CreateNamespacedPersistentVolumeClaim(auth, c.HarvesterNamespace)
 
 	claimInput := &harvester.K8sIoV1PersistentVolumeClaim{
 		Metadata: &harvester.K8sIoV1ObjectMeta{
 			GenerateName: &c.BuilderConfiguration.NamePrefix,
 			Annotations: &map[string]string{
-				"harvesterhci.io/imageId": fmt.Sprintf("%s/%s", c.HarvesterNamespace, c.BuilderSource.Name),
+				"harvesterhci.io/imageId": fmt.Sprintf("%s/%s", c.HarvesterNamespace, imageName),
 			},
+			Labels: buildLabels(c, nil),
 		},
 		Spec: &harvester.K8sIoV1PersistentVolumeClaimSpec{
-			AccessModes: []string{"ReadWriteMany"},
+			AccessModes: c.BuilderTarget.AccessModes,
 			Resources: &harvester.K8sIoV1ResourceRequirements{
 				Requests: map[string]string{
 					"storage": c.BuilderTarget.VolumeSize,
 				},
 			},
-			StorageClassName: toStringPtr(GetImageStorageClassName(c.BuilderSource.Name)),
-			VolumeMode:       toStringPtr("Block"),
+			StorageClassName: toStringPtr(storageClass),
+			VolumeMode:       toStringPtr(c.BuilderTarget.VolumeMode),
 		},
 	}
 	req = req.K8sIoV1PersistentVolumeClaim(*claimInput)
 	claim, _, err := req.Execute()
 
 	if err != nil {
-		ui.Error(fmt.Sprintf("Error creating volume: %v", err))
+		err := fmt.Errorf("error creating volume: %v", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
 	}
 
-	if claim.Metadata.Name == nil || *claim.Metadata.Name == "" {
+	if claim.Metadata == nil || claim.Metadata.Name == nil || *claim.Metadata.Name == "" {
 		ui.Error("Volume name is empty")
 		return multistep.ActionHalt
 	}
@@ -61,6 +101,73 @@ func (s *StepCreateVolume) Run(_ context.Context, state multistep.StateBag) mult
 
 	ui.Say(fmt.Sprintf("Volume %s created and ready for use", *claim.Metadata.Name))
 
+	return s.createDisks(state)
+}
+
+// createInstallVolumes creates the volumes of an installer build: a volume of
+// the ISO image, attached as a CD-ROM, and a blank root volume to install to.
+func (s *StepCreateVolume) createInstallVolumes(state multistep.StateBag, imageName string) multistep.StepAction {
+	client := state.Get("client").(*harvester.APIClient)
+	auth := state.Get("auth").(context.Context)
+	ui := state.Get("ui").(packersdk.Ui)
+	c := state.Get("config").(*Config)
+
+	isoVolumeName, err := createImageVolume(client, auth, c, c.HarvesterNamespace, imageName)
+	if err != nil {
+		err := fmt.Errorf("error creating volume for image %s: %v", imageName, err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+	state.Put("isoVolumeName", isoVolumeName)
+	ui.Say(fmt.Sprintf("Volume %s created for ISO image %s", isoVolumeName, imageName))
+
+	storageClass := c.BuilderTarget.StorageClass
+	if storageClass == "" {
+		storageClass = StorageClassName
+	}
+	root := Disk{
+		Name:         "rootdisk",
+		Size:         c.BuilderTarget.VolumeSize,
+		StorageClass: storageClass,
+		VolumeMode:   c.BuilderTarget.VolumeMode,
+	}
+	volumeName, err := createBlankVolume(client, auth, c, root, c.BuilderTarget.AccessModes)
+	if err != nil {
+		err := fmt.Errorf("error creating root volume: %v", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+	state.Put("volumeName", volumeName)
+	ui.Say(fmt.Sprintf("Volume %s created and ready for use", volumeName))
+
+	return s.createDisks(state)
+}
+
+// createDisks creates a blank volume for each additional disk.
+func (s *StepCreateVolume) createDisks(state multistep.StateBag) multistep.StepAction {
+	client := state.Get("client").(*harvester.APIClient)
+	auth := state.Get("auth").(context.Context)
+	ui := state.Get("ui").(packersdk.Ui)
+	c := state.Get("config").(*Config)
+
+	disks := []diskVolume{}
+	for _, disk := range c.BuilderConfiguration.Disks {
+		volumeName, err := createBlankVolume(client, auth, c, disk, []string{AccessModeReadWriteMany})
+		if err != nil {
+			err := fmt.Errorf("error creating volume for disk %s: %v", disk.Name, err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+		disks = append(disks, diskVolume{Disk: disk, VolumeName: volumeName})
+		state.Put("diskVolumes", disks)
+
+		ui.Say(fmt.Sprintf("Volume %s created for disk %s", volumeName, disk.Name))
+	}
+	state.Put("diskVolumes", disks)
+
 	// Determines that should continue to the next step
 	return multistep.ActionContinue
 }
@@ -75,19 +182,124 @@ func (s *StepCreateVolume) Cleanup(state multistep.StateBag) {
 	ui := state.Get("ui").(packersdk.Ui)
 	c := state.Get("config").(*Config)
 
+	if keepOnError(state) {
+		for _, key := range []string{"volumeName", "isoVolumeName"} {
+			if name, ok := state.GetOk(key); ok {
+				ui.Say(fmt.Sprintf("Keeping volume %s for debugging", name))
+			}
+		}
+		if disks, ok := state.GetOk("diskVolumes"); ok {
+			for _, d := range disks.([]diskVolume) {
+				ui.Say(fmt.Sprintf("Keeping volume %s for debugging", d.VolumeName))
+			}
+		}
+		return
+	}
+
+	if disks, ok := state.GetOk("diskVolumes"); ok {
+		for _, d := range disks.([]diskVolume) {
+			ui.Say(fmt.Sprintf("Deleting volume %s in namespace %s", d.VolumeName, c.HarvesterNamespace))
+			if err := deleteVolume(client, auth, d.VolumeName, c.HarvesterNamespace); err != nil {
+				ui.Error(fmt.Sprintf("Error deleting volume: %v", err))
+			}
+		}
+	}
+
+	if isoVolumeName, ok := state.GetOk("isoVolumeName"); ok {
+		ui.Say(fmt.Sprintf("Deleting volume %s in namespace %s", isoVolumeName, c.HarvesterNamespace))
+		if err := deleteVolume(client, auth, isoVolumeName.(string), c.HarvesterNamespace); err != nil {
+			ui.Error(fmt.Sprintf("Error deleting volume: %v", err))
+		}
+	}
+
+	if state.Get("volumeName") == nil {
+		return
+	}
 	volumeName := state.Get("volumeName").(string)
 
 	ui.Say(fmt.Sprintf("Deleting volume %s in namespace %s", volumeName, c.HarvesterNamespace))
 
-	req := client.VolumesAPI.DeleteNamespacedPersistentVolumeClaim(auth, volumeName, c.HarvesterNamespace)
-	req = req.K8sIoV1DeleteOptions(harvester.K8sIoV1DeleteOptions{})
-	_, _, err := req.Execute()
+	err := deleteVolume(client, auth, volumeName, c.HarvesterNamespace)
 
 	if err != nil {
 		ui.Error(fmt.Sprintf("Error deleting volume: %v", err))
 	}
 }
 
-func GetImageStorageClassName(imageName string) string {
-	return fmt.Sprintf("longhorn-%s", imageName)
+// imageStorageClassName returns the storage class Harvester created for the
+// image, which volumes cloned from the image must use.
+func imageStorageClassName(client *harvester.APIClient, auth context.Context, imageName string, namespace string) (string, error) {
+	req := client.ImagesAPI.ReadNamespacedVirtualMachineImage(auth, imageName, namespace)
+	image, _, err := req.Execute()
+	if err != nil {
+		return "", err
+	}
+	return storageClassOfImage(image)
+}
+
+// storageClassOfImage returns the storage class the image reports.
+func storageClassOfImage(image *harvester.HarvesterhciIoV1beta1VirtualMachineImage) (string, error) {
+	if image.Status == nil || !image.Status.HasStorageClassName() || *image.Status.StorageClassName == "" {
+		return "", fmt.Errorf("image %s does not report a storage class yet", imageRef(image))
+	}
+	return *image.Status.StorageClassName, nil
+}
+
+// imageRef returns "<namespace>/<name>" of the image for messages.
+func imageRef(image *harvester.HarvesterhciIoV1beta1VirtualMachineImage) string {
+	if image.Metadata == nil || image.Metadata.Name == nil {
+		return image.Spec.DisplayName
+	}
+	if image.Metadata.Namespace == nil {
+		return *image.Metadata.Name
+	}
+	return fmt.Sprintf("%s/%s", *image.Metadata.Namespace, *image.Metadata.Name)
+}
+
+// createImageVolume creates a volume holding an unmodified copy of the image,
+// sized to the image, as Harvester does for CD-ROM volumes.
+func createImageVolume(client *harvester.APIClient, auth context.Context, c *Config, imageNamespace string, imageName string) (string, error) {
+	readReq := client.ImagesAPI.ReadNamespacedVirtualMachineImage(auth, imageName, imageNamespace)
+	image, _, err := readReq.Execute()
+	if err != nil {
+		return "", err
+	}
+	storageClass, err := storageClassOfImage(image)
+	if err != nil {
+		return "", err
+	}
+	if image.Status.Size == nil || *image.Status.Size == 0 {
+		return "", fmt.Errorf("image %s does not report a size yet", imageRef(image))
+	}
+
+	claimInput := &harvester.K8sIoV1PersistentVolumeClaim{
+		Metadata: &harvester.K8sIoV1ObjectMeta{
+			GenerateName: toStringPtr(fmt.Sprintf("%s%s-", c.BuilderConfiguration.NamePrefix, imageName)),
+			Annotations: &map[string]string{
+				"harvesterhci.io/imageId": fmt.Sprintf("%s/%s", imageNamespace, imageName),
+			},
+			Labels: buildLabels(c, nil),
+		},
+		Spec: &harvester.K8sIoV1PersistentVolumeClaimSpec{
+			AccessModes: []string{AccessModeReadWriteMany},
+			Resources: &harvester.K8sIoV1ResourceRequirements{
+				Requests: map[string]string{
+					"storage": fmt.Sprintf("%d", *image.Status.Size),
+				},
+			},
+			StorageClassName: toStringPtr(storageClass),
+			VolumeMode:       toStringPtr(VolumeModeBlock),
+		},
+	}
+
+	req := client.VolumesAPI.CreateNamespacedPersistentVolumeClaim(auth, c.HarvesterNamespace)
+	req = req.K8sIoV1PersistentVolumeClaim(*claimInput)
+	claim, _, err := req.Execute()
+	if err != nil {
+		return "", err
+	}
+	if claim == nil || claim.Metadata == nil || claim.Metadata.Name == nil || *claim.Metadata.Name == "" {
+		return "", fmt.Errorf("volume name is empty")
+	}
+	return *claim.Metadata.Name, nil
 }
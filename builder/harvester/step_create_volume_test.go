@@ -0,0 +1,323 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package harvester
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+)
+
+func TestStepCreateVolume(t *testing.T) {
+	f := newFakeHarvester(t)
+	c := f.config(map[string]interface{}{
+		"builder_configuration": map[string]interface{}{
+			"disk": []map[string]interface{}{
+				{"name": "data", "size": "10Gi"},
+			},
+		},
+	})
+	f.put(fakeImages, "default", fakeImage("focal", "focal", importedStatus("focal")))
+	state := f.state(c)
+	state.Put("imageName", "focal")
+
+	step := &StepCreateVolume{}
+	if action := step.Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("unexpected action %v: %v", action, state.Get("error"))
+	}
+
+	root := f.get(fakeVolumes, "default", state.Get("volumeName").(string))
+	if root == nil {
+		t.Fatal("root volume was not created")
+	}
+	spec := root["spec"].(map[string]interface{})
+	if got := spec["storageClassName"]; got != "longhorn-focal" {
+		t.Errorf("root volume storage class is %v, want the image's longhorn-focal", got)
+	}
+	annotations := fakeMeta(root)["annotations"].(map[string]interface{})
+	if got := annotations["harvesterhci.io/imageId"]; got != "default/focal" {
+		t.Errorf("root volume imageId is %v, want default/focal", got)
+	}
+	disks := state.Get("diskVolumes").([]diskVolume)
+	if len(disks) != 1 || f.get(fakeVolumes, "default", disks[0].VolumeName) == nil {
+		t.Fatalf("data disk volume was not created: %v", disks)
+	}
+
+	step.Cleanup(state)
+	if names := f.names(fakeVolumes); len(names) != 0 {
+		t.Errorf("volumes %v left behind after cleanup", names)
+	}
+}
+
+func TestStepCreateVolume_keepOnError(t *testing.T) {
+	f := newFakeHarvester(t)
+	c := f.config(map[string]interface{}{"keep_vm_on_error": true})
+	f.put(fakeImages, "default", fakeImage("focal", "focal", importedStatus("focal")))
+	state := f.state(c)
+	state.Put("imageName", "focal")
+
+	step := &StepCreateVolume{}
+	if action := step.Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("unexpected action %v: %v", action, state.Get("error"))
+	}
+	state.Put(multistep.StateHalted, true)
+
+	step.Cleanup(state)
+	if names := f.names(fakeVolumes); len(names) != 1 {
+		t.Errorf("volumes %v after cleanup, want the root volume kept", names)
+	}
+}
+
+func TestStepCreateVolume_createFailed(t *testing.T) {
+	f := newFakeHarvester(t)
+	c := f.config(nil)
+	f.put(fakeImages, "default", fakeImage("focal", "focal", importedStatus("focal")))
+	f.fail["POST "+fakeVolumes] = http.StatusForbidden
+	state := f.state(c)
+	state.Put("imageName", "focal")
+
+	if action := (&StepCreateVolume{}).Run(context.Background(), state); action != multistep.ActionHalt {
+		t.Fatalf("unexpected action %v, want a failed create to halt the build", action)
+	}
+	if _, ok := state.GetOk("error"); !ok {
+		t.Error("no error in state")
+	}
+}
+
+func TestStorageClassOfImage(t *testing.T) {
+	image := fakeImage("virtio-win", "virtio-win.iso", importedStatus("virtio-win"))
+	fakeMeta(image)["namespace"] = "isos"
+	imported := sdkImage(t, image)
+	got, err := storageClassOfImage(&imported)
+	if err != nil || got != "longhorn-virtio-win" {
+		t.Errorf("storageClassOfImage = %q, %v, want longhorn-virtio-win", got, err)
+	}
+
+	image = fakeImage("virtio-win", "virtio-win.iso", map[string]interface{}{"progress": 10})
+	fakeMeta(image)["namespace"] = "isos"
+	importing := sdkImage(t, image)
+	_, err = storageClassOfImage(&importing)
+	if err == nil || !strings.Contains(err.Error(), "isos/virtio-win") {
+		t.Errorf("error %v does not name the image as isos/virtio-win", err)
+	}
+}
+
+func TestConfigPrepare_rootVolume(t *testing.T) {
+	cases := map[string]struct {
+		settings         map[string]interface{}
+		wantAccessModes  []string
+		wantVolumeMode   string
+		wantStorageClass string
+		wantErr          string
+	}{
+		"defaults": {
+			settings:        map[string]interface{}{},
+			wantAccessModes: []string{AccessModeReadWriteMany},
+			wantVolumeMode:  VolumeModeBlock,
+		},
+		"configured": {
+			settings: map[string]interface{}{
+				"storage_class": "ssd",
+				"access_modes":  []string{AccessModeReadWriteOnce},
+				"volume_mode":   VolumeModeFilesystem,
+			},
+			wantAccessModes:  []string{AccessModeReadWriteOnce},
+			wantVolumeMode:   VolumeModeFilesystem,
+			wantStorageClass: "ssd",
+		},
+		"unknown access mode": {
+			settings: map[string]interface{}{"access_modes": []string{"ReadWriteSometimes"}},
+			wantErr:  `unknown access mode "ReadWriteSometimes"`,
+		},
+		"unknown volume mode": {
+			settings: map[string]interface{}{"volume_mode": "block"},
+			wantErr:  "builder_target volume_mode must be",
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			c := &Config{}
+			_, err := c.Prepare(testConfigRaw(map[string]interface{}{"builder_target": tc.settings}))
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Errorf("Prepare error %v, want %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Prepare: %s", err)
+			}
+			if got := strings.Join(c.BuilderTarget.AccessModes, ","); got != strings.Join(tc.wantAccessModes, ",") {
+				t.Errorf("access modes are %s, want %v", got, tc.wantAccessModes)
+			}
+			if c.BuilderTarget.VolumeMode != tc.wantVolumeMode {
+				t.Errorf("volume mode is %q, want %q", c.BuilderTarget.VolumeMode, tc.wantVolumeMode)
+			}
+			if c.BuilderTarget.StorageClass != tc.wantStorageClass {
+				t.Errorf("storage class is %q, want %q", c.BuilderTarget.StorageClass, tc.wantStorageClass)
+			}
+		})
+	}
+}
+
+func TestStepCreateVolume_rootVolumeOptions(t *testing.T) {
+	f := newFakeHarvester(t)
+	c := f.config(map[string]interface{}{
+		"builder_target": map[string]interface{}{
+			"storage_class": "longhorn-focal",
+			"access_modes":  []string{AccessModeReadWriteOnce},
+			"volume_mode":   VolumeModeFilesystem,
+		},
+	})
+	f.put(fakeImages, "default", fakeImage("focal", "focal", importedStatus("focal")))
+	state := f.state(c)
+	state.Put("imageName", "focal")
+
+	if action := (&StepCreateVolume{}).Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("unexpected action %v: %v", action, state.Get("error"))
+	}
+
+	spec := f.get(fakeVolumes, "default", state.Get("volumeName").(string))["spec"].(map[string]interface{})
+	if got := spec["storageClassName"]; got != "longhorn-focal" {
+		t.Errorf("storage class is %v, want the image's longhorn-focal", got)
+	}
+	if got := spec["volumeMode"]; got != VolumeModeFilesystem {
+		t.Errorf("volume mode is %v, want %s", got, VolumeModeFilesystem)
+	}
+	if got, _ := spec["accessModes"].([]interface{}); len(got) != 1 || got[0] != AccessModeReadWriteOnce {
+		t.Errorf("access modes are %v, want [%s]", spec["accessModes"], AccessModeReadWriteOnce)
+	}
+}
+
+func TestStepCreateVolume_imageNotImported(t *testing.T) {
+	f := newFakeHarvester(t)
+	c := f.config(nil)
+	f.put(fakeImages, "default", fakeImage("focal", "focal", map[string]interface{}{"progress": 10}))
+	state := f.state(c)
+	state.Put("imageName", "focal")
+
+	if action := (&StepCreateVolume{}).Run(context.Background(), state); action != multistep.ActionHalt {
+		t.Fatalf("unexpected action %v, want a missing storage class to halt the build", action)
+	}
+	if err := state.Get("error").(error); !strings.Contains(err.Error(), "default/focal") {
+		t.Errorf("error %v does not name the image", err)
+	}
+}
+
+func TestStepCreateVolume_iso(t *testing.T) {
+	f := newFakeHarvester(t)
+	c := f.config(map[string]interface{}{
+		"builder_source": map[string]interface{}{"name": "rhel9", "url": fakeImageURL, "image_type": ImageTypeISO},
+		"builder_target": map[string]interface{}{"volume_size": "40Gi"},
+	})
+	f.put(fakeImages, "default", fakeImage("rhel9", "rhel9", importedStatus("rhel9")))
+	state := f.state(c)
+	state.Put("imageName", "rhel9")
+
+	step := &StepCreateVolume{}
+	if action := step.Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("unexpected action %v: %v", action, state.Get("error"))
+	}
+
+	iso := f.get(fakeVolumes, "default", state.Get("isoVolumeName").(string))
+	if iso == nil {
+		t.Fatal("ISO volume was not created")
+	}
+	isoSpec := iso["spec"].(map[string]interface{})
+	if got := isoSpec["storageClassName"]; got != "longhorn-rhel9" {
+		t.Errorf("ISO volume storage class is %v, want the image's longhorn-rhel9", got)
+	}
+	if got := isoSpec["resources"].(map[string]interface{})["requests"].(map[string]interface{})["storage"]; got != "1073741824" {
+		t.Errorf("ISO volume size is %v, want the image size", got)
+	}
+	if got := fakeMeta(iso)["annotations"].(map[string]interface{})["harvesterhci.io/imageId"]; got != "default/rhel9" {
+		t.Errorf("ISO volume imageId is %v, want default/rhel9", got)
+	}
+
+	root := f.get(fakeVolumes, "default", state.Get("volumeName").(string))
+	if root == nil {
+		t.Fatal("root volume was not created")
+	}
+	rootSpec := root["spec"].(map[string]interface{})
+	if got := rootSpec["storageClassName"]; got != StorageClassName {
+		t.Errorf("root volume storage class is %v, want the blank %s", got, StorageClassName)
+	}
+	if got := rootSpec["resources"].(map[string]interface{})["requests"].(map[string]interface{})["storage"]; got != "40Gi" {
+		t.Errorf("root volume size is %v, want volume_size 40Gi", got)
+	}
+	if annotations, _ := fakeMeta(root)["annotations"].(map[string]interface{}); annotations["harvesterhci.io/imageId"] != nil {
+		t.Error("root volume of an installer build is backed by the image")
+	}
+
+	step.Cleanup(state)
+	if names := f.names(fakeVolumes); len(names) != 0 {
+		t.Errorf("volumes %v left behind after cleanup", names)
+	}
+}
+
+func TestStepCreateVolume_isoNotImported(t *testing.T) {
+	f := newFakeHarvester(t)
+	c := f.config(map[string]interface{}{
+		"builder_source": map[string]interface{}{"name": "rhel9", "url": fakeImageURL, "image_type": ImageTypeISO},
+	})
+	f.put(fakeImages, "default", fakeImage("rhel9", "rhel9", map[string]interface{}{"progress": 10, "storageClassName": "longhorn-rhel9"}))
+	state := f.state(c)
+	state.Put("imageName", "rhel9")
+
+	if action := (&StepCreateVolume{}).Run(context.Background(), state); action != multistep.ActionHalt {
+		t.Fatalf("unexpected action %v, want an image without a size to halt the build", action)
+	}
+	if err := state.Get("error").(error); !strings.Contains(err.Error(), "default/rhel9 does not report a size") {
+		t.Errorf("error %v, want the missing size reported", err)
+	}
+	if names := f.names(fakeVolumes); len(names) != 0 {
+		t.Errorf("volumes %v created for an image without a size", names)
+	}
+}
+
+func TestStepCreateVolume_storageClassMismatch(t *testing.T) {
+	f := newFakeHarvester(t)
+	c := f.config(map[string]interface{}{
+		"builder_target": map[string]interface{}{"storage_class": "ssd"},
+	})
+	f.put(fakeImages, "default", fakeImage("focal", "focal", importedStatus("focal")))
+	state := f.state(c)
+	state.Put("imageName", "focal")
+
+	if action := (&StepCreateVolume{}).Run(context.Background(), state); action != multistep.ActionHalt {
+		t.Fatalf("unexpected action %v, want a storage class other than the image's to halt the build", action)
+	}
+	if err := state.Get("error").(error); !strings.Contains(err.Error(), `"longhorn-focal"`) {
+		t.Errorf("error %v does not name the image's storage class", err)
+	}
+	if names := f.names(fakeVolumes); len(names) != 0 {
+		t.Errorf("volumes %v created with the wrong storage class", names)
+	}
+}
+
+func TestStepCreateVolume_isoStorageClass(t *testing.T) {
+	f := newFakeHarvester(t)
+	c := f.config(map[string]interface{}{
+		"builder_source": map[string]interface{}{"name": "rhel9", "url": fakeImageURL, "image_type": ImageTypeISO},
+		"builder_target": map[string]interface{}{"storage_class": "ssd"},
+	})
+	f.put(fakeImages, "default", fakeImage("rhel9", "rhel9", importedStatus("rhel9")))
+	state := f.state(c)
+	state.Put("imageName", "rhel9")
+
+	if action := (&StepCreateVolume{}).Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("unexpected action %v: %v", action, state.Get("error"))
+	}
+	iso := f.get(fakeVolumes, "default", state.Get("isoVolumeName").(string))["spec"].(map[string]interface{})
+	if got := iso["storageClassName"]; got != "longhorn-rhel9" {
+		t.Errorf("ISO volume storage class is %v, want the image's longhorn-rhel9", got)
+	}
+	root := f.get(fakeVolumes, "default", state.Get("volumeName").(string))["spec"].(map[string]interface{})
+	if got := root["storageClassName"]; got != "ssd" {
+		t.Errorf("root volume storage class is %v, want storage_class ssd", got)
+	}
+}
@@ -27,51 +27,148 @@ func (s *StepExportVMImage) Run(_ context.Context, state multistep.StateBag) mul
 	ui := state.Get("ui").(packersdk.Ui)
 	c := state.Get("config").(*Config)
 
-	// temp for hardcoded payload
-	// vmBody := []byte(vmStr)
-	// vmObj := &harvester.KubevirtIoApiCoreV1VirtualMachine{}
-	// json.Unmarshal(vmBody, vmObj)
-
-	req := client.VirtualMachinesAPI.CreateNamespacedVirtualMachine(auth, c.HarvesterNamespace)
-
-	// req = req.KubevirtIoApiCoreV1VirtualMachine(*vmObj)
-	vm, _, err := client.VirtualMachinesAPI.CreateNamespacedVirtualMachineExecute(req)
+	// a running guest can still write to the volumes while they are copied,
+	// StepShutdown stops the VM before the export
+	if name, ok := state.GetOk("Name"); ok {
+		stopped, err := vmiStopped(client, auth, name.(string), c.HarvesterNamespace)
+		if err != nil {
+			err := fmt.Errorf("error checking that VM %s is stopped: %v", name, err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+		if !stopped {
+			err := fmt.Errorf("VM %s is still running, its volumes cannot be exported consistently", name)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+	}
 
-	if err != nil {
-		ui.Error(fmt.Sprintf("Error creating VM: %v", err))
+	volName := state.Get("volumeName").(string)
+	disks, _ := state.Get("diskVolumes").([]diskVolume)
+
+	exports := []diskVolume{
+		{
+			Disk: Disk{
+				Name:        "rootdisk",
+				DisplayName: c.BuilderTarget.DisplayName,
+			},
+			VolumeName: volName,
+		},
+	}
+	for _, d := range disks {
+		if d.Disk.Export {
+			exports = append(exports, d)
+		}
 	}
 
-	// could use generateName
-	if vm.Metadata.Name == nil {
-		ui.Error("VM name is nil")
-		return multistep.ActionHalt
+	images := []Image{}
+	for _, export := range exports {
+		ui.Say(fmt.Sprintf("Exporting volume %s as image %s...", export.VolumeName, export.Disk.DisplayName))
+
+		image, err := exportVolume(client, auth, c, export)
+		if err != nil {
+			err := fmt.Errorf("error exporting volume %s: %v", export.VolumeName, err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+		images = append(images, image)
+		state.Put("exportedImages", images)
+
+		timeout := 30 * time.Minute
+		err = waitForImageDownload(int32(100), image.Name, image.Namespace, *client, auth, timeout, ui)
+		if err != nil {
+			err := fmt.Errorf("error waiting for image, %v, to finish exporting: %v", image.Name, err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+
+		ui.Say(fmt.Sprintf("Export complete for image %s/%s (%s)", image.Namespace, image.Name, image.DisplayName))
 	}
-	name := *vm.Metadata.Name
-	state.Put("Name", *vm.Metadata.Name)
 
-	ui.Say(fmt.Sprintf("Creating builder VM. Name is %v", name))
-	ui.Say(fmt.Sprintf("Waiting for VM, %v, to report as \"Running\"", name))
+	return multistep.ActionContinue
+}
 
-	timeout := 2 * time.Minute
-	desiredState := "Running"
-	time.Sleep(3 * time.Second)
-	err = waitForVMState(desiredState, name, c.HarvesterNamespace, *client, auth, timeout, ui)
+// Cleanup can be used to clean up any artifact created by the step.
+// A step's clean up always run at the end of a build, regardless of whether provisioning succeeds or fails.
+func (s *StepExportVMImage) Cleanup(state multistep.StateBag) {
+	_, cancelled := state.GetOk(multistep.StateCancelled)
+	_, halted := state.GetOk(multistep.StateHalted)
+	if !cancelled && !halted {
+		return
+	}
 
-	if err != nil {
-		err := fmt.Errorf("error waiting for vm, %v, to become %v: %s", name, desiredState, err)
-		state.Put("error", err)
-		ui.Error(err.Error())
-		return multistep.ActionHalt
+	images, ok := state.Get("exportedImages").([]Image)
+	if !ok {
+		return
 	}
 
-	ui.Say("VM created and ready for use")
+	client := state.Get("client").(*harvester.APIClient)
+	auth := state.Get("auth").(context.Context)
+	ui := state.Get("ui").(packersdk.Ui)
 
-	// Determines that should continue to the next step
-	return multistep.ActionContinue
+	// a failed build must not leave partially exported images behind
+	for _, image := range images {
+		ui.Say(fmt.Sprintf("Deleting incomplete image %s/%s", image.Namespace, image.Name))
+		req := client.ImagesAPI.DeleteNamespacedVirtualMachineImage(auth, image.Name, image.Namespace)
+		req = req.K8sIoV1DeleteOptions(harvester.K8sIoV1DeleteOptions{})
+		if _, _, err := req.Execute(); err != nil {
+			ui.Error(fmt.Sprintf("Error deleting image: %v", err))
+		}
+	}
 }
 
-// Cleanup can be used to clean up any artifact created by the step.
-// A step's clean up always run at the end of a build, regardless of whether provisioning succeeds or fails.
-func (s *StepExportVMImage) Cleanup(_ multistep.StateBag) {
-	// Nothing to clean
+// exportVolume creates a VirtualMachineImage backed by the volume. Unlike the
+// PVC export action, creating the image directly gives us its name so the
+// export progress can be tracked.
+func exportVolume(client *harvester.APIClient, auth context.Context, c *Config, export diskVolume) (Image, error) {
+	namespace := c.BuilderTarget.Namespace
+	annotations := map[string]string{
+		"harvesterhci.io/storageClassName": StorageClassName,
+	}
+	labels := map[string]string{
+		"harvesterhci.io/image-type": "raw_qcow2",
+	}
+	if c.BuilderSource.OSType != "" {
+		labels["harvesterhci.io/os-type"] = c.BuilderSource.OSType
+	}
+	addUserLabels(labels, c.BuilderTarget.Tags, c.BuilderTarget.Labels)
+	addUserAnnotations(annotations, c.BuilderTarget.Annotations)
+
+	img := &harvester.HarvesterhciIoV1beta1VirtualMachineImage{
+		ApiVersion: &ApiVersionHarvesterKey,
+		Kind:       &KindVirtualMachineImage,
+		Metadata: &harvester.K8sIoV1ObjectMeta{
+			GenerateName: toStringPtr("image-"),
+			Annotations:  &annotations,
+			Labels:       buildLabels(c, labels),
+			Namespace:    &namespace,
+		},
+		Spec: harvester.HarvesterhciIoV1beta1VirtualMachineImageSpec{
+			DisplayName:  export.Disk.DisplayName,
+			SourceType:   ImageSourceTypeExportFromVolume,
+			PvcName:      toStringPtr(export.VolumeName),
+			PvcNamespace: toStringPtr(c.HarvesterNamespace),
+		},
+	}
+
+	req := client.ImagesAPI.CreateNamespacedVirtualMachineImage(auth, namespace)
+	req = req.HarvesterhciIoV1beta1VirtualMachineImage(*img)
+	created, _, err := req.Execute()
+	if err != nil {
+		return Image{}, err
+	}
+	if created == nil || created.Metadata == nil || created.Metadata.Name == nil {
+		return Image{}, fmt.Errorf("image name is nil")
+	}
+
+	return Image{
+		Name:        *created.Metadata.Name,
+		Namespace:   namespace,
+		DisplayName: export.Disk.DisplayName,
+		Disk:        export.Disk.Name,
+	}, nil
 }
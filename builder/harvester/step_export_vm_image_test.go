@@ -0,0 +1,118 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package harvester
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+)
+
+func TestStepExportVMImage(t *testing.T) {
+	f := newFakeHarvester(t)
+	c := f.config(map[string]interface{}{
+		"builder_target": map[string]interface{}{
+			"display_name": "focal-golden",
+			"tags":         map[string]string{"team": "platform"},
+		},
+	})
+	state := f.state(c)
+	state.Put("volumeName", "packer-root")
+	state.Put("diskVolumes", []diskVolume{
+		{Disk: Disk{Name: "data", DisplayName: "focal-golden-data", Export: true}, VolumeName: "packer-data"},
+		{Disk: Disk{Name: "scratch"}, VolumeName: "packer-scratch"},
+	})
+
+	step := &StepExportVMImage{}
+	if action := step.Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("unexpected action %v: %v", action, state.Get("error"))
+	}
+
+	images := state.Get("exportedImages").([]Image)
+	if len(images) != 2 {
+		t.Fatalf("exported %v, want the root and data disks", images)
+	}
+	for i, want := range []string{"packer-root", "packer-data"} {
+		image := f.get(fakeImages, "default", images[i].Name)
+		if image == nil {
+			t.Fatalf("image %s was not created", images[i].Name)
+		}
+		if got := image["spec"].(map[string]interface{})["pvcName"]; got != want {
+			t.Errorf("image %s exports %v, want %s", images[i].Name, got, want)
+		}
+		labels := fakeMeta(image)["labels"].(map[string]interface{})
+		if labels[LabelBuildID] != "test-build" || labels[LabelTagPrefix+"team"] != "platform" {
+			t.Errorf("unexpected labels %v on image %s", labels, images[i].Name)
+		}
+		if _, ok := labels[LabelTemporary]; ok {
+			t.Errorf("exported image %s is labeled temporary", images[i].Name)
+		}
+	}
+
+	// the images are the artifact of a successful build
+	step.Cleanup(state)
+	if names := f.names(fakeImages); len(names) != 2 {
+		t.Errorf("images %v after cleanup, want both kept", names)
+	}
+}
+
+func TestStepExportVMImage_exportFailed(t *testing.T) {
+	f := newFakeHarvester(t)
+	f.onCreate[fakeImages] = func(obj fakeObject) {
+		obj["status"] = map[string]interface{}{
+			"progress": 30,
+			"conditions": []interface{}{
+				map[string]interface{}{"type": "RetryLimitExceeded", "status": "True", "message": "volume detached"},
+			},
+		}
+	}
+	state := f.state(f.config(nil))
+	state.Put("volumeName", "packer-root")
+
+	step := &StepExportVMImage{}
+	if action := step.Run(context.Background(), state); action != multistep.ActionHalt {
+		t.Fatalf("unexpected action %v, want the failed export to halt the build", action)
+	}
+	state.Put(multistep.StateHalted, true)
+
+	step.Cleanup(state)
+	if names := f.names(fakeImages); len(names) != 0 {
+		t.Errorf("incomplete images %v left behind after cleanup", names)
+	}
+}
+
+func TestStepExportVMImage_vmRunning(t *testing.T) {
+	f := newFakeHarvester(t)
+	f.putRunningVM("default", "packer-vm")
+	state := f.state(f.config(nil))
+	state.Put("Name", "packer-vm")
+	state.Put("volumeName", "packer-root")
+
+	if action := (&StepExportVMImage{}).Run(context.Background(), state); action != multistep.ActionHalt {
+		t.Fatalf("unexpected action %v, want exporting a running VM to halt the build", action)
+	}
+	if names := f.names(fakeImages); len(names) != 0 {
+		t.Errorf("images %v exported from a running VM", names)
+	}
+}
+
+func TestStepExportVMImage_vmStopped(t *testing.T) {
+	f := newFakeHarvester(t)
+	f.putRunningVM("default", "packer-vm")
+	// the VMI of a stopped VM is gone
+	f.mu.Lock()
+	delete(f.objects, fakeKey(fakeVMIs, "default", "packer-vm"))
+	f.mu.Unlock()
+	state := f.state(f.config(nil))
+	state.Put("Name", "packer-vm")
+	state.Put("volumeName", "packer-root")
+
+	if action := (&StepExportVMImage{}).Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("unexpected action %v: %v", action, state.Get("error"))
+	}
+	if images := state.Get("exportedImages").([]Image); len(images) != 1 || images[0].DisplayName != "packer-test-build" {
+		t.Errorf("exported %v, want the root disk as packer-test-build", images)
+	}
+}
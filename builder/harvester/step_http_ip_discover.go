@@ -0,0 +1,103 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package harvester
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// StepHTTPIPDiscover works out the address the builder VM should use to reach
+// the Packer HTTP server. the VM sits on a Harvester network, so localhost or
+// the bind address are rarely right.
+type StepHTTPIPDiscover struct{}
+
+func (s *StepHTTPIPDiscover) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	ui := state.Get("ui").(packersdk.Ui)
+	c := state.Get("config").(*Config)
+
+	if c.HTTPDir == "" && len(c.HTTPContent) == 0 {
+		state.Put("http_ip", "")
+		return multistep.ActionContinue
+	}
+
+	ip, err := httpIP(c)
+	if err != nil {
+		err := fmt.Errorf("error discovering the HTTP server address: %s", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+	state.Put("http_ip", ip)
+
+	return multistep.ActionContinue
+}
+
+func (s *StepHTTPIPDiscover) Cleanup(state multistep.StateBag) {}
+
+func httpIP(c *Config) (string, error) {
+	if c.HTTPIP != "" {
+		return c.HTTPIP, nil
+	}
+	if c.HTTPInterface != "" {
+		return interfaceIP(c.HTTPInterface)
+	}
+	if ip := net.ParseIP(c.HTTPAddress); ip != nil && !ip.IsUnspecified() {
+		return ip.String(), nil
+	}
+	return routeIP(c.HarvesterURL)
+}
+
+// interfaceIP returns the first IPv4 address of the named interface, or its
+// first address when it has no IPv4 one.
+func interfaceIP(name string) (string, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return "", err
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return "", err
+	}
+	var ips []net.IP
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok {
+			ips = append(ips, ipNet.IP)
+		}
+	}
+	for _, ip := range ips {
+		if ip.To4() != nil {
+			return ip.String(), nil
+		}
+	}
+	if len(ips) > 0 {
+		return ips[0].String(), nil
+	}
+	return "", fmt.Errorf("interface %s has no IP address", name)
+}
+
+// routeIP returns the local address used to reach the Harvester API, which
+// is usually reachable from the VLAN the builder VM is on.
+func routeIP(harvesterURL string) (string, error) {
+	u, err := url.Parse(harvesterURL)
+	if err != nil {
+		return "", err
+	}
+	port := u.Port()
+	if port == "" {
+		port = "443"
+	}
+	// no packets are sent for udp, this only picks a route
+	conn, err := net.Dial("udp", net.JoinHostPort(u.Hostname(), port))
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).IP.String(), nil
+}
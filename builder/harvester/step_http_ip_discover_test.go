@@ -0,0 +1,88 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package harvester
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+)
+
+func TestStepHTTPIPDiscover(t *testing.T) {
+	content := map[string]interface{}{"ks.cfg": "text"}
+	cases := map[string]struct {
+		settings map[string]interface{}
+		want     string
+	}{
+		"nothing served": {
+			settings: nil,
+			want:     "",
+		},
+		"http_ip": {
+			settings: map[string]interface{}{"http_content": content, "http_ip": "192.168.10.5"},
+			want:     "192.168.10.5",
+		},
+		"http_bind_address": {
+			settings: map[string]interface{}{"http_content": content, "http_bind_address": "10.1.2.3"},
+			want:     "10.1.2.3",
+		},
+		// the fake listens on localhost, so that is the route to it
+		"route to harvester": {
+			settings: map[string]interface{}{"http_content": content},
+			want:     "127.0.0.1",
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := newFakeHarvester(t)
+			state := f.state(f.config(tc.settings))
+
+			if action := (&StepHTTPIPDiscover{}).Run(context.Background(), state); action != multistep.ActionContinue {
+				t.Fatalf("unexpected action %v: %v", action, state.Get("error"))
+			}
+			if got := state.Get("http_ip"); got != tc.want {
+				t.Errorf("http_ip is %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestStepHTTPIPDiscover_interface(t *testing.T) {
+	var loopback string
+	ifaces, _ := net.Interfaces()
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagLoopback != 0 {
+			loopback = iface.Name
+		}
+	}
+	if loopback == "" {
+		t.Skip("no loopback interface")
+	}
+	f := newFakeHarvester(t)
+	state := f.state(f.config(map[string]interface{}{
+		"http_content":   map[string]interface{}{"ks.cfg": "text"},
+		"http_interface": loopback,
+	}))
+
+	if action := (&StepHTTPIPDiscover{}).Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("unexpected action %v: %v", action, state.Get("error"))
+	}
+	if got := state.Get("http_ip"); got != "127.0.0.1" {
+		t.Errorf("http_ip is %q, want the IPv4 address of %s", got, loopback)
+	}
+}
+
+func TestStepHTTPIPDiscover_unknownInterface(t *testing.T) {
+	f := newFakeHarvester(t)
+	state := f.state(f.config(map[string]interface{}{
+		"http_content":   map[string]interface{}{"ks.cfg": "text"},
+		"http_interface": "does-not-exist0",
+	}))
+
+	if action := (&StepHTTPIPDiscover{}).Run(context.Background(), state); action != multistep.ActionHalt {
+		t.Fatalf("unexpected action %v, want an unknown interface to halt the build", action)
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package harvester
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	harvester "github.com/drewmullen/harvester-go-sdk"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// StepSerialConsole streams the serial console of the running builder VM to
+// the Packer UI, or to serial_console_log_path, until Stop is called or the
+// build ends.
+type StepSerialConsole struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+	once   sync.Once
+}
+
+func (s *StepSerialConsole) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	client := state.Get("client").(*harvester.APIClient)
+	auth := state.Get("auth").(context.Context)
+	ui := state.Get("ui").(packersdk.Ui)
+	c := state.Get("config").(*Config)
+
+	if !c.SerialConsoleLog {
+		return multistep.ActionContinue
+	}
+	name := state.Get("Name").(string)
+
+	var out io.Writer = &uiLineWriter{ui: ui, prefix: fmt.Sprintf("%s console: ", name)}
+	var file *os.File
+	if c.SerialConsoleLogPath != "" {
+		f, err := os.Create(c.SerialConsoleLogPath)
+		if err != nil {
+			err := fmt.Errorf("error creating serial_console_log_path: %s", err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+		file = f
+		out = f
+	}
+
+	ui.Say(fmt.Sprintf("Connecting to serial console of VM %s", name))
+	consoleCtx, cancel := context.WithCancel(context.Background())
+	ws, err := dialWebsocket(consoleCtx, client, auth, consolePath(c.HarvesterNamespace, name), kubevirtPlainProtocol)
+	if err != nil {
+		cancel()
+		if file != nil {
+			file.Close()
+		}
+		// the console only helps debugging, do not fail the build over it
+		ui.Error(fmt.Sprintf("Error connecting to serial console, continuing without it: %s", err))
+		return multistep.ActionContinue
+	}
+	if file != nil {
+		ui.Say(fmt.Sprintf("Writing serial console output to %s", c.SerialConsoleLogPath))
+	}
+
+	s.cancel = cancel
+	s.done = make(chan struct{})
+	go func() {
+		<-consoleCtx.Done()
+		ws.Close()
+	}()
+	go func() {
+		defer close(s.done)
+		if _, err := io.Copy(out, ws); err != nil && consoleCtx.Err() == nil {
+			log.Printf("Serial console of VM %s closed: %s", name, err)
+		}
+		if w, ok := out.(*uiLineWriter); ok {
+			w.Flush()
+		}
+		if file != nil {
+			file.Close()
+		}
+	}()
+
+	return multistep.ActionContinue
+}
+
+// Stop closes the console stream and waits for buffered output to be written.
+func (s *StepSerialConsole) Stop() {
+	s.once.Do(func() {
+		if s.cancel == nil {
+			return
+		}
+		s.cancel()
+		<-s.done
+	})
+}
+
+func (s *StepSerialConsole) Cleanup(state multistep.StateBag) {
+	s.Stop()
+}
+
+// StepStopSerialConsole stops the console stream once the communicator is
+// connected, as provisioner output takes over from there. without a
+// communicator the stream runs until the build ends.
+type StepStopSerialConsole struct {
+	Console *StepSerialConsole
+}
+
+func (s *StepStopSerialConsole) Run(_ context.Context, state multistep.StateBag) multistep.StepAction {
+	if _, ok := state.GetOk("communicator"); ok {
+		s.Console.Stop()
+	}
+	return multistep.ActionContinue
+}
+
+func (s *StepStopSerialConsole) Cleanup(state multistep.StateBag) {}
+
+func consolePath(namespace string, name string) string {
+	return fmt.Sprintf("/apis/subresources.kubevirt.io/v1/namespaces/%s/virtualmachineinstances/%s/console", namespace, name)
+}
+
+// uiLineWriter writes complete lines to the UI as they arrive.
+type uiLineWriter struct {
+	ui     packersdk.Ui
+	prefix string
+	buf    []byte
+}
+
+func (w *uiLineWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.message(string(w.buf[:i]))
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush writes a trailing partial line.
+func (w *uiLineWriter) Flush() {
+	if len(w.buf) > 0 {
+		w.message(string(w.buf))
+		w.buf = nil
+	}
+}
+
+func (w *uiLineWriter) message(line string) {
+	line = strings.TrimRight(line, "\r")
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	w.ui.Message(w.prefix + line)
+}
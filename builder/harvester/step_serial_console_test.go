@@ -0,0 +1,125 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package harvester
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	harvester "github.com/drewmullen/harvester-go-sdk"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"golang.org/x/net/websocket"
+)
+
+func TestStepSerialConsole(t *testing.T) {
+	wsServer := websocket.Server{
+		Handler: func(ws *websocket.Conn) {
+			ws.PayloadType = websocket.BinaryFrame
+			ws.Write([]byte("Booting\r\nlogin: "))
+			// hold the stream open until the client goes away
+			io.Copy(io.Discard, ws)
+		},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if want := consolePath("default", "packer-vm"); r.URL.Path != want {
+			t.Errorf("unexpected path %q, want %q", r.URL.Path, want)
+			http.NotFound(w, r)
+			return
+		}
+		wsServer.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	client := harvester.NewAPIClient(&harvester.Configuration{
+		DefaultHeader: make(map[string]string),
+		Servers:       harvester.ServerConfigurations{{URL: server.URL}},
+	})
+
+	path := filepath.Join(t.TempDir(), "console.log")
+	c := &Config{HarvesterNamespace: "default", SerialConsoleLog: true, SerialConsoleLogPath: path}
+
+	state := new(multistep.BasicStateBag)
+	state.Put("client", client)
+	state.Put("auth", context.Background())
+	state.Put("ui", packersdk.TestUi(t))
+	state.Put("config", c)
+	state.Put("Name", "packer-vm")
+
+	step := &StepSerialConsole{}
+	if action := step.Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("unexpected action %v: %v", action, state.Get("error"))
+	}
+
+	// wait for the output before stopping the stream
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		got, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Contains(got, []byte("login: ")) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("console output never reached %s, got %q", path, got)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	state.Put("communicator", new(packersdk.MockCommunicator))
+	(&StepStopSerialConsole{Console: step}).Run(context.Background(), state)
+	step.Cleanup(state)
+}
+
+func TestUILineWriter(t *testing.T) {
+	var out bytes.Buffer
+	ui := &packersdk.BasicUi{Writer: &out, ErrorWriter: io.Discard}
+	w := &uiLineWriter{ui: ui, prefix: "vm: "}
+
+	w.Write([]byte("first\r\nsec"))
+	w.Write([]byte("ond\r\n\r\nthird"))
+	w.Flush()
+
+	want := "vm: first\nvm: second\nvm: third\n"
+	if got := out.String(); got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestStepStopSerialConsole(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	console := &StepSerialConsole{cancel: cancel, done: make(chan struct{})}
+	go func() {
+		<-ctx.Done()
+		close(console.done)
+	}()
+	state := new(multistep.BasicStateBag)
+	step := &StepStopSerialConsole{Console: console}
+
+	// without a communicator the stream runs until the build ends
+	if action := step.Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("unexpected action %v", action)
+	}
+	if ctx.Err() != nil {
+		t.Fatal("console stopped without a communicator")
+	}
+
+	state.Put("communicator", new(packersdk.MockCommunicator))
+	if action := step.Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("unexpected action %v", action)
+	}
+	if ctx.Err() == nil {
+		t.Fatal("console still running once the communicator connected")
+	}
+	// stopping again, as Cleanup does, is fine
+	console.Cleanup(state)
+}
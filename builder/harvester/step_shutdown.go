@@ -0,0 +1,106 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package harvester
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	harvester "github.com/drewmullen/harvester-go-sdk"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// how long to wait for the VMI to go away after a force stop
+const forceStopTimeout = 2 * time.Minute
+
+// StepShutdown stops the builder VM so its disks are quiesced before export.
+// it runs shutdown_command when there is one and a communicator to run it
+// over, and asks KubeVirt to stop the VM otherwise. a VM that does not stop
+// within shutdown_timeout is force stopped.
+type StepShutdown struct{}
+
+func (s *StepShutdown) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	client := state.Get("client").(*harvester.APIClient)
+	auth := state.Get("auth").(context.Context)
+	ui := state.Get("ui").(packersdk.Ui)
+	c := state.Get("config").(*Config)
+	name := state.Get("Name").(string)
+	namespace := c.HarvesterNamespace
+
+	comm, _ := state.Get("communicator").(packersdk.Communicator)
+	if comm != nil && c.ShutdownCommand != "" {
+		ui.Say("Gracefully halting VM...")
+		log.Printf("Executing shutdown command: %s", c.ShutdownCommand)
+		cmd := &packersdk.RemoteCmd{Command: c.ShutdownCommand}
+		if err := cmd.RunWithUi(ctx, comm, ui); err != nil {
+			// the connection usually drops as the guest goes down
+			log.Printf("Shutdown command returned: %s", err)
+		}
+	} else {
+		ui.Say(fmt.Sprintf("Stopping VM %s...", name))
+		if err := stopVM(ctx, client, auth, name, namespace, nil); err != nil {
+			err := fmt.Errorf("error stopping VM %s: %v", name, err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+	}
+
+	err := waitForVMIStopped(name, namespace, *client, auth, c.ShutdownTimeout, ui)
+	if err == nil {
+		ui.Say(fmt.Sprintf("VM %s stopped", name))
+		return multistep.ActionContinue
+	}
+
+	ui.Error(fmt.Sprintf("WARNING: VM %s did not stop within %s (%v), forcing it off. the exported disk may not be consistent", name, c.ShutdownTimeout, err))
+	gracePeriod := int64(0)
+	if err := stopVM(ctx, client, auth, name, namespace, &gracePeriod); err != nil {
+		err := fmt.Errorf("error force stopping VM %s: %v", name, err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+	if err := waitForVMIStopped(name, namespace, *client, auth, forceStopTimeout, ui); err != nil {
+		err := fmt.Errorf("error waiting for VM %s to stop: %v", name, err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+	ui.Say(fmt.Sprintf("VM %s stopped", name))
+
+	return multistep.ActionContinue
+}
+
+func (s *StepShutdown) Cleanup(state multistep.StateBag) {}
+
+// stopVM calls the KubeVirt stop subresource. a gracePeriod of 0 stops the VM
+// immediately.
+func stopVM(ctx context.Context, client *harvester.APIClient, auth context.Context, name string, namespace string, gracePeriod *int64) error {
+	options := map[string]interface{}{}
+	if gracePeriod != nil {
+		options["gracePeriod"] = *gracePeriod
+	}
+	body, err := json.Marshal(options)
+	if err != nil {
+		return err
+	}
+
+	path := fmt.Sprintf("/apis/subresources.kubevirt.io/v1/namespaces/%s/virtualmachines/%s/stop", namespace, name)
+	req, err := rawRequest(ctx, client, auth, http.MethodPut, path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := doRawRequest(client, req)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
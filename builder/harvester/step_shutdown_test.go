@@ -0,0 +1,115 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package harvester
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+const stopVMPath = "PUT /apis/subresources.kubevirt.io/v1/namespaces/default/virtualmachines/packer-vm/stop"
+
+func TestStepShutdown(t *testing.T) {
+	f := newFakeHarvester(t)
+	f.putRunningVM("default", "packer-vm")
+	state := f.state(f.config(nil))
+	state.Put("Name", "packer-vm")
+
+	if action := (&StepShutdown{}).Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("unexpected action %v: %v", action, state.Get("error"))
+	}
+	if !f.served(stopVMPath) {
+		t.Error("VM was not stopped")
+	}
+	if f.get(fakeVMIs, "default", "packer-vm") != nil {
+		t.Error("VMI still running")
+	}
+}
+
+func TestStepShutdown_timeout(t *testing.T) {
+	f := newFakeHarvester(t)
+	f.putRunningVM("default", "packer-vm")
+	// the guest ignores the ACPI shutdown, only a force stop takes it down
+	var gracePeriods []*int64
+	f.onStop = func(f *fakeHarvester, namespace string, name string, gracePeriod *int64) {
+		gracePeriods = append(gracePeriods, gracePeriod)
+		if gracePeriod != nil && *gracePeriod == 0 {
+			delete(f.objects, fakeKey(fakeVMIs, namespace, name))
+		}
+	}
+	state := f.state(f.config(map[string]interface{}{"shutdown_timeout": "10ms"}))
+	state.Put("Name", "packer-vm")
+
+	if action := (&StepShutdown{}).Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("unexpected action %v: %v", action, state.Get("error"))
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(gracePeriods) != 2 || gracePeriods[0] != nil || gracePeriods[1] == nil || *gracePeriods[1] != 0 {
+		t.Fatalf("VM stopped with grace periods %v, want a graceful stop then a force stop", gracePeriods)
+	}
+}
+
+func TestStepShutdown_command(t *testing.T) {
+	f := newFakeHarvester(t)
+	// the guest has already powered off by the time the VMI is checked
+	f.put(fakeVMs, "default", fakeObject{"metadata": map[string]interface{}{"name": "packer-vm"}})
+	comm := new(packersdk.MockCommunicator)
+	state := f.state(f.config(map[string]interface{}{"shutdown_command": "sudo shutdown -P now"}))
+	state.Put("Name", "packer-vm")
+	state.Put("communicator", comm)
+
+	if action := (&StepShutdown{}).Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("unexpected action %v: %v", action, state.Get("error"))
+	}
+	if !comm.StartCalled || comm.StartCmd.Command != "sudo shutdown -P now" {
+		t.Errorf("shutdown_command was not run, got %+v", comm.StartCmd)
+	}
+	if f.served(stopVMPath) {
+		t.Error("VM was stopped through KubeVirt despite the shutdown_command")
+	}
+}
+
+func TestStepShutdown_noCommunicator(t *testing.T) {
+	f := newFakeHarvester(t)
+	f.putRunningVM("default", "packer-vm")
+	// without a communicator to run it over the command is skipped
+	state := f.state(f.config(map[string]interface{}{"shutdown_command": "sudo shutdown -P now"}))
+	state.Put("Name", "packer-vm")
+
+	if action := (&StepShutdown{}).Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("unexpected action %v: %v", action, state.Get("error"))
+	}
+	if !f.served(stopVMPath) {
+		t.Error("VM was not stopped through KubeVirt")
+	}
+}
+
+func TestStepShutdown_stopFailed(t *testing.T) {
+	f := newFakeHarvester(t)
+	state := f.state(f.config(nil))
+	state.Put("Name", "packer-vm")
+
+	if action := (&StepShutdown{}).Run(context.Background(), state); action != multistep.ActionHalt {
+		t.Fatalf("unexpected action %v, want a failed stop to halt the build", action)
+	}
+	if _, ok := state.GetOk("error"); !ok {
+		t.Error("no error in state")
+	}
+}
+
+func TestConfigPrepare_shutdownTimeout(t *testing.T) {
+	c := &Config{}
+	if _, err := c.Prepare(testConfigRaw(nil)); err != nil {
+		t.Fatal(err)
+	}
+	if c.ShutdownTimeout != 5*time.Minute {
+		t.Errorf("shutdown_timeout is %s, want the default 5m", c.ShutdownTimeout)
+	}
+}
@@ -5,9 +5,13 @@ package harvester
 
 import (
 	"context"
+	"encoding/hex"
 	"fmt"
+	"net/http"
+	"strings"
 	"time"
 
+	getter "github.com/hashicorp/go-getter/v2"
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
 
@@ -20,20 +24,40 @@ type StepSourceBase struct {
 }
 
 // Run should execute the purpose of this step
-func (s *StepSourceBase) Run(_ context.Context, state multistep.StateBag) multistep.StepAction {
+func (s *StepSourceBase) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
 
 	client := state.Get("client").(*harvester.APIClient)
 	auth := state.Get("auth").(context.Context)
 	ui := state.Get("ui").(packersdk.Ui)
 	c := state.Get("config").(*Config)
 
+	if c.BuilderSource.clonesVolume() {
+		return s.resolveSourceVolume(state)
+	}
+
+	if !c.BuilderSource.Filter.Empty() {
+		image, err := findImage(client, auth, c.BuilderSource.Filter, c.HarvesterNamespace)
+		if err != nil {
+			err := fmt.Errorf("error looking up source image: %v", err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+		ui.Say(fmt.Sprintf("Using image %s (%s) as the build source", *image.Metadata.Name, image.Spec.DisplayName))
+		state.Put("imageName", *image.Metadata.Name)
+		return multistep.ActionContinue
+	}
+
 	desiredState := int32(100)
-	timeout := 2 * time.Minute
+	timeout := c.ImageImportTimeout
 	namespace := c.HarvesterNamespace
 	url := c.BuilderSource.URL
-	checkSum := c.BuilderSource.Checksum
+	localPath := c.BuilderSource.LocalPath
+	var checkSum string
+	hasSource := url != "" || localPath != ""
 	ostype := c.BuilderSource.OSType
 	sourceName := c.BuilderSource.Name
+	state.Put("imageName", sourceName)
 	var displayName string
 	if c.BuilderSource.DisplayName == "" {
 		displayName = sourceName
@@ -44,18 +68,130 @@ func (s *StepSourceBase) Run(_ context.Context, state multistep.StateBag) multis
 	annotations := map[string]string{
 		"harvesterhci.io/storageClassName": "harvester-longhorn",
 	}
+	// the image can outlive the build and be reused by other builds, so it is
+	// not labeled as belonging to this one
 	labels := map[string]string{
-		"harvesterhci.io/image-type": "raw_qcow2",
+		"harvesterhci.io/image-type": c.BuilderSource.ImageType,
 		"harvesterhci.io/os-type":    ostype,
 	}
+
+	// the checksum is resolved and a local image verified up front. a remote
+	// image is verified by Harvester, which needs a sha512 checksum.
+	var fc *getter.FileChecksum
+	if hasSource {
+		source := url
+		if localPath != "" {
+			source = localPath
+		}
+		var err error
+		fc, err = resolveChecksum(ctx, c.BuilderSource.Checksum, source)
+		if err != nil {
+			err := fmt.Errorf("unable to resolve checksum %q: %v", c.BuilderSource.Checksum, err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+
+		if localPath != "" {
+			ui.Say(fmt.Sprintf("Computing checksum of %s...", localPath))
+			checkSum, err = verifyLocalChecksum(fc, localPath)
+			if err != nil {
+				err := fmt.Errorf("unable to verify local image %s: %v", localPath, err)
+				state.Put("error", err)
+				ui.Error(err.Error())
+				return multistep.ActionHalt
+			}
+		} else if fc != nil && fc.Type == "sha512" {
+			checkSum = hex.EncodeToString(fc.Value)
+		}
+	}
+
+	preExistingImg, err := getImageByName(client, auth, sourceName, namespace)
+	if err != nil {
+		err := fmt.Errorf("unable to look up image %s: %v", sourceName, err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+	if preExistingImg != nil {
+		if !hasSource {
+			ui.Say("INFO: image already exists skipping download")
+			return s.reuseImage(state, *preExistingImg, timeout)
+		}
+		if fc == nil && checkSum == "" {
+			err := fmt.Errorf("image with matching name, %s, already exists and no checksum provided. unable to compare checksums. either provide a checksum or change the name of the image to be unique", sourceName)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+
+		match, err := imageMatchesChecksum(*preExistingImg, fc, checkSum)
+		if err != nil {
+			err := fmt.Errorf("unable to compare checksum of pre-existing image %s: %v", sourceName, err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+		if !match {
+			err := fmt.Errorf("checksum of pre-existing image %s does not match. either erase prior image or rename new image", sourceName)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+		ui.Say("INFO: image already exists and checksums match. skipping download")
+		return s.reuseImage(state, *preExistingImg, timeout)
+	}
+
+	if !hasSource {
+		err := fmt.Errorf("image %s does not exist and no download url or local path provided", sourceName)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	// Harvester rejects a second image with the same display name, so catch
+	// that here rather than failing on create.
+	sameDisplayName, err := getImagesByDisplayName(client, auth, displayName, namespace)
+	if err != nil {
+		err := fmt.Errorf("unable to look up images with display name %s: %v", displayName, err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+	if len(sameDisplayName) > 0 {
+		existing := *sameDisplayName[0].Metadata.Name
+		err := fmt.Errorf("image %s already uses the display name %q. set builder_source name to %s to reuse it, or choose a different display_name", existing, displayName, existing)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	ui.Say("INFO: image does not exist. continuing... ")
+
+	// Harvester downloads the image itself and only verifies sha512, so any
+	// other checksum could only be checked by downloading the image twice.
+	if checkSum == "" && fc != nil {
+		err := fmt.Errorf("harvester only verifies sha512 checksums, and the %s checksum of %s can only be used to reuse an existing image. set builder_source checksum to the sha512 of the image, upload it with local_path, or set it to %q", fc.Type, url, ChecksumNone)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+	if fc != nil {
+		annotations[AnnotationSourceChecksum] = checksumString(fc)
+	}
+
 	spec := harvester.HarvesterhciIoV1beta1VirtualMachineImageSpec{
 		// Description: &desc,
 		DisplayName: displayName,
-		SourceType:  "download",
-		Url:         &url,
+		SourceType:  ImageSourceTypeDownload,
 	}
-	if c.BuilderSource.Checksum != "" {
-		spec.Checksum = &c.BuilderSource.Checksum
+	if localPath != "" {
+		spec.SourceType = ImageSourceTypeUpload
+	} else {
+		spec.Url = &url
+	}
+	if checkSum != "" {
+		spec.Checksum = &checkSum
 	}
 
 	img := &harvester.HarvesterhciIoV1beta1VirtualMachineImage{
@@ -69,79 +205,157 @@ func (s *StepSourceBase) Run(_ context.Context, state multistep.StateBag) multis
 		},
 		Spec: spec,
 	}
-	
-	preExistingImg, err := checkImageExists(client, auth, displayName, namespace)
-	if err != nil {
-		//TODO: if error is image does not exist then output info and continue, else error and halt
-		if (preExistingImg == harvester.HarvesterhciIoV1beta1VirtualMachineImage{}) {
-			if url != "" {
-				ui.Say("INFO: image does not exist. continuing... ")
-			} else {
-				ui.Error("ERROR: image does not exist and no download url provided")
-				return multistep.ActionHalt
-			}
 
-		}
-	} else {
-		if url != "" && checkSum != "" {
-			if *preExistingImg.Spec.Checksum == "" {
-				ui.Error(fmt.Sprintf("ERROR: checksum not set for pre-existing image %s. Unable to compare images.", displayName))
-				return multistep.ActionHalt
-			}
+	req := client.ImagesAPI.CreateNamespacedVirtualMachineImage(auth, namespace)
+	req = req.HarvesterhciIoV1beta1VirtualMachineImage(*img)
+	_, _, err = client.ImagesAPI.CreateNamespacedVirtualMachineImageExecute(req)
 
-			if checkSum != *preExistingImg.Spec.Checksum {
-				ui.Error("ERROR: Image checksums do not match. either erase prior image or rename new image.")
-				return multistep.ActionHalt
-			}
-			ui.Say("INFO: image already exists and checksums match. skipping download")
-			return multistep.ActionContinue
+	if err != nil {
+		err := fmt.Errorf("error creating image %s: %v", sourceName, err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
 
-		} else if url != "" && checkSum == "" {
-			ui.Error(fmt.Sprintf("ERROR: image with matching name, %s, already exists and no checksum provided. unable to compare checksums. either provide a checksum or change the name of the image to be unique", displayName))
+	if localPath != "" {
+		ui.Say(fmt.Sprintf("Uploading %s to image %v...", localPath, sourceName))
+		if err := uploadImageWithRetry(ctx, client, auth, ui, *img, localPath); err != nil {
+			err := fmt.Errorf("error uploading image %s: %v", sourceName, err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			if err := deleteImage(client, auth, sourceName, namespace); err != nil {
+				ui.Error(fmt.Sprintf("Error deleting failed image %s: %v", sourceName, err))
+			}
 			return multistep.ActionHalt
-		} else if url == "" {
-			ui.Say("INFO: image already exists skipping download")
-			return multistep.ActionContinue
 		}
-
 	}
 
-	req := client.ImagesAPI.CreateNamespacedVirtualMachineImage(auth, namespace)
-	req = req.HarvesterhciIoV1beta1VirtualMachineImage(*img)
-	_, resp, err := client.ImagesAPI.CreateNamespacedVirtualMachineImageExecute(req)
+	ui.Say(fmt.Sprintf("Beginning download of image %v...", sourceName))
+	err = waitForImageDownload(desiredState, sourceName, c.HarvesterNamespace, *client, auth, timeout, ui)
 
 	if err != nil {
-		ui.Error(fmt.Sprintf("Error creating image: %v \n %v", err, resp))
+		err := fmt.Errorf("error waiting for image, %v, to finish downloading: %v", sourceName, err)
+		state.Put("error", err)
+		ui.Error(err.Error())
 		return multistep.ActionHalt
 	}
 
-	ui.Say(fmt.Sprintf("Beginning download of image %v...", sourceName))
-	err = waitForImageDownload(desiredState, sourceName, c.HarvesterNamespace, *client, auth, timeout, ui)
+	ui.Say(fmt.Sprintf("Download complete for image %s!", sourceName))
+
+	return multistep.ActionContinue
+}
 
+// reuseImage makes sure an existing image is usable before the build relies on
+// it. An image still importing, for example one started by a parallel build, is
+// waited on; a failed image or one being deleted halts the build.
+func (s *StepSourceBase) reuseImage(state multistep.StateBag, img harvester.HarvesterhciIoV1beta1VirtualMachineImage, timeout time.Duration) multistep.StepAction {
+	client := state.Get("client").(*harvester.APIClient)
+	auth := state.Get("auth").(context.Context)
+	ui := state.Get("ui").(packersdk.Ui)
+	c := state.Get("config").(*Config)
+
+	name := *img.Metadata.Name
+	namespace := c.HarvesterNamespace
+
+	ready, err := imageReady(img)
 	if err != nil {
-		err := fmt.Errorf("error waiting for image, %v, to finish downloading %s%%: %v", sourceName, string(desiredState), err)
+		err := fmt.Errorf("existing image %s/%s cannot be reused: %v", namespace, name, err)
+		state.Put("error", err)
 		ui.Error(err.Error())
 		return multistep.ActionHalt
 	}
+	if ready {
+		return multistep.ActionContinue
+	}
 
-	ui.Say(fmt.Sprintf("Download complete for image %s!", sourceName))
+	ui.Say(fmt.Sprintf("INFO: image %s is still importing, waiting for it to complete...", name))
+	err = waitForImageDownload(int32(100), name, namespace, *client, auth, timeout, ui)
+	if err != nil {
+		err := fmt.Errorf("error waiting for existing image, %v, to finish importing: %v", name, err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
 
+	ui.Say(fmt.Sprintf("Import complete for image %s!", name))
 	return multistep.ActionContinue
 }
 
-//
+// resolveSourceVolume finds the existing volume the build is cloned from and
+// stores it as sourceVolumeName for StepCreateVolume.
+func (s *StepSourceBase) resolveSourceVolume(state multistep.StateBag) multistep.StepAction {
+	client := state.Get("client").(*harvester.APIClient)
+	auth := state.Get("auth").(context.Context)
+	ui := state.Get("ui").(packersdk.Ui)
+	c := state.Get("config").(*Config)
+	namespace := c.HarvesterNamespace
 
-func checkImageExists(client *harvester.APIClient, auth context.Context, displayName string, namespace string) (harvester.HarvesterhciIoV1beta1VirtualMachineImage, error) {
-	req := client.ImagesAPI.ReadNamespacedVirtualMachineImage(auth, displayName, namespace)
-	preExistingImg, _, err := client.ImagesAPI.ReadNamespacedVirtualMachineImageExecute(req)
+	volumeName := c.BuilderSource.Volume
+	if c.BuilderSource.VM != "" {
+		req := client.VirtualMachinesAPI.ReadNamespacedVirtualMachine(auth, c.BuilderSource.VM, namespace)
+		vm, _, err := req.Execute()
+		if err != nil {
+			err := fmt.Errorf("error reading source vm %s: %v", c.BuilderSource.VM, err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+
+		volumeName, err = vmRootVolume(vm)
+		if err != nil {
+			err := fmt.Errorf("error finding root volume of vm %s: %v", c.BuilderSource.VM, err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+
+		// a running VM can still be writing to the disk being cloned
+		vmiReq := client.VirtualMachinesAPI.ReadNamespacedVirtualMachineInstance(auth, c.BuilderSource.VM, namespace)
+		if vmi, _, err := vmiReq.Execute(); err == nil && vmi.Status != nil && vmi.Status.Phase != nil && *vmi.Status.Phase == "Running" {
+			ui.Say(fmt.Sprintf("WARNING: source vm %s is running, the clone of %s may not be consistent", c.BuilderSource.VM, volumeName))
+		}
 
+		ui.Say(fmt.Sprintf("Using volume %s of vm %s as the build source", volumeName, c.BuilderSource.VM))
+	} else {
+		ui.Say(fmt.Sprintf("Using volume %s as the build source", volumeName))
+	}
+
+	state.Put("sourceVolumeName", volumeName)
+	return multistep.ActionContinue
+}
+
+// getImageByName reads the image by its object name, returning nil when it
+// does not exist.
+func getImageByName(client *harvester.APIClient, auth context.Context, name string, namespace string) (*harvester.HarvesterhciIoV1beta1VirtualMachineImage, error) {
+	req := client.ImagesAPI.ReadNamespacedVirtualMachineImage(auth, name, namespace)
+	image, resp, err := client.ImagesAPI.ReadNamespacedVirtualMachineImageExecute(req)
+
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
 	if err != nil {
-		return harvester.HarvesterhciIoV1beta1VirtualMachineImage{}, err
+		return nil, err
 	}
-	if preExistingImg == nil {
-		return harvester.HarvesterhciIoV1beta1VirtualMachineImage{}, err
+	return image, nil
+}
+
+// getImagesByDisplayName lists the images shown in the Harvester UI under the
+// display name. Display names are not valid label values in general, so the
+// images are matched on their spec rather than through a label selector.
+func getImagesByDisplayName(client *harvester.APIClient, auth context.Context, displayName string, namespace string) ([]harvester.HarvesterhciIoV1beta1VirtualMachineImage, error) {
+	req := client.ImagesAPI.ListNamespacedVirtualMachineImage(auth, namespace)
+	list, _, err := req.Execute()
+	if err != nil {
+		return nil, err
+	}
+
+	var images []harvester.HarvesterhciIoV1beta1VirtualMachineImage
+	for _, image := range list.Items {
+		if image.Spec.DisplayName == displayName && image.Metadata != nil && image.Metadata.Name != nil {
+			images = append(images, image)
+		}
 	}
-	return *preExistingImg, err
+	return images, nil
 }
 
 // Cleanup can be used to clean up any artifact created by the step.
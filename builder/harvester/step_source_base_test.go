@@ -0,0 +1,392 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package harvester
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+)
+
+const createImagePath = "POST /apis/harvesterhci.io/v1beta1/namespaces/default/virtualmachineimages"
+
+func TestStepSourceBase_download(t *testing.T) {
+	f := newFakeHarvester(t)
+	c := f.config(map[string]interface{}{
+		"builder_source": map[string]interface{}{
+			"name":    "focal",
+			"url":     fakeImageURL,
+			"cleanup": true,
+		},
+	})
+	state := f.state(c)
+
+	if action := (&StepSourceBase{}).Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("unexpected action %v: %v", action, state.Get("error"))
+	}
+	if got := state.Get("imageName"); got != "focal" {
+		t.Fatalf("imageName is %v, want focal", got)
+	}
+
+	image := f.get(fakeImages, "default", "focal")
+	if image == nil {
+		t.Fatal("image focal was not created")
+	}
+	if got := image["spec"].(map[string]interface{})["url"]; got != fakeImageURL {
+		t.Errorf("image url is %v, want %s", got, fakeImageURL)
+	}
+	labels := fakeMeta(image)["labels"].(map[string]interface{})
+	if _, ok := labels[LabelTemporary]; ok {
+		t.Errorf("source image is labeled temporary, which the sweeper would delete: %v", labels)
+	}
+	// other builds may reuse the image
+	if _, ok := labels[LabelBuildID]; ok {
+		t.Errorf("source image is labeled with the build ID: %v", labels)
+	}
+}
+
+func TestStepSourceBase_reuse(t *testing.T) {
+	f := newFakeHarvester(t)
+	c := f.config(map[string]interface{}{
+		"builder_source": map[string]interface{}{"name": "focal"},
+	})
+	f.put(fakeImages, "default", fakeImage("focal", "focal", map[string]interface{}{"progress": 40}))
+	// the image finishes importing on the third read
+	reads := 0
+	f.onRead[fakeImages] = func(obj fakeObject) {
+		if reads++; reads == 3 {
+			obj["status"] = importedStatus("focal")
+		}
+	}
+	state := f.state(c)
+
+	if action := (&StepSourceBase{}).Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("unexpected action %v: %v", action, state.Get("error"))
+	}
+	f.mu.Lock()
+	n := reads
+	f.mu.Unlock()
+	if n < 3 {
+		t.Errorf("image was read %d times, want it waited on until imported", n)
+	}
+	if f.served(createImagePath) {
+		t.Error("an existing image was created again")
+	}
+}
+
+func TestStepSourceBase_importFailed(t *testing.T) {
+	f := newFakeHarvester(t)
+	c := f.config(nil)
+	f.onCreate[fakeImages] = func(obj fakeObject) {
+		obj["status"] = map[string]interface{}{
+			"progress": 0,
+			"conditions": []interface{}{
+				map[string]interface{}{"type": "Imported", "status": "False", "message": "404 Not Found"},
+				map[string]interface{}{"type": "RetryLimitExceeded", "status": "True", "message": "404 Not Found"},
+			},
+		}
+	}
+	state := f.state(c)
+
+	if action := (&StepSourceBase{}).Run(context.Background(), state); action != multistep.ActionHalt {
+		t.Fatalf("unexpected action %v, want the failed import to halt the build", action)
+	}
+}
+
+func TestStepSourceBase_importRetried(t *testing.T) {
+	f := newFakeHarvester(t)
+	c := f.config(nil)
+	f.onCreate[fakeImages] = func(obj fakeObject) {
+		obj["status"] = map[string]interface{}{
+			"progress": 0,
+			"conditions": []interface{}{
+				map[string]interface{}{"type": "Imported", "status": "False", "message": "connection reset by peer"},
+			},
+		}
+	}
+	// Harvester's retry succeeds by the third read
+	reads := 0
+	f.onRead[fakeImages] = func(obj fakeObject) {
+		if reads++; reads == 3 {
+			obj["status"] = importedStatus("focal")
+		}
+	}
+	state := f.state(c)
+
+	if action := (&StepSourceBase{}).Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("unexpected action %v, want the build to wait for the retried import: %v", action, state.Get("error"))
+	}
+}
+
+func TestStepSourceBase_displayNameInUse(t *testing.T) {
+	f := newFakeHarvester(t)
+	c := f.config(nil)
+	f.put(fakeImages, "default", fakeImage("image-abcde", "focal", importedStatus("image-abcde")))
+	state := f.state(c)
+
+	if action := (&StepSourceBase{}).Run(context.Background(), state); action != multistep.ActionHalt {
+		t.Fatalf("unexpected action %v, want a display name conflict to halt the build", action)
+	}
+	if err, _ := state.Get("error").(error); err == nil || !strings.Contains(err.Error(), "image-abcde already uses the display name") {
+		t.Errorf("error is %v, want the display name conflict", err)
+	}
+	if f.served(createImagePath) {
+		t.Error("image was created despite the display name conflict")
+	}
+}
+
+func TestStepSourceBase_reuseRecordedChecksum(t *testing.T) {
+	sha256Sum := strings.Repeat("ab", 32)
+	cases := map[string]struct {
+		recorded string
+		want     multistep.StepAction
+	}{
+		"matching":     {recorded: "sha256:" + sha256Sum, want: multistep.ActionContinue},
+		"different":    {recorded: "sha256:" + strings.Repeat("cd", 32), want: multistep.ActionHalt},
+		"not recorded": {recorded: "", want: multistep.ActionHalt},
+		"other type":   {recorded: "md5:" + strings.Repeat("ab", 16), want: multistep.ActionHalt},
+		"upper cased":  {recorded: "sha256:" + strings.ToUpper(sha256Sum), want: multistep.ActionContinue},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := newFakeHarvester(t)
+			c := f.config(map[string]interface{}{
+				"builder_source": map[string]interface{}{
+					"name":     "focal",
+					"url":      fakeImageURL,
+					"checksum": "sha256:" + sha256Sum,
+				},
+			})
+			image := fakeImage("focal", "focal", importedStatus("focal"))
+			if tc.recorded != "" {
+				fakeMeta(image)["annotations"] = map[string]interface{}{AnnotationSourceChecksum: tc.recorded}
+			}
+			f.put(fakeImages, "default", image)
+			state := f.state(c)
+
+			// fakeImageURL does not resolve, so reaching it would halt the build
+			if action := (&StepSourceBase{}).Run(context.Background(), state); action != tc.want {
+				t.Fatalf("unexpected action %v, want %v", action, tc.want)
+			}
+			if _, halted := state.GetOk("error"); halted != (tc.want == multistep.ActionHalt) {
+				t.Errorf("error in state is %v, want one only when the build halts", state.Get("error"))
+			}
+			if f.served(createImagePath) {
+				t.Error("an existing image was created again")
+			}
+		})
+	}
+}
+
+func TestStepSourceBase_urlChecksumNotSHA512(t *testing.T) {
+	f := newFakeHarvester(t)
+	c := f.config(map[string]interface{}{
+		"builder_source": map[string]interface{}{
+			"name":     "focal",
+			"url":      fakeImageURL,
+			"checksum": "sha256:" + strings.Repeat("ab", 32),
+		},
+	})
+	state := f.state(c)
+
+	if action := (&StepSourceBase{}).Run(context.Background(), state); action != multistep.ActionHalt {
+		t.Fatalf("unexpected action %v, want a sha256 checksum for a new url image to halt the build", action)
+	}
+	if err, _ := state.Get("error").(error); err == nil || !strings.Contains(err.Error(), "only verifies sha512 checksums") {
+		t.Errorf("error is %v, want it to ask for a sha512 checksum", err)
+	}
+	if f.served(createImagePath) {
+		t.Error("an image was created without a checksum Harvester can verify")
+	}
+}
+
+func TestStepSourceBase_upload(t *testing.T) {
+	f := newFakeHarvester(t)
+	path := writeLocalImage(t, 8192)
+	c := f.config(map[string]interface{}{
+		"builder_source": map[string]interface{}{
+			"name":       "focal",
+			"local_path": path,
+		},
+	})
+	state := f.state(c)
+
+	if action := (&StepSourceBase{}).Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("unexpected action %v: %v", action, state.Get("error"))
+	}
+
+	image := f.get(fakeImages, "default", "focal")
+	if image == nil {
+		t.Fatal("image focal was not created")
+	}
+	sum, err := fileSHA512(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec := image["spec"].(map[string]interface{})
+	if spec["sourceType"] != ImageSourceTypeUpload || spec["checksum"] != sum {
+		t.Errorf("unexpected image spec %v", spec)
+	}
+	f.mu.Lock()
+	uploaded := f.uploads["focal"]
+	f.mu.Unlock()
+	if uploaded != 8192 {
+		t.Errorf("uploaded %d bytes, want 8192", uploaded)
+	}
+}
+
+func TestStepSourceBase_importTimeout(t *testing.T) {
+	f := newFakeHarvester(t)
+	// the import never makes progress
+	f.onCreate[fakeImages] = func(obj fakeObject) {
+		obj["status"] = map[string]interface{}{"progress": 10}
+	}
+	state := f.state(f.config(map[string]interface{}{"image_import_timeout": "20ms"}))
+
+	if action := (&StepSourceBase{}).Run(context.Background(), state); action != multistep.ActionHalt {
+		t.Fatalf("unexpected action %v, want the import to time out", action)
+	}
+	if _, ok := state.GetOk("error"); !ok {
+		t.Error("the timeout is not in state")
+	}
+}
+
+func TestGetImageByName(t *testing.T) {
+	f := newFakeHarvester(t)
+	f.put(fakeImages, "default", fakeImage("focal", "Ubuntu 22.04", importedStatus("focal")))
+	client, auth := f.client()
+
+	image, err := getImageByName(client, auth, "focal", "default")
+	if err != nil || image == nil || image.Spec.DisplayName != "Ubuntu 22.04" {
+		t.Errorf("getImageByName(focal) = %v, %v, want the image", image, err)
+	}
+
+	// the display name is not the object name
+	image, err = getImageByName(client, auth, "ubuntu-22.04", "default")
+	if err != nil || image != nil {
+		t.Errorf("getImageByName(ubuntu-22.04) = %v, %v, want no image", image, err)
+	}
+
+	f.fail["GET "+fakeImages] = http.StatusForbidden
+	if _, err := getImageByName(client, auth, "focal", "default"); err == nil {
+		t.Error("getImageByName succeeded on a forbidden read")
+	}
+}
+
+func TestGetImagesByDisplayName(t *testing.T) {
+	f := newFakeHarvester(t)
+	f.put(fakeImages, "default", fakeImage("focal", "Ubuntu 22.04", importedStatus("focal")))
+	f.put(fakeImages, "default", fakeImage("jammy", "jammy", importedStatus("jammy")))
+	client, auth := f.client()
+
+	images, err := getImagesByDisplayName(client, auth, "Ubuntu 22.04", "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(images) != 1 || *images[0].Metadata.Name != "focal" {
+		t.Errorf("images are %v, want only focal", images)
+	}
+
+	images, err = getImagesByDisplayName(client, auth, "focal", "default")
+	if err != nil || len(images) != 0 {
+		t.Errorf("images are %v, %v, want none for an object name", images, err)
+	}
+}
+
+func TestStepSourceBase_customDisplayName(t *testing.T) {
+	f := newFakeHarvester(t)
+	c := f.config(map[string]interface{}{
+		"builder_source": map[string]interface{}{
+			"name":         "focal",
+			"display_name": "Ubuntu 22.04",
+			"url":          fakeImageURL,
+			"checksum":     "sha512:" + strings.Repeat("ab", 64),
+		},
+	})
+
+	if action := (&StepSourceBase{}).Run(context.Background(), f.state(c)); action != multistep.ActionContinue {
+		t.Fatal("first build did not create the image")
+	}
+	image := f.get(fakeImages, "default", "focal")
+	if image == nil {
+		t.Fatal("image was not created under its object name")
+	}
+	if got := image["spec"].(map[string]interface{})["displayName"]; got != "Ubuntu 22.04" {
+		t.Errorf("display name is %v, want Ubuntu 22.04", got)
+	}
+
+	// a second build finds the image by its object name rather than trying
+	// to create it again
+	f.fail["POST "+fakeImages] = http.StatusConflict
+	state := f.state(c)
+	if action := (&StepSourceBase{}).Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("second build did not reuse the image: %v", state.Get("error"))
+	}
+	if got := state.Get("imageName"); got != "focal" {
+		t.Errorf("imageName is %v, want focal", got)
+	}
+}
+
+func TestConfigPrepare_sourceName(t *testing.T) {
+	cases := map[string]string{
+		"focal":                  "",
+		"ubuntu-22.04":           "",
+		"Ubuntu 22.04":           "is not a valid object name",
+		"ubuntu_22.04":           "is not a valid object name",
+		"-focal":                 "is not a valid object name",
+		strings.Repeat("a", 254): "is not a valid object name",
+	}
+	for name, wantErr := range cases {
+		c := &Config{}
+		_, err := c.Prepare(testConfigRaw(map[string]interface{}{
+			"builder_source": map[string]interface{}{"name": name, "display_name": "Ubuntu 22.04", "url": fakeImageURL},
+		}))
+		if wantErr == "" {
+			if err != nil {
+				t.Errorf("Prepare(name %q): %s", name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), wantErr) {
+			t.Errorf("Prepare(name %q) error %v, want %q", name, err, wantErr)
+		}
+	}
+}
+
+func TestStepSourceBase_iso(t *testing.T) {
+	f := newFakeHarvester(t)
+	c := f.config(map[string]interface{}{
+		"builder_source": map[string]interface{}{"name": "rhel9", "url": fakeImageURL, "image_type": ImageTypeISO},
+	})
+	state := f.state(c)
+
+	if action := (&StepSourceBase{}).Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("unexpected action %v: %v", action, state.Get("error"))
+	}
+	labels := fakeMeta(f.get(fakeImages, "default", "rhel9"))["labels"].(map[string]interface{})
+	if got := labels["harvesterhci.io/image-type"]; got != ImageTypeISO {
+		t.Errorf("image type label is %v, want %s", got, ImageTypeISO)
+	}
+}
+
+func TestConfigPrepare_imageType(t *testing.T) {
+	c := &Config{}
+	if _, err := c.Prepare(testConfigRaw(nil)); err != nil {
+		t.Fatal(err)
+	}
+	if c.BuilderSource.ImageType != ImageTypeRawQcow2 {
+		t.Errorf("image type is %q, want the default %s", c.BuilderSource.ImageType, ImageTypeRawQcow2)
+	}
+
+	c = &Config{}
+	_, err := c.Prepare(testConfigRaw(map[string]interface{}{
+		"builder_source": map[string]interface{}{"name": "rhel9", "url": fakeImageURL, "image_type": "qcow2"},
+	}))
+	if err == nil || !strings.Contains(err.Error(), "builder_source image_type must be") {
+		t.Errorf("Prepare error %v, want the unknown image type reported", err)
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package harvester
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	harvester "github.com/drewmullen/harvester-go-sdk"
+	"github.com/hashicorp/packer-plugin-sdk/bootcommand"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
+	"github.com/mitchellh/go-vnc"
+)
+
+// the websocket subprotocol KubeVirt uses for raw VNC and serial streams
+const kubevirtPlainProtocol = "plain.kubevirt.io"
+
+type bootCommandTemplateData struct {
+	HTTPIP   string
+	HTTPPort int
+	Name     string
+}
+
+// StepTypeBootCommand types boot_command into the builder VM over the VNC
+// subresource of its VMI.
+type StepTypeBootCommand struct{}
+
+func (s *StepTypeBootCommand) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	client := state.Get("client").(*harvester.APIClient)
+	auth := state.Get("auth").(context.Context)
+	ui := state.Get("ui").(packersdk.Ui)
+	c := state.Get("config").(*Config)
+
+	if len(c.BootCommand) == 0 {
+		log.Println("No boot command given, skipping")
+		return multistep.ActionContinue
+	}
+	name := state.Get("Name").(string)
+
+	if c.BootWait > 0 {
+		ui.Say(fmt.Sprintf("Waiting %s for boot...", c.BootWait))
+		select {
+		case <-time.After(c.BootWait):
+		case <-ctx.Done():
+			return multistep.ActionHalt
+		}
+	}
+
+	ui.Say(fmt.Sprintf("Connecting to VNC of VM %s", name))
+	ws, err := dialWebsocket(ctx, client, auth, vncPath(c.HarvesterNamespace, name), kubevirtPlainProtocol)
+	if err != nil {
+		err := fmt.Errorf("error connecting to VNC: %s", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+	defer ws.Close()
+
+	conn, err := vnc.Client(ws, &vnc.ClientConfig{
+		Auth:      []vnc.ClientAuth{new(vnc.ClientAuthNone)},
+		Exclusive: false,
+	})
+	if err != nil {
+		err := fmt.Errorf("error handshaking with VNC: %s", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+	defer conn.Close()
+
+	httpIP, _ := state.Get("http_ip").(string)
+	httpPort, _ := state.Get("http_port").(int)
+	c.ctx.Data = &bootCommandTemplateData{
+		HTTPIP:   httpIP,
+		HTTPPort: httpPort,
+		Name:     name,
+	}
+	command, err := interpolate.Render(c.FlatBootCommand(), &c.ctx)
+	if err != nil {
+		err := fmt.Errorf("error preparing boot command: %s", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	seq, err := bootcommand.GenerateExpressionSequence(command)
+	if err != nil {
+		err := fmt.Errorf("error generating boot command: %s", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	ui.Say("Typing the boot command over VNC...")
+	d := bootcommand.NewVNCDriver(conn, c.BootKeyInterval)
+	if err := seq.Do(ctx, d); err != nil {
+		err := fmt.Errorf("error running boot command: %s", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	return multistep.ActionContinue
+}
+
+func (s *StepTypeBootCommand) Cleanup(state multistep.StateBag) {}
+
+func vncPath(namespace string, name string) string {
+	return fmt.Sprintf("/apis/subresources.kubevirt.io/v1/namespaces/%s/virtualmachineinstances/%s/vnc", namespace, name)
+}
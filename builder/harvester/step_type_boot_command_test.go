@@ -0,0 +1,147 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package harvester
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	harvester "github.com/drewmullen/harvester-go-sdk"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"golang.org/x/net/websocket"
+)
+
+// fakeVNCServer stands in for the KubeVirt vnc subresource. it runs the RFB
+// handshake with no authentication and records the keys pressed.
+func fakeVNCServer(t *testing.T, keys chan<- uint32) *httptest.Server {
+	wsServer := websocket.Server{
+		Handshake: func(cfg *websocket.Config, req *http.Request) error {
+			if got := req.Header.Get("Authorization"); got != "Bearer token" {
+				t.Errorf("unexpected Authorization header %q", got)
+			}
+			if len(cfg.Protocol) != 1 || cfg.Protocol[0] != kubevirtPlainProtocol {
+				t.Errorf("unexpected subprotocols %v", cfg.Protocol)
+			}
+			return nil
+		},
+		Handler: func(ws *websocket.Conn) {
+			defer close(keys)
+			ws.PayloadType = websocket.BinaryFrame
+
+			if _, err := ws.Write([]byte("RFB 003.008\n")); err != nil {
+				t.Error(err)
+				return
+			}
+			version := make([]byte, 12)
+			if _, err := io.ReadFull(ws, version); err != nil {
+				t.Error(err)
+				return
+			}
+			// one security type, None
+			ws.Write([]byte{1, 1})
+			securityType := make([]byte, 1)
+			if _, err := io.ReadFull(ws, securityType); err != nil {
+				t.Error(err)
+				return
+			}
+			binary.Write(ws, binary.BigEndian, uint32(0))
+			shared := make([]byte, 1)
+			if _, err := io.ReadFull(ws, shared); err != nil {
+				t.Error(err)
+				return
+			}
+			// ServerInit: 640x480, 32bpp true colour, named "vm"
+			serverInit := []byte{
+				0x02, 0x80, 0x01, 0xe0,
+				32, 24, 0, 1, 0, 255, 0, 255, 0, 255, 16, 8, 0, 0, 0, 0,
+				0, 0, 0, 2, 'v', 'm',
+			}
+			ws.Write(serverInit)
+
+			msg := make([]byte, 8)
+			for {
+				if _, err := io.ReadFull(ws, msg); err != nil {
+					return
+				}
+				if msg[0] != 4 {
+					t.Errorf("unexpected client message type %d", msg[0])
+					return
+				}
+				if msg[1] == 1 {
+					keys <- binary.BigEndian.Uint32(msg[4:])
+				}
+			}
+		},
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if want := vncPath("default", "packer-vm"); r.URL.Path != want {
+			t.Errorf("unexpected path %q, want %q", r.URL.Path, want)
+			http.NotFound(w, r)
+			return
+		}
+		wsServer.ServeHTTP(w, r)
+	}))
+}
+
+func TestStepTypeBootCommand(t *testing.T) {
+	keys := make(chan uint32, 64)
+	server := fakeVNCServer(t, keys)
+	defer server.Close()
+
+	client := harvester.NewAPIClient(&harvester.Configuration{
+		DefaultHeader: make(map[string]string),
+		Servers:       harvester.ServerConfigurations{{URL: server.URL}},
+	})
+
+	c := &Config{HarvesterNamespace: "default"}
+	c.BootCommand = []string{"ab<enter>"}
+	c.BootWait = time.Millisecond
+	c.BootKeyInterval = time.Millisecond
+
+	state := new(multistep.BasicStateBag)
+	state.Put("client", client)
+	state.Put("auth", context.WithValue(context.Background(), harvester.ContextAccessToken, "token"))
+	state.Put("ui", packersdk.TestUi(t))
+	state.Put("config", c)
+	state.Put("Name", "packer-vm")
+
+	step := &StepTypeBootCommand{}
+	if action := step.Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("unexpected action %v: %v", action, state.Get("error"))
+	}
+
+	var got []uint32
+	for k := range keys {
+		got = append(got, k)
+	}
+	want := []uint32{'a', 'b', 0xFF0D}
+	if len(got) != len(want) {
+		t.Fatalf("got keys %x, want %x", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got keys %x, want %x", got, want)
+		}
+	}
+}
+
+func TestStepTypeBootCommand_noCommand(t *testing.T) {
+	state := new(multistep.BasicStateBag)
+	state.Put("client", harvester.NewAPIClient(harvester.NewConfiguration()))
+	state.Put("auth", context.Background())
+	state.Put("ui", packersdk.TestUi(t))
+	state.Put("config", &Config{})
+
+	step := &StepTypeBootCommand{}
+	if action := step.Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("unexpected action %v", action)
+	}
+}
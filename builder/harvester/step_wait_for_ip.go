@@ -0,0 +1,167 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package harvester
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	harvester "github.com/drewmullen/harvester-go-sdk"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// StepWaitForIP polls the VMI status until it reports an address the
+// communicator can use and stores it as "ip".
+type StepWaitForIP struct {
+	// how often the VMI is read, default 5s
+	PollInterval time.Duration
+}
+
+func (s *StepWaitForIP) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	client := state.Get("client").(*harvester.APIClient)
+	auth := state.Get("auth").(context.Context)
+	ui := state.Get("ui").(packersdk.Ui)
+	c := state.Get("config").(*Config)
+
+	needIP := c.Comm.Type != "none" && c.Comm.Host() == ""
+	if !needIP && !c.WaitForGuestAgent {
+		return multistep.ActionContinue
+	}
+	name := state.Get("Name").(string)
+
+	var cidrs []*net.IPNet
+	for _, cidr := range c.IPWaitCIDR {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			err := fmt.Errorf("error parsing ip_wait_cidr: %s", err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+		cidrs = append(cidrs, ipNet)
+	}
+
+	interval := s.PollInterval
+	if interval == 0 {
+		interval = 5 * time.Second
+	}
+	timeout := time.After(c.IPWaitTimeout)
+
+	if c.WaitForGuestAgent {
+		ui.Say(fmt.Sprintf("Waiting for the guest agent of VM %s to connect...", name))
+	} else {
+		ui.Say(fmt.Sprintf("Waiting for VM %s to report an IP address...", name))
+	}
+	agentConnected := false
+	for {
+		vmi, _, err := client.VirtualMachinesAPI.ReadNamespacedVirtualMachineInstance(auth, name, c.HarvesterNamespace).Execute()
+		if err != nil {
+			log.Printf("Error reading VMI %s: %s", name, err)
+		} else if vmi.Status != nil {
+			if c.WaitForGuestAgent && !agentConnected {
+				agentConnected = vmiAgentConnected(vmi.Status)
+				if agentConnected {
+					ui.Say("Guest agent connected")
+					if needIP {
+						ui.Say(fmt.Sprintf("Waiting for VM %s to report an IP address...", name))
+					}
+				}
+			}
+			if !needIP && agentConnected {
+				return multistep.ActionContinue
+			}
+			if agentConnected || !c.WaitForGuestAgent {
+				ip := selectIP(vmi.Status.Interfaces, communicatorInterface(c), c.IPFamily, cidrs)
+				if ip != "" {
+					ui.Say(fmt.Sprintf("VM %s has IP address %s", name, ip))
+					state.Put("ip", ip)
+					return multistep.ActionContinue
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return multistep.ActionHalt
+		case <-timeout:
+			err := fmt.Errorf("timeout after %s waiting for VM %s to report an IP address", c.IPWaitTimeout, name)
+			if c.WaitForGuestAgent && !agentConnected {
+				err = fmt.Errorf("timeout after %s waiting for the guest agent of VM %s to connect", c.IPWaitTimeout, name)
+			}
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		case <-time.After(interval):
+		}
+	}
+}
+
+func (s *StepWaitForIP) Cleanup(state multistep.StateBag) {}
+
+func vmiAgentConnected(status *harvester.KubevirtIoApiCoreV1VirtualMachineInstanceStatus) bool {
+	for _, cond := range status.Conditions {
+		if cond.Type == "AgentConnected" && cond.Status == "True" {
+			return true
+		}
+	}
+	return false
+}
+
+// selectIP picks the address to connect to. the preferred family wins over the
+// other one, then addresses the guest agent reports win over those KubeVirt
+// learned from the domain. link-local addresses are never used. when nicName is
+// set only that interface is considered, and when cidrs are given the address
+// must be inside one of them.
+func selectIP(interfaces []harvester.KubevirtIoApiCoreV1VirtualMachineInstanceNetworkInterface, nicName string, family string, cidrs []*net.IPNet) string {
+	var agent, other []net.IP
+	for _, iface := range interfaces {
+		if nicName != "" && (iface.Name == nil || *iface.Name != nicName) {
+			continue
+		}
+		addrs := iface.IpAddresses
+		if len(addrs) == 0 && iface.IpAddress != nil {
+			addrs = []string{*iface.IpAddress}
+		}
+		for _, addr := range addrs {
+			ip := net.ParseIP(strings.Split(addr, "/")[0])
+			if ip == nil || ip.IsLinkLocalUnicast() || ip.IsLoopback() || !inCIDRs(ip, cidrs) {
+				continue
+			}
+			if iface.InfoSource != nil && strings.Contains(*iface.InfoSource, "guest-agent") {
+				agent = append(agent, ip)
+			} else {
+				other = append(other, ip)
+			}
+		}
+	}
+
+	wantV4 := family != IPFamilyIPv6
+	for _, matchFamily := range []bool{true, false} {
+		for _, ips := range [][]net.IP{agent, other} {
+			for _, ip := range ips {
+				if ((ip.To4() != nil) == wantV4) == matchFamily {
+					return ip.String()
+				}
+			}
+		}
+	}
+	return ""
+}
+
+func inCIDRs(ip net.IP, cidrs []*net.IPNet) bool {
+	if len(cidrs) == 0 {
+		return true
+	}
+	for _, cidr := range cidrs {
+		if cidr.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
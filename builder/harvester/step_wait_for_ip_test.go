@@ -0,0 +1,94 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package harvester
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	harvester "github.com/drewmullen/harvester-go-sdk"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+)
+
+func TestSelectIP(t *testing.T) {
+	agent := toStringPtr("domain, guest-agent")
+	interfaces := []harvester.KubevirtIoApiCoreV1VirtualMachineInstanceNetworkInterface{
+		{
+			Name:        toStringPtr("nic-1"),
+			IpAddress:   toStringPtr("10.0.0.5"),
+			IpAddresses: []string{"10.0.0.5", "fe80::1", "2001:db8::5"},
+			InfoSource:  agent,
+		},
+		{
+			Name:      toStringPtr("nic-2"),
+			IpAddress: toStringPtr("192.168.1.7"),
+		},
+	}
+	_, lan, _ := net.ParseCIDR("192.168.0.0/16")
+
+	cases := []struct {
+		name    string
+		nicName string
+		family  string
+		cidrs   []*net.IPNet
+		want    string
+	}{
+		{name: "agent first", family: IPFamilyIPv4, want: "10.0.0.5"},
+		{name: "prefer ipv6", family: IPFamilyIPv6, want: "2001:db8::5"},
+		{name: "nic name", nicName: "nic-2", family: IPFamilyIPv4, want: "192.168.1.7"},
+		{name: "family fallback", nicName: "nic-2", family: IPFamilyIPv6, want: "192.168.1.7"},
+		{name: "cidr", family: IPFamilyIPv4, cidrs: []*net.IPNet{lan}, want: "192.168.1.7"},
+		{name: "no match", nicName: "nic-3", family: IPFamilyIPv4, want: ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := selectIP(interfaces, tc.nicName, tc.family, tc.cidrs); got != tc.want {
+				t.Fatalf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestStepWaitForIP(t *testing.T) {
+	f := newFakeHarvester(t)
+	f.putRunningVM("default", "packer-vm")
+	state := f.state(f.config(map[string]interface{}{
+		"communicator": "ssh",
+		"ssh_username": "ubuntu",
+	}))
+	state.Put("Name", "packer-vm")
+
+	step := &StepWaitForIP{PollInterval: time.Millisecond}
+	if action := step.Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("unexpected action %v: %v", action, state.Get("error"))
+	}
+	if got := state.Get("ip"); got != "10.0.0.10" {
+		t.Errorf("ip is %v, want 10.0.0.10", got)
+	}
+}
+
+func TestStepWaitForIP_timeout(t *testing.T) {
+	f := newFakeHarvester(t)
+	f.putRunningVM("default", "packer-vm")
+	// the guest never gets a lease
+	f.onRead[fakeVMIs] = func(obj fakeObject) {
+		delete(obj["status"].(map[string]interface{}), "interfaces")
+	}
+	state := f.state(f.config(map[string]interface{}{
+		"communicator":    "ssh",
+		"ssh_username":    "ubuntu",
+		"ip_wait_timeout": "20ms",
+	}))
+	state.Put("Name", "packer-vm")
+
+	step := &StepWaitForIP{PollInterval: time.Millisecond}
+	if action := step.Run(context.Background(), state); action != multistep.ActionHalt {
+		t.Fatalf("unexpected action %v, want the timeout to halt the build", action)
+	}
+	if _, ok := state.GetOk("ip"); ok {
+		t.Error("ip set despite the timeout")
+	}
+}
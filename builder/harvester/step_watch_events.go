@@ -0,0 +1,216 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package harvester
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	harvester "github.com/drewmullen/harvester-go-sdk"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// StepWatchEvents prints the Kubernetes events of the build's image, volumes,
+// VM, VMI and virt-launcher pod as they happen, so scheduling and attach
+// failures show up in the build output. it runs for the whole build.
+type StepWatchEvents struct {
+	// how often events are listed, default 5s
+	PollInterval time.Duration
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func (s *StepWatchEvents) Run(_ context.Context, state multistep.StateBag) multistep.StepAction {
+	client := state.Get("client").(*harvester.APIClient)
+	auth := state.Get("auth").(context.Context)
+	ui := state.Get("ui").(packersdk.Ui)
+	c := state.Get("config").(*Config)
+
+	interval := s.PollInterval
+	if interval == 0 {
+		interval = 5 * time.Second
+	}
+
+	w := &eventWatcher{
+		client:    client,
+		auth:      auth,
+		namespace: c.HarvesterNamespace,
+		// event timestamps only have second precision
+		since: time.Now().Truncate(time.Second),
+		seen:  make(map[string]int32),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.done = make(chan struct{})
+	go func() {
+		defer close(s.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			events, err := w.poll(ctx, buildObjects(state))
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("Error listing events: %s", err)
+				}
+				continue
+			}
+			for _, e := range events {
+				msg := fmt.Sprintf("%s %s: %s: %s", e.InvolvedObject.Kind, e.InvolvedObject.Name, e.Reason, strings.TrimSpace(e.Message))
+				if e.Type == "Warning" {
+					ui.Error(msg)
+				} else {
+					ui.Message(msg)
+				}
+			}
+		}
+	}()
+
+	return multistep.ActionContinue
+}
+
+func (s *StepWatchEvents) Cleanup(state multistep.StateBag) {
+	if s.cancel == nil {
+		return
+	}
+	s.cancel()
+	<-s.done
+}
+
+// coreEvent holds the fields of a core/v1 Event the watcher uses. the SDK
+// has no API for core resources.
+type coreEvent struct {
+	Metadata struct {
+		UID string `json:"uid"`
+	} `json:"metadata"`
+	InvolvedObject struct {
+		Kind string `json:"kind"`
+		Name string `json:"name"`
+	} `json:"involvedObject"`
+	Reason         string     `json:"reason"`
+	Message        string     `json:"message"`
+	Type           string     `json:"type"`
+	Count          int32      `json:"count"`
+	FirstTimestamp *time.Time `json:"firstTimestamp"`
+	LastTimestamp  *time.Time `json:"lastTimestamp"`
+	EventTime      *time.Time `json:"eventTime"`
+}
+
+// last returns when the event last happened.
+func (e coreEvent) last() time.Time {
+	switch {
+	case e.LastTimestamp != nil:
+		return *e.LastTimestamp
+	case e.EventTime != nil:
+		return *e.EventTime
+	case e.FirstTimestamp != nil:
+		return *e.FirstTimestamp
+	}
+	return time.Time{}
+}
+
+// buildObjects maps the kind and name of every resource the build created so
+// far. the virt-launcher pod is matched by name prefix in involves.
+func buildObjects(state multistep.StateBag) map[string]map[string]bool {
+	objects := map[string]map[string]bool{}
+	add := func(kind string, name interface{}) {
+		n, _ := name.(string)
+		if n == "" {
+			return
+		}
+		if objects[kind] == nil {
+			objects[kind] = map[string]bool{}
+		}
+		objects[kind][n] = true
+	}
+
+	for _, key := range []string{"imageName", "cdImageName"} {
+		add(KindVirtualMachineImage, state.Get(key))
+	}
+	for _, key := range []string{"volumeName", "isoVolumeName", "cdVolumeName", "virtioDriversVolumeName"} {
+		add(KindVolume, state.Get(key))
+	}
+	if disks, ok := state.GetOk("diskVolumes"); ok {
+		for _, d := range disks.([]diskVolume) {
+			add(KindVolume, d.VolumeName)
+		}
+	}
+	add(KindVirtualMachine, state.Get("Name"))
+	add(KindVirtualMachineInstance, state.Get("Name"))
+	return objects
+}
+
+// involves reports whether the event is about one of the build's objects.
+func involves(objects map[string]map[string]bool, e coreEvent) bool {
+	kind, name := e.InvolvedObject.Kind, e.InvolvedObject.Name
+	if kind == "Pod" {
+		for vm := range objects[KindVirtualMachine] {
+			if strings.HasPrefix(name, "virt-launcher-"+vm+"-") {
+				return true
+			}
+		}
+		return false
+	}
+	return objects[kind][name]
+}
+
+type eventWatcher struct {
+	client    *harvester.APIClient
+	auth      context.Context
+	namespace string
+	since     time.Time
+	// event UID to the count last printed, as repeated events are updated
+	// in place
+	seen map[string]int32
+}
+
+// poll lists the namespace's events and returns the ones about objects that
+// were not returned before.
+func (w *eventWatcher) poll(ctx context.Context, objects map[string]map[string]bool) ([]coreEvent, error) {
+	req, err := rawRequest(ctx, w.client, w.auth, http.MethodGet, fmt.Sprintf("/api/v1/namespaces/%s/events", w.namespace), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := doRawRequest(w.client, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var list struct {
+		Items []coreEvent `json:"items"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, err
+	}
+
+	var events []coreEvent
+	for _, e := range list.Items {
+		if !involves(objects, e) || e.last().Before(w.since) {
+			continue
+		}
+		if count, ok := w.seen[e.Metadata.UID]; ok && count >= e.Count {
+			continue
+		}
+		w.seen[e.Metadata.UID] = e.Count
+		events = append(events, e)
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].last().Before(events[j].last())
+	})
+	return events, nil
+}
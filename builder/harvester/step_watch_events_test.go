@@ -0,0 +1,81 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package harvester
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	harvester "github.com/drewmullen/harvester-go-sdk"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+)
+
+func TestEventWatcherPoll(t *testing.T) {
+	count := 1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if want := "/api/v1/namespaces/default/events"; r.URL.Path != want {
+			t.Errorf("unexpected path %q, want %q", r.URL.Path, want)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"items": [
+			{"metadata": {"uid": "1"}, "involvedObject": {"kind": "Pod", "name": "virt-launcher-packer-vm-abcde"},
+			 "reason": "FailedScheduling", "message": "0/3 nodes are available", "type": "Warning",
+			 "count": ` + strconv.Itoa(count) + `, "lastTimestamp": "2030-01-01T00:00:02Z"},
+			{"metadata": {"uid": "2"}, "involvedObject": {"kind": "PersistentVolumeClaim", "name": "packer-vm-root"},
+			 "reason": "Provisioning", "type": "Normal", "count": 1, "lastTimestamp": "2030-01-01T00:00:01Z"},
+			{"metadata": {"uid": "3"}, "involvedObject": {"kind": "VirtualMachine", "name": "other-vm"},
+			 "reason": "SuccessfulCreate", "type": "Normal", "count": 1, "lastTimestamp": "2030-01-01T00:00:01Z"},
+			{"metadata": {"uid": "4"}, "involvedObject": {"kind": "VirtualMachine", "name": "packer-vm"},
+			 "reason": "SuccessfulCreate", "type": "Normal", "count": 1, "lastTimestamp": "2000-01-01T00:00:00Z"}
+		]}`))
+	}))
+	defer server.Close()
+
+	client := harvester.NewAPIClient(&harvester.Configuration{
+		DefaultHeader: make(map[string]string),
+		Servers:       harvester.ServerConfigurations{{URL: server.URL}},
+	})
+
+	state := new(multistep.BasicStateBag)
+	state.Put("Name", "packer-vm")
+	state.Put("volumeName", "packer-vm-root")
+
+	w := &eventWatcher{
+		client:    client,
+		auth:      context.Background(),
+		namespace: "default",
+		since:     time.Date(2029, 1, 1, 0, 0, 0, 0, time.UTC),
+		seen:      make(map[string]int32),
+	}
+
+	events, err := w.poll(context.Background(), buildObjects(state))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[0].Metadata.UID != "2" || events[1].Metadata.UID != "1" {
+		t.Fatalf("unexpected events %+v", events)
+	}
+
+	events, err = w.poll(context.Background(), buildObjects(state))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 0 {
+		t.Fatalf("expected no new events, got %+v", events)
+	}
+
+	// a repeated event is printed again
+	count = 2
+	events, err = w.poll(context.Background(), buildObjects(state))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Metadata.UID != "1" {
+		t.Fatalf("unexpected events %+v", events)
+	}
+}
@@ -0,0 +1,213 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package harvester
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+
+	harvester "github.com/drewmullen/harvester-go-sdk"
+)
+
+// OrphanedResource is a resource left behind by a build that did not clean up
+// after itself.
+type OrphanedResource struct {
+	Kind      string
+	Namespace string
+	Name      string
+	BuildID   string
+	BuildName string
+	Created   time.Time
+}
+
+func (r OrphanedResource) String() string {
+	return fmt.Sprintf("%s %s/%s (build %s %s, created %s)", r.Kind, r.Namespace, r.Name, r.BuildName, r.BuildID, r.Created.Format(time.RFC3339))
+}
+
+// sweptKinds lists the resources a build creates in the order they can be
+// deleted: the VM first so it releases its volumes and secret, then the
+// volumes so they release the images they were created from. images are only
+// swept when labeled temporary, as the cd_files images are: source images may
+// be shared with other builds and exported images are the build's artifact.
+var sweptKinds = []struct {
+	kind     string
+	path     string
+	selector string
+}{
+	{KindVirtualMachine, "/apis/kubevirt.io/v1/namespaces/%s/virtualmachines", LabelBuildID},
+	{KindSecret, "/api/v1/namespaces/%s/secrets", LabelBuildID},
+	{KindVolume, "/api/v1/namespaces/%s/persistentvolumeclaims", LabelBuildID},
+	{KindVirtualMachineImage, "/apis/harvesterhci.io/v1beta1/namespaces/%s/virtualmachineimages", LabelBuildID + "," + LabelTemporary + "=true"},
+}
+
+// Sweeper finds and deletes resources of builds that were killed before they
+// could clean up, such as builder VMs of cancelled CI jobs.
+type Sweeper struct {
+	client *harvester.APIClient
+	auth   context.Context
+}
+
+func NewSweeper(harvesterURL string, token string) *Sweeper {
+	client, auth := newClient(harvesterURL, token)
+	return &Sweeper{client: client, auth: auth}
+}
+
+// Find lists the resources carrying the build labels in the namespaces that
+// were created more than olderThan ago, in the order they should be deleted.
+func (s *Sweeper) Find(ctx context.Context, namespaces []string, olderThan time.Duration) ([]OrphanedResource, error) {
+	cutoff := time.Now().Add(-olderThan)
+
+	var found []OrphanedResource
+	for _, k := range sweptKinds {
+		for _, namespace := range namespaces {
+			path := fmt.Sprintf(k.path, namespace) + "?labelSelector=" + url.QueryEscape(k.selector)
+			objects, err := s.list(ctx, path)
+			if err != nil {
+				return nil, fmt.Errorf("listing %s in %s: %s", k.kind, namespace, err)
+			}
+			for _, o := range objects {
+				if !o.Metadata.CreationTimestamp.Before(cutoff) {
+					continue
+				}
+				found = append(found, OrphanedResource{
+					Kind:      k.kind,
+					Namespace: namespace,
+					Name:      o.Metadata.Name,
+					BuildID:   o.Metadata.Labels[LabelBuildID],
+					BuildName: o.Metadata.Labels[LabelBuildName],
+					Created:   o.Metadata.CreationTimestamp,
+				})
+			}
+		}
+	}
+	return found, nil
+}
+
+// Delete deletes the resource.
+func (s *Sweeper) Delete(ctx context.Context, r OrphanedResource) error {
+	switch r.Kind {
+	case KindVirtualMachine:
+		req := s.client.VirtualMachinesAPI.DeleteNamespacedVirtualMachine(s.auth, r.Name, r.Namespace)
+		req = req.K8sIoV1DeleteOptions(harvester.K8sIoV1DeleteOptions{})
+		_, _, err := req.Execute()
+		return err
+	case KindSecret:
+		return deleteSecret(ctx, s.client, s.auth, r.Name, r.Namespace)
+	case KindVolume:
+		return deleteVolume(s.client, s.auth, r.Name, r.Namespace)
+	case KindVirtualMachineImage:
+		return deleteImage(s.client, s.auth, r.Name, r.Namespace)
+	}
+	return fmt.Errorf("unknown kind %s", r.Kind)
+}
+
+// DeleteAll deletes the resources in the order Find returns them. Every kind
+// is waited on to be gone, up to timeout, before the next kind is deleted, as
+// a resource is not released while the one using it still exists. deleting is
+// called before each resource is deleted. The resources that fail to delete are
+// reported in the returned error and the others are still deleted, but a kind
+// that does not go away in time stops the sweep.
+func (s *Sweeper) DeleteAll(ctx context.Context, resources []OrphanedResource, timeout time.Duration, deleting func(OrphanedResource)) error {
+	var errs *packersdk.MultiError
+	for start := 0; start < len(resources); {
+		end := start
+		for end < len(resources) && resources[end].Kind == resources[start].Kind {
+			end++
+		}
+
+		var deleted []OrphanedResource
+		for _, r := range resources[start:end] {
+			deleting(r)
+			if err := s.Delete(ctx, r); err != nil {
+				errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("deleting %s %s/%s: %s", r.Kind, r.Namespace, r.Name, err))
+				continue
+			}
+			deleted = append(deleted, r)
+		}
+		for _, r := range deleted {
+			if err := s.WaitDeleted(ctx, r, timeout); err != nil {
+				return packersdk.MultiErrorAppend(errs, err)
+			}
+		}
+		start = end
+	}
+	if errs != nil && len(errs.Errors) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// WaitDeleted waits up to timeout for the deleted resource to be gone.
+func (s *Sweeper) WaitDeleted(ctx context.Context, r OrphanedResource, timeout time.Duration) error {
+	var path string
+	for _, k := range sweptKinds {
+		if k.kind == r.Kind {
+			path = fmt.Sprintf(k.path, r.Namespace) + "/" + url.PathEscape(r.Name)
+		}
+	}
+	if path == "" {
+		return fmt.Errorf("unknown kind %s", r.Kind)
+	}
+
+	startTime := time.Now()
+	for {
+		req, err := rawRequest(ctx, s.client, s.auth, http.MethodGet, path, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := doRawRequest(s.client, req)
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+
+		if time.Since(startTime) >= timeout {
+			return fmt.Errorf("timeout waiting for %s %s/%s to be deleted", r.Kind, r.Namespace, r.Name)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// sweptObject holds the metadata of a listed resource. the objects are listed
+// through raw requests as the SDK has no API for secrets.
+type sweptObject struct {
+	Metadata struct {
+		Name              string            `json:"name"`
+		Labels            map[string]string `json:"labels"`
+		CreationTimestamp time.Time         `json:"creationTimestamp"`
+	} `json:"metadata"`
+}
+
+func (s *Sweeper) list(ctx context.Context, path string) ([]sweptObject, error) {
+	req, err := rawRequest(ctx, s.client, s.auth, http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := doRawRequest(s.client, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var list struct {
+		Items []sweptObject `json:"items"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
@@ -0,0 +1,187 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package harvester
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSweeperFind(t *testing.T) {
+	old := time.Now().Add(-48 * time.Hour).UTC().Format(time.RFC3339)
+	recent := time.Now().UTC().Format(time.RFC3339)
+	item := func(name string, created string) string {
+		return fmt.Sprintf(`{"metadata": {"name": %q, "creationTimestamp": %q, "labels": {%q: "id", %q: "example"}}}`, name, created, LabelBuildID, LabelBuildName)
+	}
+
+	var selectors []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		selectors = append(selectors, r.URL.Query().Get("labelSelector"))
+		var items string
+		switch r.URL.Path {
+		case "/apis/kubevirt.io/v1/namespaces/default/virtualmachines":
+			items = item("packer-vm", old) + "," + item("packer-running", recent)
+		case "/api/v1/namespaces/default/persistentvolumeclaims":
+			items = item("packer-root", old)
+		case "/apis/harvesterhci.io/v1beta1/namespaces/default/virtualmachineimages":
+			items = item("packer-cd-1", old)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"items": [%s]}`, items)
+	}))
+	defer server.Close()
+
+	found, err := NewSweeper(server.URL, "token").Find(context.Background(), []string{"default"}, 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		KindVirtualMachine + " packer-vm",
+		KindVolume + " packer-root",
+		KindVirtualMachineImage + " packer-cd-1",
+	}
+	if len(found) != len(want) {
+		t.Fatalf("found %v, want %v", found, want)
+	}
+	for i, r := range found {
+		if got := r.Kind + " " + r.Name; got != want[i] {
+			t.Errorf("found %s at %d, want %s", got, i, want[i])
+		}
+		if r.BuildID != "id" || r.BuildName != "example" {
+			t.Errorf("unexpected build labels on %v", r)
+		}
+	}
+	if got := selectors[len(selectors)-1]; got != LabelBuildID+","+LabelTemporary+"=true" {
+		t.Errorf("images listed with selector %q", got)
+	}
+}
+
+// putOrphans stores a resource of every swept kind of a build created two days
+// ago, and returns them in the order Find does.
+func putOrphans(f *fakeHarvester) []OrphanedResource {
+	created := time.Now().Add(-48 * time.Hour).UTC()
+	meta := func(name string, labels map[string]interface{}) map[string]interface{} {
+		labels[LabelBuildID] = "id"
+		return map[string]interface{}{
+			"name":              name,
+			"labels":            labels,
+			"creationTimestamp": created.Format(time.RFC3339),
+		}
+	}
+	f.put(fakeVMs, "default", fakeObject{"metadata": meta("packer-vm", map[string]interface{}{})})
+	f.put(fakeSecrets, "default", fakeObject{"metadata": meta("packer-cloudinit", map[string]interface{}{})})
+	f.put(fakeVolumes, "default", fakeObject{"metadata": meta("packer-root", map[string]interface{}{})})
+	f.put(fakeImages, "default", fakeObject{"metadata": meta("packer-cd", map[string]interface{}{LabelTemporary: "true"})})
+
+	var orphans []OrphanedResource
+	for _, r := range []struct{ kind, name string }{
+		{KindVirtualMachine, "packer-vm"},
+		{KindSecret, "packer-cloudinit"},
+		{KindVolume, "packer-root"},
+		{KindVirtualMachineImage, "packer-cd"},
+	} {
+		orphans = append(orphans, OrphanedResource{Kind: r.kind, Namespace: "default", Name: r.name, BuildID: "id", Created: created})
+	}
+	return orphans
+}
+
+func TestSweeperDelete(t *testing.T) {
+	f := newFakeHarvester(t)
+	sweeper := NewSweeper(f.URL, "token")
+
+	for _, r := range putOrphans(f) {
+		if err := sweeper.Delete(context.Background(), r); err != nil {
+			t.Fatalf("deleting %s: %s", r, err)
+		}
+	}
+	for _, resource := range []string{fakeVMs, fakeSecrets, fakeVolumes, fakeImages} {
+		if names := f.names(resource); len(names) != 0 {
+			t.Errorf("%s left behind: %v", resource, names)
+		}
+	}
+
+	if err := sweeper.Delete(context.Background(), OrphanedResource{Kind: "Unknown", Name: "x"}); err == nil {
+		t.Error("expected an error deleting an unknown kind")
+	}
+}
+
+func TestSweeperDeleteAll(t *testing.T) {
+	f := newFakeHarvester(t)
+	orphans := putOrphans(f)
+
+	// the VM takes a moment to go away, as its VMI shuts down
+	vmKey := fakeKey(fakeVMs, "default", "packer-vm")
+	f.onDelete[fakeVMs] = func(obj fakeObject) bool {
+		time.AfterFunc(20*time.Millisecond, func() {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			delete(f.objects, vmKey)
+		})
+		return false
+	}
+	var deletedWithVM []string
+	for _, resource := range []string{fakeSecrets, fakeVolumes} {
+		resource := resource
+		f.onDelete[resource] = func(obj fakeObject) bool {
+			if _, ok := f.objects[vmKey]; ok {
+				deletedWithVM = append(deletedWithVM, resource)
+			}
+			return true
+		}
+	}
+
+	var deleting []string
+	err := NewSweeper(f.URL, "token").DeleteAll(context.Background(), orphans, time.Minute, func(r OrphanedResource) {
+		deleting = append(deleting, r.Name)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(deleting) != len(orphans) {
+		t.Errorf("deleted %v, want all of %v", deleting, orphans)
+	}
+	if len(deletedWithVM) > 0 {
+		t.Errorf("%v deleted while the VM still existed", deletedWithVM)
+	}
+	for _, resource := range []string{fakeVMs, fakeSecrets, fakeVolumes, fakeImages} {
+		if names := f.names(resource); len(names) != 0 {
+			t.Errorf("%s left behind: %v", resource, names)
+		}
+	}
+}
+
+func TestSweeperDeleteAll_timeout(t *testing.T) {
+	f := newFakeHarvester(t)
+	orphans := putOrphans(f)
+	// the VM never goes away
+	f.onDelete[fakeVMs] = func(obj fakeObject) bool { return false }
+
+	err := NewSweeper(f.URL, "token").DeleteAll(context.Background(), orphans, 20*time.Millisecond, func(OrphanedResource) {})
+	if err == nil {
+		t.Fatal("expected a timeout waiting for the VM to be deleted")
+	}
+	if names := f.names(fakeVolumes); len(names) != 1 {
+		t.Errorf("volumes %v, want the volume kept while the VM exists", names)
+	}
+}
+
+func TestSweeperDeleteAll_deleteFailed(t *testing.T) {
+	f := newFakeHarvester(t)
+	orphans := putOrphans(f)
+	f.fail["DELETE "+fakeSecrets] = http.StatusForbidden
+
+	err := NewSweeper(f.URL, "token").DeleteAll(context.Background(), orphans, time.Minute, func(OrphanedResource) {})
+	if err == nil {
+		t.Fatal("expected the failed secret delete to be reported")
+	}
+	if names := f.names(fakeVolumes); len(names) != 0 {
+		t.Errorf("volumes %v left behind, want the sweep to go on after a failed delete", names)
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package harvester
+
+import (
+	"context"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/retry"
+
+	harvester "github.com/drewmullen/harvester-go-sdk"
+)
+
+// copyBufferSize is the size of the buffer images are copied through when
+// they are hashed or uploaded.
+const copyBufferSize = 4 * 1024 * 1024
+
+// uploadTries is how many times an interrupted upload is started over. the
+// upload action cannot resume, so every try sends the image from the start.
+const uploadTries = 3
+
+// fileSHA512 returns the hex encoded SHA-512 of the file, the only checksum
+// Harvester verifies images against.
+func fileSHA512(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha512.New()
+	if _, err := io.CopyBuffer(h, f, make([]byte, copyBufferSize)); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// uploadImage streams the local file to the upload action of an image created
+// with sourceType "upload". Harvester takes the whole image as a single
+// multipart request, which is written from the file as it is sent so large
+// images are never held in memory. An upload that breaks off cannot be resumed.
+func uploadImage(ctx context.Context, client *harvester.APIClient, auth context.Context, ui packersdk.Ui, name string, namespace string, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	size := info.Size()
+
+	progress := ui.TrackProgress(filepath.Base(path), 0, size, f)
+	defer progress.Close()
+
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	go func() {
+		// "chunk" is the form field Harvester reads the image from, it
+		// carries the whole file.
+		part, err := mw.CreateFormFile("chunk", filepath.Base(path))
+		if err == nil {
+			_, err = io.CopyBuffer(part, progress, make([]byte, copyBufferSize))
+		}
+		if err == nil {
+			err = mw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+
+	query := url.Values{}
+	query.Set("action", "upload")
+	query.Set("size", fmt.Sprintf("%d", size))
+	path = fmt.Sprintf("/v1/harvester/harvesterhci.io.virtualmachineimages/%s/%s?%s", url.PathEscape(namespace), url.PathEscape(name), query.Encode())
+
+	req, err := rawRequest(ctx, client, auth, http.MethodPost, path, pr)
+	if err != nil {
+		pr.Close()
+		return err
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	resp, err := doRawRequest(client, req)
+	if err != nil {
+		pr.CloseWithError(err)
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func deleteImage(client *harvester.APIClient, auth context.Context, name string, namespace string) error {
+	req := client.ImagesAPI.DeleteNamespacedVirtualMachineImage(auth, name, namespace)
+	req = req.K8sIoV1DeleteOptions(harvester.K8sIoV1DeleteOptions{})
+	_, _, err := req.Execute()
+	return err
+}
+
+// recreateImage deletes the image, waits for it to be gone and creates it again
+// from the same definition.
+func recreateImage(client *harvester.APIClient, auth context.Context, img harvester.HarvesterhciIoV1beta1VirtualMachineImage, timeout time.Duration, ui packersdk.Ui) error {
+	name := *img.Metadata.Name
+	namespace := *img.Metadata.Namespace
+
+	if err := deleteImage(client, auth, name, namespace); err != nil {
+		return err
+	}
+	if err := waitForImageDestroy(name, namespace, *client, auth, timeout, ui); err != nil {
+		return err
+	}
+
+	req := client.ImagesAPI.CreateNamespacedVirtualMachineImage(auth, namespace)
+	req = req.HarvesterhciIoV1beta1VirtualMachineImage(img)
+	_, _, err := req.Execute()
+	return err
+}
+
+// uploadImageWithRetry uploads localPath into the created upload image img,
+// starting over up to uploadTries times. Each retry recreates the image and
+// uploads localPath again from its first byte.
+func uploadImageWithRetry(ctx context.Context, client *harvester.APIClient, auth context.Context, ui packersdk.Ui, img harvester.HarvesterhciIoV1beta1VirtualMachineImage, localPath string) error {
+	name := *img.Metadata.Name
+	namespace := *img.Metadata.Namespace
+
+	attempt := 0
+	return retry.Config{
+		Tries:      uploadTries,
+		RetryDelay: (&retry.Backoff{InitialBackoff: 5 * time.Second, MaxBackoff: time.Minute, Multiplier: 2}).Linear,
+	}.Run(ctx, func(ctx context.Context) error {
+		attempt++
+		if attempt > 1 {
+			// Harvester marks the image failed when an upload breaks off, so
+			// it has to be recreated before the upload can be retried.
+			ui.Say(fmt.Sprintf("Retrying upload of %s (attempt %d of %d)...", localPath, attempt, uploadTries))
+			if err := recreateImage(client, auth, img, 2*time.Minute, ui); err != nil {
+				return fmt.Errorf("unable to recreate image for retry: %v", err)
+			}
+		}
+		err := uploadImage(ctx, client, auth, ui, name, namespace, localPath)
+		if err != nil {
+			ui.Error(fmt.Sprintf("Upload of %s failed: %v", localPath, err))
+		}
+		return err
+	})
+}
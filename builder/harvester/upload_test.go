@@ -0,0 +1,67 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package harvester
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// writeLocalImage writes a local image of size bytes and returns its path.
+func writeLocalImage(t *testing.T, size int) string {
+	path := filepath.Join(t.TempDir(), "focal.img")
+	if err := os.WriteFile(path, bytes.Repeat([]byte{0xab}, size), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestUploadImage(t *testing.T) {
+	f := newFakeHarvester(t)
+	f.put(fakeImages, "default", fakeImage("focal", "focal", map[string]interface{}{}))
+	// larger than the copy buffer, so the body is written in several reads
+	size := 2*copyBufferSize + 123
+	path := writeLocalImage(t, size)
+
+	client, auth := f.client()
+	if err := uploadImage(context.Background(), client, auth, packersdk.TestUi(t), "focal", "default", path); err != nil {
+		t.Fatal(err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if got := f.uploads["focal"]; got != int64(size) {
+		t.Errorf("uploaded %d bytes, want %d", got, size)
+	}
+}
+
+func TestUploadImage_imageMissing(t *testing.T) {
+	f := newFakeHarvester(t)
+	path := writeLocalImage(t, 1024)
+
+	client, auth := f.client()
+	if err := uploadImage(context.Background(), client, auth, packersdk.TestUi(t), "focal", "default", path); err == nil {
+		t.Fatal("expected an error uploading to a missing image")
+	}
+}
+
+func TestFileSHA512(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "empty.img")
+	if err := os.WriteFile(path, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	sum, err := fileSHA512(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "cf83e1357eefb8bdf1542850d66d8007d620e4050b5715dc83f4a921d36ce9ce47d0d13c5d85f2b0ff8318d2877eec2f63b931bd47417a81a538327af927da3e"
+	if sum != want {
+		t.Errorf("sha512 of an empty file is %s, want %s", sum, want)
+	}
+}
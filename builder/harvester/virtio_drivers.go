@@ -0,0 +1,91 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package harvester
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	harvester "github.com/drewmullen/harvester-go-sdk"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// the disk and volume name of the virtio drivers CD-ROM
+const virtioDriversDiskName = "virtio-drivers"
+
+func vmVirtioDriversVolume(c *Config, volumes builderVolumes) harvester.KubevirtIoApiCoreV1Volume {
+	volume := harvester.KubevirtIoApiCoreV1Volume{
+		Name: virtioDriversDiskName,
+	}
+	if volumes.VirtioDrivers != "" {
+		volume.PersistentVolumeClaim = &harvester.KubevirtIoApiCoreV1PersistentVolumeClaimVolumeSource{
+			ClaimName: volumes.VirtioDrivers,
+		}
+	} else {
+		volume.ContainerDisk = &harvester.KubevirtIoApiCoreV1ContainerDiskSource{
+			Image:           c.BuilderConfiguration.VirtioDriversContainerDisk,
+			ImagePullPolicy: toStringPtr("IfNotPresent"),
+		}
+	}
+	return volume
+}
+
+// virtioDriversImage splits virtio_drivers_image into namespace and name.
+func virtioDriversImage(c *Config) (string, string) {
+	if namespace, name, ok := strings.Cut(c.BuilderConfiguration.VirtioDriversImage, "/"); ok {
+		return namespace, name
+	}
+	return c.HarvesterNamespace, c.BuilderConfiguration.VirtioDriversImage
+}
+
+// StepCreateVirtioDriversVolume creates the volume backing the virtio drivers
+// CD-ROM when the drivers come from a Harvester image.
+type StepCreateVirtioDriversVolume struct{}
+
+func (s *StepCreateVirtioDriversVolume) Run(_ context.Context, state multistep.StateBag) multistep.StepAction {
+	client := state.Get("client").(*harvester.APIClient)
+	auth := state.Get("auth").(context.Context)
+	ui := state.Get("ui").(packersdk.Ui)
+	c := state.Get("config").(*Config)
+
+	if c.BuilderConfiguration.VirtioDriversImage == "" {
+		return multistep.ActionContinue
+	}
+	namespace, name := virtioDriversImage(c)
+
+	volumeName, err := createImageVolume(client, auth, c, namespace, name)
+	if err != nil {
+		err := fmt.Errorf("error creating virtio drivers volume from image %s/%s: %v", namespace, name, err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+	state.Put("virtioDriversVolumeName", volumeName)
+	ui.Say(fmt.Sprintf("Virtio drivers volume %s created from image %s/%s", volumeName, namespace, name))
+
+	return multistep.ActionContinue
+}
+
+func (s *StepCreateVirtioDriversVolume) Cleanup(state multistep.StateBag) {
+	volumeName, ok := state.GetOk("virtioDriversVolumeName")
+	if !ok {
+		return
+	}
+	client := state.Get("client").(*harvester.APIClient)
+	auth := state.Get("auth").(context.Context)
+	ui := state.Get("ui").(packersdk.Ui)
+	c := state.Get("config").(*Config)
+
+	if keepOnError(state) {
+		ui.Say(fmt.Sprintf("Keeping volume %s for debugging", volumeName))
+		return
+	}
+
+	ui.Say(fmt.Sprintf("Deleting volume %s in namespace %s", volumeName, c.HarvesterNamespace))
+	if err := deleteVolume(client, auth, volumeName.(string), c.HarvesterNamespace); err != nil {
+		ui.Error(fmt.Sprintf("Error deleting volume: %v", err))
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package harvester
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+)
+
+func TestVirtioDriversConfig(t *testing.T) {
+	cases := map[string]struct {
+		settings      map[string]interface{}
+		containerDisk string
+		image         string
+		wantErr       bool
+	}{
+		"default": {
+			settings:      map[string]interface{}{"virtio_drivers": true},
+			containerDisk: VirtioDriversContainerDisk,
+		},
+		"container disk": {
+			settings:      map[string]interface{}{"virtio_drivers_container_disk": "quay.io/kubevirt/virtio-container-disk:v1.1.1"},
+			containerDisk: "quay.io/kubevirt/virtio-container-disk:v1.1.1",
+		},
+		"image": {
+			settings: map[string]interface{}{"virtio_drivers_image": "isos/virtio-win"},
+			image:    "isos/virtio-win",
+		},
+		"both": {
+			settings: map[string]interface{}{"virtio_drivers_image": "virtio-win", "virtio_drivers_container_disk": "drivers:latest"},
+			wantErr:  true,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			f := newFakeHarvester(t)
+			c := &Config{}
+			_, err := c.Prepare(f.raw(map[string]interface{}{"builder_configuration": tc.settings}))
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			bc := c.BuilderConfiguration
+			if !bc.VirtioDrivers || bc.VirtioDriversContainerDisk != tc.containerDisk || bc.VirtioDriversImage != tc.image {
+				t.Errorf("virtio drivers %t, container disk %q, image %q", bc.VirtioDrivers, bc.VirtioDriversContainerDisk, bc.VirtioDriversImage)
+			}
+		})
+	}
+}
+
+func TestVirtioDriversImage(t *testing.T) {
+	c := &Config{HarvesterNamespace: "builds"}
+	for in, want := range map[string][2]string{
+		"virtio-win":      {"builds", "virtio-win"},
+		"isos/virtio-win": {"isos", "virtio-win"},
+	} {
+		c.BuilderConfiguration.VirtioDriversImage = in
+		if namespace, name := virtioDriversImage(c); namespace != want[0] || name != want[1] {
+			t.Errorf("virtioDriversImage(%q) = %s, %s, want %s, %s", in, namespace, name, want[0], want[1])
+		}
+	}
+}
+
+func TestVMVirtioDriversVolume(t *testing.T) {
+	c := &Config{}
+	c.BuilderConfiguration.VirtioDriversContainerDisk = VirtioDriversContainerDisk
+
+	volume := vmVirtioDriversVolume(c, builderVolumes{})
+	if volume.ContainerDisk == nil || volume.ContainerDisk.Image != VirtioDriversContainerDisk || volume.PersistentVolumeClaim != nil {
+		t.Errorf("expected the container disk, got %+v", volume)
+	}
+
+	volume = vmVirtioDriversVolume(c, builderVolumes{VirtioDrivers: "packer-virtio"})
+	if volume.PersistentVolumeClaim == nil || volume.PersistentVolumeClaim.ClaimName != "packer-virtio" || volume.ContainerDisk != nil {
+		t.Errorf("expected the volume packer-virtio, got %+v", volume)
+	}
+}
+
+func TestStepCreateVirtioDriversVolume(t *testing.T) {
+	f := newFakeHarvester(t)
+	c := f.config(map[string]interface{}{
+		"builder_configuration": map[string]interface{}{"virtio_drivers_image": "isos/virtio-win"},
+	})
+	f.put(fakeImages, "isos", fakeImage("virtio-win", "virtio-win.iso", importedStatus("virtio-win")))
+	state := f.state(c)
+
+	step := &StepCreateVirtioDriversVolume{}
+	if action := step.Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("unexpected action %v: %v", action, state.Get("error"))
+	}
+	volumeName := state.Get("virtioDriversVolumeName").(string)
+	volume := f.get(fakeVolumes, "default", volumeName)
+	if volume == nil {
+		t.Fatalf("volume %s was not created", volumeName)
+	}
+	if got := fakeMeta(volume)["annotations"].(map[string]interface{})["harvesterhci.io/imageId"]; got != "isos/virtio-win" {
+		t.Errorf("volume created from image %v, want isos/virtio-win", got)
+	}
+
+	step.Cleanup(state)
+	if f.get(fakeVolumes, "default", volumeName) != nil {
+		t.Errorf("volume %s left behind after cleanup", volumeName)
+	}
+}
+
+func TestStepCreateVirtioDriversVolume_containerDisk(t *testing.T) {
+	f := newFakeHarvester(t)
+	c := f.config(map[string]interface{}{
+		"builder_configuration": map[string]interface{}{"virtio_drivers": true},
+	})
+	state := f.state(c)
+
+	if action := (&StepCreateVirtioDriversVolume{}).Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("unexpected action %v: %v", action, state.Get("error"))
+	}
+	if _, ok := state.GetOk("virtioDriversVolumeName"); ok {
+		t.Error("a volume was created for the container disk")
+	}
+	if names := f.names(fakeVolumes); len(names) != 0 {
+		t.Errorf("unexpected volumes %v", names)
+	}
+}
+
+func TestStepCreateVirtioDriversVolume_imageMissing(t *testing.T) {
+	f := newFakeHarvester(t)
+	c := f.config(map[string]interface{}{
+		"builder_configuration": map[string]interface{}{"virtio_drivers_image": "virtio-win"},
+	})
+	state := f.state(c)
+
+	if action := (&StepCreateVirtioDriversVolume{}).Run(context.Background(), state); action != multistep.ActionHalt {
+		t.Fatalf("unexpected action %v, want a missing image to halt the build", action)
+	}
+}
@@ -11,18 +11,20 @@ import (
 	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
 )
 
+// pollInterval is how often the wait functions read the resource they wait on.
+var pollInterval = 5 * time.Second
+
 func waitForVMState(desiredState string, name string, namespace string, client harvester.APIClient, auth context.Context, timeout time.Duration, ui packersdk.Ui) error {
 	startTime := time.Now()
 
 	for {
-		readReq := client.VirtualMachinesAPI.ReadNamespacedVirtualMachineInstance(auth, name, namespace)
-		currentState, _, err := readReq.Execute()
+		phase, err := vmiPhase(&client, auth, name, namespace)
 		if err != nil {
 			return err
 		}
 
 		// TODO: handle failure states
-		if *currentState.Status.Phase == desiredState {
+		if phase == desiredState {
 			return nil
 		}
 
@@ -31,7 +33,7 @@ func waitForVMState(desiredState string, name string, namespace string, client h
 		}
 
 		ui.Say("Waiting for VM to be ready...")
-		time.Sleep(5 * time.Second) // Adjust the polling interval as needed
+		time.Sleep(pollInterval)
 	}
 }
 
@@ -42,7 +44,7 @@ func waitForVMStateDestroy(name string, namespace string, client harvester.APICl
 		readReq := client.VirtualMachinesAPI.ReadNamespacedVirtualMachineInstance(auth, name, namespace)
 		_, resp, err := readReq.Execute()
 
-		if resp.StatusCode == http.StatusNotFound {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
 			ui.Say("VM has been destroyed")
 			return nil
 		}
@@ -56,21 +58,79 @@ func waitForVMStateDestroy(name string, namespace string, client harvester.APICl
 		}
 
 		ui.Say("Waiting for VM to be destroyed...")
-		time.Sleep(10 * time.Second) // Adjust the polling interval as needed
+		time.Sleep(2 * pollInterval)
+	}
+}
+
+// waitForVMIStopped waits for the VMI to be deleted or to reach a final phase.
+func waitForVMIStopped(name string, namespace string, client harvester.APIClient, auth context.Context, timeout time.Duration, ui packersdk.Ui) error {
+	startTime := time.Now()
+
+	for {
+		stopped, err := vmiStopped(&client, auth, name, namespace)
+		if err != nil {
+			return err
+		}
+		if stopped {
+			return nil
+		}
+
+		if time.Since(startTime) >= timeout {
+			return errors.New("timeout waiting for VM to stop")
+		}
+
+		ui.Say("Waiting for VM to stop...")
+		time.Sleep(pollInterval)
 	}
 }
 
+// vmiStopped reports whether the VM is no longer running: its VMI is gone or
+// has finished.
+func vmiStopped(client *harvester.APIClient, auth context.Context, name string, namespace string) (bool, error) {
+	readReq := client.VirtualMachinesAPI.ReadNamespacedVirtualMachineInstance(auth, name, namespace)
+	vmi, resp, err := readReq.Execute()
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if vmi.Status != nil && vmi.Status.Phase != nil {
+		switch *vmi.Status.Phase {
+		case "Succeeded", "Failed":
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// vmiPhase returns the phase of the VM's VMI. A VMI that does not exist yet,
+// as right after the VM is started, or that has no phase yet returns "".
+func vmiPhase(client *harvester.APIClient, auth context.Context, name string, namespace string) (string, error) {
+	readReq := client.VirtualMachinesAPI.ReadNamespacedVirtualMachineInstance(auth, name, namespace)
+	vmi, resp, err := readReq.Execute()
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if vmi.Status == nil || vmi.Status.Phase == nil {
+		return "", nil
+	}
+	return *vmi.Status.Phase, nil
+}
+
 func waitForVMImageExport(desiredState string, name string, namespace string, client harvester.APIClient, auth context.Context, timeout time.Duration, ui packersdk.Ui) error {
 	startTime := time.Now()
 
 	for {
-		readReq := client.VirtualMachinesAPI.ReadNamespacedVirtualMachineInstance(auth, name, namespace)
-		currentState, _, err := readReq.Execute()
+		phase, err := vmiPhase(&client, auth, name, namespace)
 		if err != nil {
 			return err
 		}
 
-		if *currentState.Status.Phase == desiredState {
+		if phase == desiredState {
 			return nil
 		}
 
@@ -79,7 +139,7 @@ func waitForVMImageExport(desiredState string, name string, namespace string, cl
 		}
 
 		ui.Say("Waiting for VM to be ready...")
-		time.Sleep(5 * time.Second) // Adjust the polling interval as needed
+		time.Sleep(pollInterval)
 	}
 }
 
@@ -92,6 +152,12 @@ func waitForImageDownload(desiredState int32, name string, namespace string, cli
 			return err
 		}
 
+		if _, err := imageReady(*readImage); err != nil {
+			return err
+		}
+		// Harvester keeps retrying a failed import until RetryLimitExceeded
+		failure := importFailure(*readImage)
+
 		progress := int32(0)
 		// image.Status.Progress key doesnt appear until download progress starts
 		if readImage.Status.HasProgress() {
@@ -103,10 +169,90 @@ func waitForImageDownload(desiredState int32, name string, namespace string, cli
 		}
 
 		if time.Since(startTime) >= timeout {
+			if failure != "" {
+				return fmt.Errorf("timeout waiting for desired state, last import attempt failed: %s", failure)
+			}
 			return errors.New("timeout waiting for desired state")
 		}
 
-		ui.Say(fmt.Sprintf("Download in progress... %v%%", progress))
-		time.Sleep(5 * time.Second) // Adjust the polling interval as needed
+		if failure != "" {
+			ui.Say(fmt.Sprintf("Import attempt failed, waiting for Harvester to retry: %s", failure))
+		} else {
+			ui.Say(fmt.Sprintf("Download in progress... %v%%", progress))
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+func waitForImageDestroy(name string, namespace string, client harvester.APIClient, auth context.Context, timeout time.Duration, ui packersdk.Ui) error {
+	startTime := time.Now()
+
+	for {
+		readReq := client.ImagesAPI.ReadNamespacedVirtualMachineImage(auth, name, namespace)
+		_, resp, err := readReq.Execute()
+
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if time.Since(startTime) >= timeout {
+			return errors.New("timeout waiting for image to be deleted")
+		}
+
+		ui.Say("Waiting for image to be deleted...")
+		time.Sleep(pollInterval)
+	}
+}
+
+// imageReady reports whether the image finished importing. An error is
+// returned when the image is being deleted or Harvester gave up retrying its
+// import, as it will never become usable. An import attempt that failed, with
+// Imported=False, is retried by Harvester and is not an error.
+func imageReady(image harvester.HarvesterhciIoV1beta1VirtualMachineImage) (bool, error) {
+	if image.Metadata != nil && image.Metadata.DeletionTimestamp != nil {
+		return false, errors.New("image is being deleted")
+	}
+	if image.Status == nil {
+		return false, nil
+	}
+
+	imported := false
+	for _, condition := range image.Status.Conditions {
+		message := ""
+		if condition.Message != nil {
+			message = *condition.Message
+		}
+		switch {
+		case condition.Type == "RetryLimitExceeded" && condition.Status == "True":
+			return false, fmt.Errorf("image import failed and will not be retried: %s", message)
+		case condition.Type == "Imported" && condition.Status == "True":
+			imported = true
+		}
+	}
+
+	if image.Status.Progress != nil && *image.Status.Progress == 100 {
+		return true, nil
+	}
+	return imported, nil
+}
+
+// importFailure returns the message of the image's last failed import
+// attempt, or "" when its import has not failed.
+func importFailure(image harvester.HarvesterhciIoV1beta1VirtualMachineImage) string {
+	if image.Status == nil {
+		return ""
+	}
+	for _, condition := range image.Status.Conditions {
+		if condition.Type == "Imported" && condition.Status == "False" {
+			if condition.Message != nil && *condition.Message != "" {
+				return *condition.Message
+			}
+			return "no reason given"
+		}
 	}
+	return ""
 }
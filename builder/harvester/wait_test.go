@@ -0,0 +1,100 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package harvester
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+func TestImageReady(t *testing.T) {
+	cases := map[string]struct {
+		image   string
+		ready   bool
+		wantErr bool
+		failure string
+	}{
+		"no status": {
+			image: `{}`,
+		},
+		"downloading": {
+			image: `{"status": {"progress": 40}}`,
+		},
+		"imported": {
+			image: `{"status": {"progress": 100, "conditions": [{"type": "Imported", "status": "True"}]}}`,
+			ready: true,
+		},
+		"attempt failed": {
+			image:   `{"status": {"progress": 0, "conditions": [{"type": "Imported", "status": "False", "message": "404 Not Found"}]}}`,
+			failure: "404 Not Found",
+		},
+		"retries exhausted": {
+			image:   `{"status": {"conditions": [{"type": "Imported", "status": "False", "message": "404 Not Found"}, {"type": "RetryLimitExceeded", "status": "True", "message": "404 Not Found"}]}}`,
+			wantErr: true,
+			failure: "404 Not Found",
+		},
+		"being deleted": {
+			image:   `{"metadata": {"name": "focal", "deletionTimestamp": "2024-01-01T00:00:00Z"}, "status": {"progress": 100}}`,
+			wantErr: true,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			obj := fakeImage("focal", "focal", nil)
+			if err := json.Unmarshal([]byte(tc.image), &obj); err != nil {
+				t.Fatal(err)
+			}
+			image := sdkImage(t, obj)
+
+			ready, err := imageReady(image)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("imageReady error %v, want an error %t", err, tc.wantErr)
+			}
+			if ready != tc.ready {
+				t.Errorf("imageReady is %t, want %t", ready, tc.ready)
+			}
+			if got := importFailure(image); got != tc.failure {
+				t.Errorf("importFailure is %q, want %q", got, tc.failure)
+			}
+		})
+	}
+}
+
+func TestWaitForVMState(t *testing.T) {
+	f := newFakeHarvester(t)
+	client, auth := f.client()
+	// the VMI is created after the VM is started, and has no phase at first
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		f.put(fakeVMIs, "default", fakeObject{"metadata": map[string]interface{}{"name": "packer"}})
+	}()
+	reads := 0
+	f.onRead[fakeVMIs] = func(obj fakeObject) {
+		reads++
+		if reads == 3 {
+			obj["status"] = map[string]interface{}{"phase": "Running"}
+		}
+	}
+
+	if err := waitForVMState("Running", "packer", "default", *client, auth, 5*time.Second, packersdk.TestUi(t)); err != nil {
+		t.Fatalf("waitForVMState: %v", err)
+	}
+	if reads != 3 {
+		t.Errorf("VMI read %d times, want the wait to end once it is running", reads)
+	}
+}
+
+func TestWaitForVMState_timeout(t *testing.T) {
+	f := newFakeHarvester(t)
+	client, auth := f.client()
+
+	err := waitForVMState("Running", "packer", "default", *client, auth, 20*time.Millisecond, packersdk.TestUi(t))
+	if err == nil || !strings.Contains(err.Error(), "timeout") {
+		t.Errorf("waitForVMState error %v, want a timeout while the VMI does not exist", err)
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package harvester
+
+import (
+	harvester "github.com/drewmullen/harvester-go-sdk"
+)
+
+// vmFeatures returns the domain features of the builder VM. windows guests get
+// the Hyper-V enlightenments Harvester's Windows template enables.
+func vmFeatures(c *Config) *harvester.KubevirtIoApiCoreV1Features {
+	features := &harvester.KubevirtIoApiCoreV1Features{
+		Acpi: &harvester.KubevirtIoApiCoreV1FeatureState{},
+		Smm: &harvester.KubevirtIoApiCoreV1FeatureState{
+			Enabled: toBoolPtr(true),
+		},
+	}
+	if c.BuilderConfiguration.OSFamily != OSFamilyWindows {
+		return features
+	}
+
+	features.Apic = &harvester.KubevirtIoApiCoreV1FeatureAPIC{}
+	features.Hyperv = &harvester.KubevirtIoApiCoreV1FeatureHyperv{
+		Relaxed: &harvester.KubevirtIoApiCoreV1FeatureState{},
+		Vapic:   &harvester.KubevirtIoApiCoreV1FeatureState{},
+		Spinlocks: &harvester.KubevirtIoApiCoreV1FeatureSpinlocks{
+			Spinlocks: toInt64Ptr(8191),
+		},
+		Vpindex: &harvester.KubevirtIoApiCoreV1FeatureState{},
+		Runtime: &harvester.KubevirtIoApiCoreV1FeatureState{},
+		Synic:   &harvester.KubevirtIoApiCoreV1FeatureState{},
+		Synictimer: &harvester.KubevirtIoApiCoreV1SyNICTimer{
+			Enabled: toBoolPtr(true),
+		},
+		Reset:       &harvester.KubevirtIoApiCoreV1FeatureState{},
+		Frequencies: &harvester.KubevirtIoApiCoreV1FeatureState{},
+	}
+	return features
+}
+
+// cloudInitDiskBus returns the bus of the cloud-init disk. windows cannot read
+// a virtio disk until the virtio drivers are installed, so it gets sata.
+func cloudInitDiskBus(c *Config) string {
+	if c.BuilderConfiguration.OSFamily == OSFamilyWindows {
+		return DiskBusSata
+	}
+	return DiskBusVirtio
+}
+
+// vmClock returns the clock of the builder VM. windows keeps its clock in UTC
+// and needs the Hyper-V timer with the legacy timers tuned down.
+func vmClock(c *Config) *harvester.KubevirtIoApiCoreV1Clock {
+	if c.BuilderConfiguration.OSFamily != OSFamilyWindows {
+		return nil
+	}
+	return &harvester.KubevirtIoApiCoreV1Clock{
+		Utc: &harvester.KubevirtIoApiCoreV1ClockOffsetUTC{},
+		Timer: &harvester.KubevirtIoApiCoreV1Timer{
+			Hpet: &harvester.KubevirtIoApiCoreV1HPETTimer{
+				Present: toBoolPtr(false),
+			},
+			Hyperv: &harvester.KubevirtIoApiCoreV1HypervTimer{},
+			Pit: &harvester.KubevirtIoApiCoreV1PITTimer{
+				TickPolicy: toStringPtr("delay"),
+			},
+			Rtc: &harvester.KubevirtIoApiCoreV1RTCTimer{
+				TickPolicy: toStringPtr("catchup"),
+			},
+		},
+	}
+}
+
+// vmInputs adds a usb tablet for windows so the pointer tracks over VNC.
+func vmInputs(c *Config) []harvester.KubevirtIoApiCoreV1Input {
+	if c.BuilderConfiguration.OSFamily != OSFamilyWindows {
+		return nil
+	}
+	return []harvester.KubevirtIoApiCoreV1Input{
+		{
+			Bus:  toStringPtr("usb"),
+			Name: "tablet",
+			Type: "tablet",
+		},
+	}
+}
+
+// guestLabels adds the labels Harvester uses to describe the guest OS and its
+// login user to labels.
+func guestLabels(c *Config, labels map[string]string) *map[string]string {
+	labels["harvesterhci.io/os"] = c.BuilderConfiguration.OSFamily
+	if c.Comm.Type == "ssh" && c.Comm.SSHUsername != "" {
+		labels["tag.harvesterhci.io/ssh-user"] = c.Comm.SSHUsername
+	}
+	return &labels
+}
@@ -0,0 +1,242 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package harvester
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+)
+
+// windowsSettings are the settings of a windows installer build.
+func windowsSettings() map[string]interface{} {
+	return map[string]interface{}{
+		"communicator":          "",
+		"winrm_username":        "Administrator",
+		"winrm_password":        "password",
+		"builder_configuration": map[string]interface{}{"os_family": OSFamilyWindows},
+	}
+}
+
+func TestConfigPrepare_osFamily(t *testing.T) {
+	cases := map[string]struct {
+		settings     map[string]interface{}
+		wantComm     string
+		wantRootBus  string
+		wantNICModel string
+		wantErr      string
+	}{
+		"linux": {
+			settings:     map[string]interface{}{},
+			wantComm:     "none",
+			wantRootBus:  DiskBusVirtio,
+			wantNICModel: NICModelVirtio,
+		},
+		"linux with ssh": {
+			settings:     map[string]interface{}{"communicator": "", "ssh_username": "ubuntu"},
+			wantComm:     "ssh",
+			wantRootBus:  DiskBusVirtio,
+			wantNICModel: NICModelVirtio,
+		},
+		"windows": {
+			settings:     windowsSettings(),
+			wantComm:     "winrm",
+			wantRootBus:  DiskBusSata,
+			wantNICModel: NICModelE1000,
+		},
+		"windows with virtio": {
+			settings: map[string]interface{}{
+				"communicator":   "",
+				"winrm_username": "Administrator",
+				"winrm_password": "password",
+				"builder_configuration": map[string]interface{}{
+					"os_family":         OSFamilyWindows,
+					"root_disk_bus":     DiskBusVirtio,
+					"network_interface": []map[string]interface{}{{"type": "masquerade", "model": NICModelVirtio}},
+				},
+			},
+			wantComm:     "winrm",
+			wantRootBus:  DiskBusVirtio,
+			wantNICModel: NICModelVirtio,
+		},
+		"unknown os family": {
+			settings: map[string]interface{}{
+				"builder_configuration": map[string]interface{}{"os_family": "freebsd"},
+			},
+			wantErr: `os_family must be "linux" or "windows"`,
+		},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			c := &Config{}
+			_, err := c.Prepare(testConfigRaw(tc.settings))
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Errorf("Prepare error %v, want %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Prepare: %s", err)
+			}
+			if c.Comm.Type != tc.wantComm {
+				t.Errorf("communicator is %q, want %q", c.Comm.Type, tc.wantComm)
+			}
+			if c.BuilderConfiguration.RootDiskBus != tc.wantRootBus {
+				t.Errorf("root disk bus is %q, want %q", c.BuilderConfiguration.RootDiskBus, tc.wantRootBus)
+			}
+			if got := c.BuilderConfiguration.NetworkInterfaces[0].Model; got != tc.wantNICModel {
+				t.Errorf("NIC model is %q, want %q", got, tc.wantNICModel)
+			}
+		})
+	}
+}
+
+func TestConfigPrepare_windowsDiskBus(t *testing.T) {
+	disks := []map[string]interface{}{
+		{"name": "data", "size": "10Gi"},
+		{"name": "fast", "size": "10Gi", "bus": DiskBusVirtio},
+	}
+
+	c := &Config{}
+	if _, err := c.Prepare(testConfigRaw(map[string]interface{}{
+		"builder_configuration": map[string]interface{}{"disk": disks},
+	})); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.BuilderConfiguration.Disks[0].Bus; got != DiskBusVirtio {
+		t.Errorf("linux data disk bus is %q, want %q", got, DiskBusVirtio)
+	}
+	if got := cloudInitDiskBus(c); got != DiskBusVirtio {
+		t.Errorf("linux cloud-init disk bus is %q, want %q", got, DiskBusVirtio)
+	}
+
+	settings := windowsSettings()
+	settings["builder_configuration"] = map[string]interface{}{"os_family": OSFamilyWindows, "disk": disks}
+	c = &Config{}
+	if _, err := c.Prepare(testConfigRaw(settings)); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.BuilderConfiguration.Disks[0].Bus; got != DiskBusSata {
+		t.Errorf("windows data disk bus is %q, want %q", got, DiskBusSata)
+	}
+	if got := c.BuilderConfiguration.Disks[1].Bus; got != DiskBusVirtio {
+		t.Errorf("windows data disk bus is %q, want the configured %q", got, DiskBusVirtio)
+	}
+	if got := cloudInitDiskBus(c); got != DiskBusSata {
+		t.Errorf("windows cloud-init disk bus is %q, want %q", got, DiskBusSata)
+	}
+}
+
+func TestVMDomainLinux(t *testing.T) {
+	c := &Config{}
+	if _, err := c.Prepare(testConfigRaw(nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	features := vmFeatures(c)
+	if features.Acpi == nil || features.Smm == nil || !*features.Smm.Enabled {
+		t.Errorf("features are %+v, want ACPI and SMM", features)
+	}
+	if features.Hyperv != nil || features.Apic != nil {
+		t.Errorf("linux features %+v include the windows enlightenments", features)
+	}
+	if clock := vmClock(c); clock != nil {
+		t.Errorf("linux clock is %+v, want the default", clock)
+	}
+	if inputs := vmInputs(c); inputs != nil {
+		t.Errorf("linux inputs are %+v, want none", inputs)
+	}
+}
+
+func TestVMDomainWindows(t *testing.T) {
+	c := &Config{}
+	if _, err := c.Prepare(testConfigRaw(windowsSettings())); err != nil {
+		t.Fatal(err)
+	}
+
+	features := vmFeatures(c)
+	if features.Hyperv == nil || features.Apic == nil {
+		t.Fatalf("features are %+v, want the Hyper-V enlightenments", features)
+	}
+	if got := *features.Hyperv.Spinlocks.Spinlocks; got != 8191 {
+		t.Errorf("spinlocks are %d, want 8191", got)
+	}
+
+	clock := vmClock(c)
+	if clock == nil || clock.Utc == nil || clock.Timer == nil || clock.Timer.Hyperv == nil {
+		t.Fatalf("clock is %+v, want UTC with the Hyper-V timer", clock)
+	}
+	if *clock.Timer.Hpet.Present {
+		t.Error("HPET timer is present")
+	}
+
+	inputs := vmInputs(c)
+	if len(inputs) != 1 || inputs[0].Type != "tablet" || *inputs[0].Bus != "usb" {
+		t.Errorf("inputs are %+v, want a usb tablet", inputs)
+	}
+}
+
+func TestGuestLabels(t *testing.T) {
+	c := &Config{}
+	_, err := c.Prepare(testConfigRaw(map[string]interface{}{"communicator": "ssh", "ssh_username": "ubuntu"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	labels := *guestLabels(c, map[string]string{})
+	if labels["harvesterhci.io/os"] != OSFamilyLinux || labels["tag.harvesterhci.io/ssh-user"] != "ubuntu" {
+		t.Errorf("linux labels are %v", labels)
+	}
+
+	c = &Config{}
+	if _, err := c.Prepare(testConfigRaw(windowsSettings())); err != nil {
+		t.Fatal(err)
+	}
+	labels = *guestLabels(c, map[string]string{})
+	if labels["harvesterhci.io/os"] != OSFamilyWindows {
+		t.Errorf("windows os label is %q", labels["harvesterhci.io/os"])
+	}
+	if _, ok := labels["tag.harvesterhci.io/ssh-user"]; ok {
+		t.Errorf("windows labels %v carry an ssh user", labels)
+	}
+}
+
+func TestStepCreateVM_windows(t *testing.T) {
+	f := newFakeHarvester(t)
+	c := f.config(windowsSettings())
+	state := f.state(c)
+	state.Put("volumeName", "packer-root")
+
+	if action := (&StepCreateVM{}).Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("unexpected action %v: %v", action, state.Get("error"))
+	}
+
+	vm := f.get(fakeVMs, "default", state.Get("Name").(string))
+	if got := fakeMeta(vm)["labels"].(map[string]interface{})["harvesterhci.io/os"]; got != OSFamilyWindows {
+		t.Errorf("VM os label is %v, want %s", got, OSFamilyWindows)
+	}
+	domain := vm["spec"].(map[string]interface{})["template"].(map[string]interface{})["spec"].(map[string]interface{})["domain"].(map[string]interface{})
+	if _, ok := domain["features"].(map[string]interface{})["hyperv"]; !ok {
+		t.Errorf("domain features %v have no Hyper-V enlightenments", domain["features"])
+	}
+	if _, ok := domain["clock"]; !ok {
+		t.Error("domain has no clock")
+	}
+	devices := domain["devices"].(map[string]interface{})
+	for _, d := range devices["disks"].([]interface{}) {
+		disk := d.(map[string]interface{})
+		if disk["name"] != "rootdisk" && disk["name"] != "cloudinitdisk" {
+			continue
+		}
+		if got := disk["disk"].(map[string]interface{})["bus"]; got != DiskBusSata {
+			t.Errorf("%s bus is %v, want %s", disk["name"], got, DiskBusSata)
+		}
+	}
+	iface := devices["interfaces"].([]interface{})[0].(map[string]interface{})
+	if got := iface["model"]; got != NICModelE1000 {
+		t.Errorf("interface model is %v, want %s", got, NICModelE1000)
+	}
+}
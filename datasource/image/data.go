@@ -0,0 +1,145 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+//go:generate packer-sdc mapstructure-to-hcl2 -type Config,DatasourceOutput
+package image
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/hashicorp/packer-plugin-sdk/hcl2helper"
+	packersdk "github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/template/config"
+	"github.com/zclconf/go-cty/cty"
+
+	"github.com/rptcloud/packer-plugin-harvester/builder/harvester"
+)
+
+type Config struct {
+	// default to the HARVESTER_URL environment variable
+	HarvesterURL string `mapstructure:"harvester_url" required:"false"`
+	// default to the HARVESTER_TOKEN environment variable
+	HarvesterToken string `mapstructure:"harvester_token" required:"false"`
+	// default to the HARVESTER_NAMESPACE environment variable
+	HarvesterNamespace string `mapstructure:"harvester_namespace" required:"false"`
+
+	// object name of the image, cannot be combined with the filters
+	Name string `mapstructure:"name" required:"false"`
+	// regular expression the image display name must match
+	DisplayName string `mapstructure:"display_name" required:"false"`
+	// labels the image must carry
+	Labels map[string]string `mapstructure:"labels" required:"false"`
+	// pick the newest match instead of failing when several images match
+	MostRecent bool `mapstructure:"most_recent" required:"false"`
+}
+
+type Datasource struct {
+	config Config
+}
+
+type DatasourceOutput struct {
+	Name      string `mapstructure:"name"`
+	Namespace string `mapstructure:"namespace"`
+	// "<namespace>/<name>", as volumes refer to the image
+	ID          string `mapstructure:"id"`
+	DisplayName string `mapstructure:"display_name"`
+	// the sha512 checksum Harvester verified the image against, if any
+	Checksum string `mapstructure:"checksum"`
+	// the storage class volumes created from the image must use
+	StorageClass string `mapstructure:"storage_class"`
+	// in bytes
+	Size   int64  `mapstructure:"size"`
+	OSType string `mapstructure:"os_type"`
+}
+
+func (d *Datasource) ConfigSpec() hcldec.ObjectSpec {
+	return d.config.FlatMapstructure().HCL2Spec()
+}
+
+func (d *Datasource) Configure(raws ...interface{}) error {
+	err := config.Decode(&d.config, nil, raws...)
+	if err != nil {
+		return err
+	}
+
+	if d.config.HarvesterURL == "" {
+		d.config.HarvesterURL = os.Getenv("HARVESTER_URL")
+	}
+	if d.config.HarvesterToken == "" {
+		d.config.HarvesterToken = os.Getenv("HARVESTER_TOKEN")
+	}
+	if d.config.HarvesterNamespace == "" {
+		d.config.HarvesterNamespace = os.Getenv("HARVESTER_NAMESPACE")
+	}
+
+	filter := d.filter()
+	var errs *packersdk.MultiError
+	if d.config.HarvesterURL == "" {
+		errs = packersdk.MultiErrorAppend(errs, errors.New("harvester_url must be set"))
+	}
+	if d.config.HarvesterNamespace == "" {
+		errs = packersdk.MultiErrorAppend(errs, errors.New("harvester_namespace must be set"))
+	}
+	if d.config.Name != "" && !filter.Empty() {
+		errs = packersdk.MultiErrorAppend(errs, errors.New("name cannot be combined with display_name, labels or most_recent"))
+	}
+	if d.config.Name == "" && filter.Empty() {
+		errs = packersdk.MultiErrorAppend(errs, errors.New("one of name, display_name, labels or most_recent must be set"))
+	}
+	if d.config.DisplayName != "" {
+		if _, err := regexp.Compile(d.config.DisplayName); err != nil {
+			errs = packersdk.MultiErrorAppend(errs, fmt.Errorf("display_name: %v", err))
+		}
+	}
+
+	if errs != nil && len(errs.Errors) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (d *Datasource) OutputSpec() hcldec.ObjectSpec {
+	return (&DatasourceOutput{}).FlatMapstructure().HCL2Spec()
+}
+
+func (d *Datasource) Execute() (cty.Value, error) {
+	image, err := harvester.LookupImage(d.config.HarvesterURL, d.config.HarvesterToken, d.config.HarvesterNamespace, d.config.Name, d.filter())
+	if err != nil {
+		return cty.NullVal(cty.EmptyObject), fmt.Errorf("error looking up image: %v", err)
+	}
+
+	output := DatasourceOutput{
+		Name:        *image.Metadata.Name,
+		Namespace:   d.config.HarvesterNamespace,
+		ID:          fmt.Sprintf("%s/%s", d.config.HarvesterNamespace, *image.Metadata.Name),
+		DisplayName: image.Spec.DisplayName,
+	}
+	if image.Spec.Checksum != nil {
+		output.Checksum = *image.Spec.Checksum
+	}
+	if image.Status != nil {
+		if image.Status.StorageClassName != nil {
+			output.StorageClass = *image.Status.StorageClassName
+		}
+		if image.Status.Size != nil {
+			output.Size = *image.Status.Size
+		}
+	}
+	if image.Metadata.Labels != nil {
+		output.OSType = (*image.Metadata.Labels)["harvesterhci.io/os-type"]
+	}
+
+	return hcl2helper.HCL2ValueFromConfig(output, d.OutputSpec()), nil
+}
+
+func (d *Datasource) filter() harvester.ImageFilter {
+	return harvester.ImageFilter{
+		Labels:      d.config.Labels,
+		DisplayName: d.config.DisplayName,
+		MostRecent:  d.config.MostRecent,
+	}
+}
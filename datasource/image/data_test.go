@@ -0,0 +1,131 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package image
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const imagesPath = "/apis/harvesterhci.io/v1beta1/namespaces/default/virtualmachineimages"
+
+func testImage(name string, displayName string, created string) string {
+	return fmt.Sprintf(`{
+		"metadata": {"name": %q, "namespace": "default", "creationTimestamp": %q,
+		             "labels": {"harvesterhci.io/os-type": "ubuntu"}},
+		"spec": {"displayName": %q, "sourceType": "download", "checksum": "abc123"},
+		"status": {"progress": 100, "size": 2361393152, "storageClassName": "longhorn-%s",
+		           "conditions": [{"type": "Imported", "status": "True"}]}
+	}`, name, created, displayName, name)
+}
+
+func testServer(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case imagesPath:
+			fmt.Fprintf(w, `{"items": [%s, %s, %s]}`,
+				testImage("image-old", "ubuntu-22.04-20240101", "2024-01-01T00:00:00Z"),
+				testImage("image-new", "ubuntu-22.04-20240601", "2024-06-01T00:00:00Z"),
+				testImage("image-rhel", "rhel-9", "2024-07-01T00:00:00Z"))
+		case imagesPath + "/image-old":
+			fmt.Fprint(w, testImage("image-old", "ubuntu-22.04-20240101", "2024-01-01T00:00:00Z"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"kind": "Status", "status": "Failure", "code": 404}`)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestDatasourceConfigure(t *testing.T) {
+	cases := []struct {
+		name    string
+		raw     map[string]interface{}
+		wantErr bool
+	}{
+		{name: "name", raw: map[string]interface{}{"name": "image-old"}},
+		{name: "filter", raw: map[string]interface{}{"display_name": "^ubuntu", "most_recent": true}},
+		{name: "nothing", raw: map[string]interface{}{}, wantErr: true},
+		{name: "name and filter", raw: map[string]interface{}{"name": "image-old", "most_recent": true}, wantErr: true},
+		{name: "bad regexp", raw: map[string]interface{}{"display_name": "ubuntu("}, wantErr: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.raw["harvester_url"] = "https://harvester.example.com"
+			tc.raw["harvester_namespace"] = "default"
+			err := (&Datasource{}).Configure(tc.raw)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestDatasourceExecute(t *testing.T) {
+	server := testServer(t)
+
+	cases := []struct {
+		name string
+		raw  map[string]interface{}
+		want string
+	}{
+		{name: "name", raw: map[string]interface{}{"name": "image-old"}, want: "image-old"},
+		{name: "most recent", raw: map[string]interface{}{"display_name": "^ubuntu-22\\.04-", "most_recent": true}, want: "image-new"},
+		{name: "display name", raw: map[string]interface{}{"display_name": "^rhel"}, want: "image-rhel"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.raw["harvester_url"] = server.URL
+			tc.raw["harvester_namespace"] = "default"
+			d := &Datasource{}
+			if err := d.Configure(tc.raw); err != nil {
+				t.Fatal(err)
+			}
+			value, err := d.Execute()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := value.GetAttr("name").AsString(); got != tc.want {
+				t.Fatalf("got image %s, want %s", got, tc.want)
+			}
+			if got := value.GetAttr("id").AsString(); got != "default/"+tc.want {
+				t.Errorf("got id %s, want default/%s", got, tc.want)
+			}
+			if got := value.GetAttr("storage_class").AsString(); got != "longhorn-"+tc.want {
+				t.Errorf("got storage class %s, want longhorn-%s", got, tc.want)
+			}
+			if got, _ := value.GetAttr("size").AsBigFloat().Int64(); got != 2361393152 {
+				t.Errorf("got size %d, want 2361393152", got)
+			}
+			if got := value.GetAttr("os_type").AsString(); got != "ubuntu" {
+				t.Errorf("got os type %s, want ubuntu", got)
+			}
+			if got := value.GetAttr("checksum").AsString(); got != "abc123" {
+				t.Errorf("got checksum %s, want abc123", got)
+			}
+		})
+	}
+}
+
+func TestDatasourceExecute_ambiguous(t *testing.T) {
+	server := testServer(t)
+
+	d := &Datasource{}
+	err := d.Configure(map[string]interface{}{
+		"harvester_url":       server.URL,
+		"harvester_namespace": "default",
+		"display_name":        "^ubuntu",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Execute(); err == nil {
+		t.Fatal("expected an error when several images match without most_recent")
+	}
+}
@@ -5,15 +5,20 @@ import (
 	"os"
 
 	harvester "github.com/rptcloud/packer-plugin-harvester/builder/harvester"
+	"github.com/rptcloud/packer-plugin-harvester/datasource/image"
 
 	"github.com/hashicorp/packer-plugin-sdk/plugin"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "sweep" {
+		os.Exit(runSweep(os.Args[2:], os.Stdout, os.Stderr))
+	}
+
 	pps := plugin.NewSet()
 	pps.RegisterBuilder(plugin.DEFAULT_NAME, new(harvester.Builder))
 	// pps.RegisterPostProcessor("import", new(digitaloceanPP.PostProcessor))
-	// pps.RegisterDatasource("image", new(image.Datasource))
+	pps.RegisterDatasource("image", new(image.Datasource))
 	// pps.SetVersion(version.PluginVersion)
 	err := pps.Run()
 	if err != nil {
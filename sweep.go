@@ -0,0 +1,93 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	harvester "github.com/rptcloud/packer-plugin-harvester/builder/harvester"
+)
+
+const sweepUsage = `Usage: packer-plugin-harvester sweep [options]
+
+  Lists the builder VMs, secrets, volumes and cd_files images left behind by
+  builds that did not clean up, such as killed CI jobs. Nothing is deleted
+  unless -delete is given. Each kind of resource is deleted and waited on to
+  be gone before the next, so VMs release their volumes first.
+
+Options:
+`
+
+// runSweep implements the sweep subcommand and returns the exit code.
+func runSweep(args []string, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("sweep", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), sweepUsage)
+		flags.PrintDefaults()
+	}
+	harvesterURL := flags.String("url", os.Getenv("HARVESTER_URL"), "the Harvester API endpoint, default $HARVESTER_URL")
+	token := flags.String("token", os.Getenv("HARVESTER_TOKEN"), "the Harvester API token, default $HARVESTER_TOKEN")
+	namespaces := flags.String("namespaces", os.Getenv("HARVESTER_NAMESPACE"), "comma separated namespaces to sweep, default $HARVESTER_NAMESPACE")
+	olderThan := flags.Duration("older-than", 24*time.Hour, "only sweep resources created longer ago than this")
+	del := flags.Bool("delete", false, "delete the resources found instead of only listing them")
+	waitTimeout := flags.Duration("wait-timeout", 5*time.Minute, "how long to wait for each kind of resource to be gone before deleting the next")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	namespaceList := splitNamespaces(*namespaces)
+	if *harvesterURL == "" || len(namespaceList) == 0 {
+		fmt.Fprintln(stderr, "sweep: -url and -namespaces are required")
+		flags.Usage()
+		return 2
+	}
+
+	ctx := context.Background()
+	sweeper := harvester.NewSweeper(*harvesterURL, *token)
+	found, err := sweeper.Find(ctx, namespaceList, *olderThan)
+	if err != nil {
+		fmt.Fprintf(stderr, "sweep: %s\n", err)
+		return 1
+	}
+	if len(found) == 0 {
+		fmt.Fprintln(stdout, "No orphaned resources found")
+		return 0
+	}
+
+	if !*del {
+		for _, r := range found {
+			fmt.Fprintln(stdout, r)
+		}
+		fmt.Fprintln(stdout, "Dry run, pass -delete to delete these resources")
+		return 0
+	}
+
+	err = sweeper.DeleteAll(ctx, found, *waitTimeout, func(r harvester.OrphanedResource) {
+		fmt.Fprintf(stdout, "Deleting %s\n", r)
+	})
+	if err != nil {
+		fmt.Fprintf(stderr, "sweep: %s\n", err)
+		return 1
+	}
+	return 0
+}
+
+// splitNamespaces splits the comma separated namespaces, trimming spaces and
+// dropping empty entries such as the one a trailing comma leaves.
+func splitNamespaces(namespaces string) []string {
+	var out []string
+	for _, namespace := range strings.Split(namespaces, ",") {
+		if namespace = strings.TrimSpace(namespace); namespace != "" {
+			out = append(out, namespace)
+		}
+	}
+	return out
+}
@@ -0,0 +1,144 @@
+// Copyright (c) HashiCorp, Inc.
+// SPDX-License-Identifier: MPL-2.0
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// sweepServer serves the resources of a killed build, stored by their path,
+// and deletes them immediately.
+type sweepServer struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	objects map[string]map[string]interface{}
+	deleted []string
+}
+
+func newSweepServer(t *testing.T) *sweepServer {
+	s := &sweepServer{objects: map[string]map[string]interface{}{}}
+	created := time.Now().Add(-48 * time.Hour).UTC().Format(time.RFC3339)
+	for _, path := range []string{
+		"/apis/kubevirt.io/v1/namespaces/default/virtualmachines/packer-vm",
+		"/api/v1/namespaces/default/secrets/packer-cloudinit",
+		"/api/v1/namespaces/default/persistentvolumeclaims/packer-root",
+	} {
+		s.objects[path] = map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"name":              path[strings.LastIndex(path, "/")+1:],
+				"creationTimestamp": created,
+				"labels":            map[string]interface{}{"packer.io/build-id": "id"},
+			},
+		}
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *sweepServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+
+	obj, ok := s.objects[r.URL.Path]
+	switch {
+	case r.Method == http.MethodGet && ok:
+		_ = json.NewEncoder(w).Encode(obj)
+	case r.Method == http.MethodGet && r.URL.Query().Has("labelSelector"):
+		items := []interface{}{}
+		for path, obj := range s.objects {
+			if strings.HasPrefix(path, r.URL.Path+"/") {
+				items = append(items, obj)
+			}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"items": items})
+	case r.Method == http.MethodDelete && ok:
+		delete(s.objects, r.URL.Path)
+		s.deleted = append(s.deleted, r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:])
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"kind": "Status", "status": "Success"})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"kind": "Status", "status": "Failure", "code": http.StatusNotFound})
+	}
+}
+
+func TestRunSweep_dryRun(t *testing.T) {
+	s := newSweepServer(t)
+	var stdout, stderr bytes.Buffer
+
+	if code := runSweep([]string{"-url", s.URL, "-namespaces", "default"}, &stdout, &stderr); code != 0 {
+		t.Fatalf("exit code %d: %s", code, stderr.String())
+	}
+	for _, name := range []string{"packer-vm", "packer-cloudinit", "packer-root", "Dry run"} {
+		if !strings.Contains(stdout.String(), name) {
+			t.Errorf("output does not mention %s:\n%s", name, stdout.String())
+		}
+	}
+	if len(s.deleted) != 0 {
+		t.Errorf("dry run deleted %v", s.deleted)
+	}
+}
+
+func TestRunSweep_delete(t *testing.T) {
+	s := newSweepServer(t)
+	var stdout, stderr bytes.Buffer
+
+	if code := runSweep([]string{"-url", s.URL, "-namespaces", "default", "-delete"}, &stdout, &stderr); code != 0 {
+		t.Fatalf("exit code %d: %s", code, stderr.String())
+	}
+	want := []string{"packer-vm", "packer-cloudinit", "packer-root"}
+	if strings.Join(s.deleted, ",") != strings.Join(want, ",") {
+		t.Errorf("deleted %v, want %v in that order", s.deleted, want)
+	}
+	if strings.Contains(stdout.String(), "Dry run") {
+		t.Errorf("output claims a dry run:\n%s", stdout.String())
+	}
+}
+
+func TestRunSweep_nothingFound(t *testing.T) {
+	s := newSweepServer(t)
+	var stdout, stderr bytes.Buffer
+
+	code := runSweep([]string{"-url", s.URL, "-namespaces", "default", "-older-than", "72h"}, &stdout, &stderr)
+	if code != 0 || !strings.Contains(stdout.String(), "No orphaned resources found") {
+		t.Errorf("exit code %d, output:\n%s", code, stdout.String())
+	}
+}
+
+func TestRunSweep_missingFlags(t *testing.T) {
+	t.Setenv("HARVESTER_URL", "")
+	t.Setenv("HARVESTER_NAMESPACE", "")
+	var stdout, stderr bytes.Buffer
+
+	if code := runSweep(nil, &stdout, &stderr); code != 2 {
+		t.Errorf("exit code %d, want 2", code)
+	}
+}
+
+func TestRunSweep_namespaceList(t *testing.T) {
+	s := newSweepServer(t)
+	var stdout, stderr bytes.Buffer
+
+	if code := runSweep([]string{"-url", s.URL, "-namespaces", " default , ,"}, &stdout, &stderr); code != 0 {
+		t.Fatalf("exit code %d: %s", code, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "packer-vm") {
+		t.Errorf("output does not mention packer-vm:\n%s", stdout.String())
+	}
+
+	stdout.Reset()
+	stderr.Reset()
+	if code := runSweep([]string{"-url", s.URL, "-namespaces", " , "}, &stdout, &stderr); code != 2 {
+		t.Errorf("exit code %d, want 2 for a list of no namespaces", code)
+	}
+}